@@ -59,6 +59,11 @@ type (
 		Kind     string   `json:"kind"`
 		Text     string   `json:"text"`
 		Location Location `json:"location"`
+		// Depth and Index are the lexical address given by the resolver:
+		// the variable is in slot Index of the frame Depth levels up.
+		// Depth is -1 when the variable is not bound.
+		Depth int `json:"-"`
+		Index int `json:"-"`
 	}
 
 	Function struct {
@@ -66,7 +71,11 @@ type (
 		Parameters []Parameter `json:"parameters"`
 		Value      Term        `json:"value"`
 		Location   Location    `json:"location"`
-		Scope      Scope       `json:"-"`
+		// Slots is the size of the frames of its calls, and Free the
+		// variables it uses from the frame it is created in, both given by
+		// the resolver.
+		Slots int   `json:"-"`
+		Free  []Var `json:"-"`
 	}
 
 	Call struct {
@@ -82,6 +91,8 @@ type (
 		Value    Term      `json:"value"`
 		Next     Term      `json:"next"`
 		Location Location  `json:"location"`
+		// Index is the slot of the binding, given by the resolver.
+		Index int `json:"-"`
 	}
 
 	Str struct {
@@ -143,3 +154,37 @@ type (
 		Location Location `json:"location"`
 	}
 )
+
+// LocationOf returns the source location of a term, or the zero Location
+// when the term is not an AST node.
+func LocationOf(term Term) Location {
+	switch n := term.(type) {
+	case Int:
+		return n.Location
+	case Str:
+		return n.Location
+	case Bool:
+		return n.Location
+	case Var:
+		return n.Location
+	case Function:
+		return n.Location
+	case Call:
+		return n.Location
+	case Let:
+		return n.Location
+	case If:
+		return n.Location
+	case Binary:
+		return n.Location
+	case Tuple:
+		return n.Location
+	case Print:
+		return n.Location
+	case First:
+		return n.Location
+	case Second:
+		return n.Location
+	}
+	return Location{}
+}
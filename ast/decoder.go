@@ -1,355 +1,366 @@
 package ast
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"strconv"
 )
 
+var binaryOps = map[string]BinaryOp{
+	"Add": Add,
+	"Sub": Sub,
+	"Mul": Mul,
+	"Div": Div,
+	"Rem": Rem,
+	"Eq":  Eq,
+	"Neq": Neq,
+	"Lt":  Lt,
+	"Gt":  Gt,
+	"Lte": Lte,
+	"Gte": Gte,
+	"And": And,
+	"Or":  Or,
+}
+
 func (f *File) UnmarshalJSON(data []byte) error {
-	type Alias File
-	aux := &struct {
-		*Alias
-		Expression json.RawMessage `json:"expression"`
-	}{
-		Alias: (*Alias)(f),
-	}
-	if err := json.Unmarshal(data, &aux); err != nil {
+	decoded, err := Decode(bytes.NewReader(data))
+	if err != nil {
 		return err
 	}
-	var err error
-	f.Expression, err = unmarshalTerm(aux.Expression)
-	return err
+	*f = *decoded
+	return nil
 }
 
-func unmarshalTerm(data []byte) (Term, error) {
-	var t struct {
-		Kind string `json:"kind"`
-	}
-	if err := json.Unmarshal(data, &t); err != nil {
+// Decode reads a File from the JSON AST in r. The tree is built while the
+// tokens are read, in a single pass, and the keys of an object may come in
+// any order. Terms missing a field their kind requires are reported as an
+// *Error at their location.
+func Decode(r io.Reader) (*File, error) {
+	d := &decoder{dec: json.NewDecoder(r)}
+	d.dec.UseNumber()
+	if err := d.expect(json.Delim('{')); err != nil {
 		return nil, err
 	}
-	switch t.Kind {
-	case INT:
-		return unmarshalInt(data)
-	case STR:
-		return unmarshalStr(data)
-	case BOOL:
-		return unmarshalBool(data)
-	case LET:
-		return unmarshalLet(data)
-	case VAR:
-		return unmarshalVar(data)
-	case FUNCTION:
-		return unmarshalFunction(data)
-	case CALL:
-		return unmarshalCall(data)
-	case IF:
-		return unmarshalIf(data)
-	case BINARY:
-		return unmarshalBinary(data)
-	case TUPLE:
-		return unmarshalTuple(data)
-	case PRINT:
-		return unmarshalPrint(data)
-	case FIRST:
-		return unmarshalFirst(data)
-	case SECOND:
-		return unmarshalSecond(data)
-	default:
-		return nil, fmt.Errorf("invalid term kind: %s", t.Kind)
-	}
-}
 
-func unmarshalInt(data []byte) (Int, error) {
-	var i Int
-	if err := json.Unmarshal(data, &i); err != nil {
-		return Int{}, err
-	}
-	return i, nil
-}
-
-func unmarshalStr(data []byte) (Str, error) {
-	var s Str
-	if err := json.Unmarshal(data, &s); err != nil {
-		return Str{}, err
-	}
-	return s, nil
-}
-
-func unmarshalBool(data []byte) (Bool, error) {
-	var b Bool
-	if err := json.Unmarshal(data, &b); err != nil {
-		return Bool{}, err
-	}
-	return b, nil
-}
-func unmarshalLet(data []byte) (Let, error) {
-	var (
-		l   Let
-		err error
-	)
-	if err := json.Unmarshal(data, &l); err != nil {
-		return Let{}, err
-	}
-
-	bValue, err := json.Marshal(l.Value)
-	if err != nil {
-		return Let{}, err
+	var f File
+	for d.dec.More() {
+		key, err := d.key()
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "name":
+			err = d.dec.Decode(&f.Name)
+		case "expression":
+			f.Expression, err = d.term()
+		case "location":
+			err = d.dec.Decode(&f.Location)
+		default:
+			err = d.skip()
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
-	bNext, err := json.Marshal(l.Next)
-	if err != nil {
-		return Let{}, err
+	if err := d.expect(json.Delim('}')); err != nil {
+		return nil, err
 	}
-
-	l.Value, err = unmarshalTerm(bValue)
-	if err != nil {
-		return Let{}, err
+	if f.Expression == nil {
+		return nil, Errorf(f.Location, "missing expression in file")
 	}
-	l.Next, err = unmarshalTerm(bNext)
-	return l, err
+	return &f, nil
 }
 
-func unmarshalVar(data []byte) (Var, error) {
-	var v Var
-	if err := json.Unmarshal(data, &v); err != nil {
-		return Var{}, err
-	}
-	return v, nil
+type decoder struct {
+	dec *json.Decoder
 }
 
-func unmarshalFunction(data []byte) (Function, error) {
-	var (
-		f   Function
-		err error
-	)
-	if err := json.Unmarshal(data, &f); err != nil {
-		return Function{}, err
-	}
-
-	bValue, err := json.Marshal(f.Value)
-	if err != nil {
-		return Function{}, err
-	}
-
-	f.Value, err = unmarshalTerm(bValue)
-	return f, err
+// node holds the fields of any kind of term while its object is read, since
+// the kind may come after them.
+type node struct {
+	kind       string
+	text       string
+	name       Parameter
+	parameters []Parameter
+	value      Term
+	literal    any
+	next       Term
+	callee     Term
+	arguments  []Term
+	condition  Term
+	then       Term
+	otherwise  Term
+	lhs        Term
+	op         string
+	rhs        Term
+	first      Term
+	second     Term
+	location   Location
 }
 
-func unmarshalCall(data []byte) (Call, error) {
-	var (
-		c   Call
-		err error
-	)
-
-	if err := json.Unmarshal(data, &c); err != nil {
-		return Call{}, err
-	}
-
-	bCallee, err := json.Marshal(c.Callee)
-	if err != nil {
-		return Call{}, err
-	}
-
-	bArgs, err := json.Marshal(c.Arguments)
+func (d *decoder) expect(delim json.Delim) error {
+	tok, err := d.dec.Token()
 	if err != nil {
-		return Call{}, err
+		return err
 	}
-
-	c.Callee, err = unmarshalTerm(bCallee)
-	if err != nil {
-		return Call{}, err
+	if tok != delim {
+		return fmt.Errorf("expected %v, got %v", delim, tok)
 	}
-
-	c.Arguments, err = unmarshalTerms(bArgs)
-	return c, err
+	return nil
 }
 
-func unmarshalIf(data []byte) (If, error) {
-	var (
-		i   If
-		err error
-	)
-
-	if err := json.Unmarshal(data, &i); err != nil {
-		return If{}, err
-	}
-
-	bCondition, err := json.Marshal(i.Condition)
+func (d *decoder) key() (string, error) {
+	tok, err := d.dec.Token()
 	if err != nil {
-		return If{}, err
+		return "", err
 	}
-
-	bThen, err := json.Marshal(i.Then)
-	if err != nil {
-		return If{}, err
+	key, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("expected an object key, got %v", tok)
 	}
-
-	bOtherwise, err := json.Marshal(i.Otherwise)
-	if err != nil {
-		return If{}, err
-	}
-
-	i.Condition, err = unmarshalTerm(bCondition)
-	if err != nil {
-		return If{}, err
-	}
-
-	i.Then, err = unmarshalTerm(bThen)
-	if err != nil {
-		return If{}, err
-	}
-
-	i.Otherwise, err = unmarshalTerm(bOtherwise)
-	return i, err
+	return key, nil
 }
 
-func unmarshalBinary(data []byte) (Binary, error) {
-	var (
-		b   Binary
-		err error
-	)
-	opMap := map[string]BinaryOp{
-		"Add": Add,
-		"Sub": Sub,
-		"Mul": Mul,
-		"Div": Div,
-		"Rem": Rem,
-		"Eq":  Eq,
-		"Neq": Neq,
-		"Lt":  Lt,
-		"Gt":  Gt,
-		"Lte": Lte,
-		"Gte": Gte,
-		"And": And,
-		"Or":  Or,
-	}
-
-	if err := json.Unmarshal(data, &b); err != nil {
-		return Binary{}, err
-	}
+// skip reads past a value the AST has no field for.
+func (d *decoder) skip() error {
+	var discard json.RawMessage
+	return d.dec.Decode(&discard)
+}
 
-	bLhs, err := json.Marshal(b.Lhs)
+// term reads a term, or null, which leaves it missing for build to report
+// at the location of the term holding it.
+func (d *decoder) term() (Term, error) {
+	tok, err := d.dec.Token()
 	if err != nil {
-		return Binary{}, err
+		return nil, err
 	}
-
-	bRhs, err := json.Marshal(b.Rhs)
-	if err != nil {
-		return Binary{}, err
+	if tok == nil {
+		return nil, nil
 	}
-
-	b.Op = opMap[string(b.Op)]
-
-	b.Lhs, err = unmarshalTerm(bLhs)
-	if err != nil {
-		return Binary{}, err
+	if tok != json.Delim('{') {
+		return nil, fmt.Errorf("expected a term, got %v", tok)
 	}
-
-	b.Rhs, err = unmarshalTerm(bRhs)
-	return b, err
+	return d.object()
 }
 
-func unmarshalTuple(data []byte) (Tuple, error) {
-	var (
-		t   Tuple
-		err error
-	)
-
-	if err := json.Unmarshal(data, &t); err != nil {
-		return Tuple{}, err
-	}
-
-	bFirst, err := json.Marshal(t.First)
-	if err != nil {
-		return Tuple{}, err
-	}
-
-	bSecond, err := json.Marshal(t.Second)
-	if err != nil {
-		return Tuple{}, err
+// object reads the rest of a term whose opening brace was already read.
+func (d *decoder) object() (Term, error) {
+	var n node
+	for d.dec.More() {
+		key, err := d.key()
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "kind":
+			err = d.dec.Decode(&n.kind)
+		case "text":
+			err = d.dec.Decode(&n.text)
+		case "name":
+			err = d.dec.Decode(&n.name)
+		case "parameters":
+			err = d.dec.Decode(&n.parameters)
+		case "value":
+			err = d.value(&n)
+		case "next":
+			n.next, err = d.term()
+		case "callee":
+			n.callee, err = d.term()
+		case "arguments":
+			n.arguments, err = d.terms()
+		case "condition":
+			n.condition, err = d.term()
+		case "then":
+			n.then, err = d.term()
+		case "otherwise":
+			n.otherwise, err = d.term()
+		case "lhs":
+			n.lhs, err = d.term()
+		case "op":
+			err = d.dec.Decode(&n.op)
+		case "rhs":
+			n.rhs, err = d.term()
+		case "first":
+			n.first, err = d.term()
+		case "second":
+			n.second, err = d.term()
+		case "location":
+			err = d.dec.Decode(&n.location)
+		default:
+			err = d.skip()
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
-
-	t.First, err = unmarshalTerm(bFirst)
-	if err != nil {
-		return Tuple{}, err
+	if err := d.expect(json.Delim('}')); err != nil {
+		return nil, err
 	}
-
-	t.Second, err = unmarshalTerm(bSecond)
-	return t, err
+	return n.build()
 }
 
-func unmarshalPrint(data []byte) (Print, error) {
-	var (
-		p   Print
-		err error
-	)
-
-	if err := json.Unmarshal(data, &p); err != nil {
-		return Print{}, err
-	}
-
-	bValue, err := json.Marshal(p.Value)
+// value reads the value field, which is a literal for Int, Str and Bool and
+// a term for the other kinds.
+func (d *decoder) value(n *node) error {
+	tok, err := d.dec.Token()
 	if err != nil {
-		return Print{}, err
+		return err
 	}
-
-	p.Value, err = unmarshalTerm(bValue)
-	return p, err
+	switch tok := tok.(type) {
+	case json.Delim:
+		if tok != '{' {
+			return fmt.Errorf("expected a value, got %v", tok)
+		}
+		n.value, err = d.object()
+		return err
+	case json.Number:
+		v, err := strconv.ParseInt(tok.String(), 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid integer %s: %w", tok, err)
+		}
+		n.literal = int32(v)
+	case nil:
+	default:
+		n.literal = tok
+	}
+	return nil
 }
 
-func unmarshalTerms(data []byte) ([]Term, error) {
-	var terms []Term
-	if err := json.Unmarshal(data, &terms); err != nil {
+func (d *decoder) terms() ([]Term, error) {
+	if err := d.expect(json.Delim('[')); err != nil {
 		return nil, err
 	}
-	for i, term := range terms {
-		bTerm, err := json.Marshal(term)
-		if err != nil {
-			return nil, err
-		}
-		terms[i], err = unmarshalTerm(bTerm)
+	terms := []Term{}
+	for d.dec.More() {
+		term, err := d.term()
 		if err != nil {
 			return nil, err
 		}
+		terms = append(terms, term)
+	}
+	if err := d.expect(json.Delim(']')); err != nil {
+		return nil, err
 	}
 	return terms, nil
 }
 
-func unmarshalFirst(data []byte) (First, error) {
-	var (
-		f   First
-		err error
-	)
-
-	if err := json.Unmarshal(data, &f); err != nil {
-		return First{}, err
-	}
-
-	bValue, err := json.Marshal(f.Value)
-	if err != nil {
-		return First{}, err
+// build returns the term of the kind read, once it has every field the
+// kind requires.
+func (n *node) build() (Term, error) {
+	switch n.kind {
+	case INT:
+		v, ok := n.literal.(int32)
+		if !ok {
+			return nil, n.invalid()
+		}
+		return Int{Kind: INT, Value: v, Location: n.location}, nil
+	case STR:
+		v, ok := n.literal.(string)
+		if !ok {
+			return nil, n.invalid()
+		}
+		return Str{Kind: STR, Value: v, Location: n.location}, nil
+	case BOOL:
+		v, ok := n.literal.(bool)
+		if !ok {
+			return nil, n.invalid()
+		}
+		return Bool{Kind: BOOL, Value: v, Location: n.location}, nil
+	case LET:
+		if n.name.Text == "" {
+			return nil, n.missing("name")
+		}
+		if err := n.require("value", n.value, "next", n.next); err != nil {
+			return nil, err
+		}
+		return Let{Kind: LET, Name: n.name, Value: n.value, Next: n.next, Location: n.location}, nil
+	case VAR:
+		if n.text == "" {
+			return nil, n.missing("text")
+		}
+		return Var{Kind: VAR, Text: n.text, Location: n.location}, nil
+	case FUNCTION:
+		if n.parameters == nil {
+			return nil, n.missing("parameters")
+		}
+		if err := n.require("value", n.value); err != nil {
+			return nil, err
+		}
+		return Function{Kind: FUNCTION, Parameters: n.parameters, Value: n.value, Location: n.location}, nil
+	case CALL:
+		if n.arguments == nil {
+			return nil, n.missing("arguments")
+		}
+		if err := n.require("callee", n.callee); err != nil {
+			return nil, err
+		}
+		for i, arg := range n.arguments {
+			if arg == nil {
+				return nil, n.missing(fmt.Sprintf("argument %d", i+1))
+			}
+		}
+		return Call{Kind: CALL, Callee: n.callee, Arguments: n.arguments, Location: n.location}, nil
+	case IF:
+		if err := n.require("condition", n.condition, "then", n.then, "otherwise", n.otherwise); err != nil {
+			return nil, err
+		}
+		return If{Kind: IF, Condition: n.condition, Then: n.then, Otherwise: n.otherwise, Location: n.location}, nil
+	case BINARY:
+		if err := n.require("lhs", n.lhs, "rhs", n.rhs); err != nil {
+			return nil, err
+		}
+		op, ok := binaryOps[n.op]
+		if !ok {
+			return nil, Errorf(n.location, "unknown binary op %q", n.op)
+		}
+		return Binary{Kind: BINARY, Lhs: n.lhs, Op: op, Rhs: n.rhs, Location: n.location}, nil
+	case TUPLE:
+		if err := n.require("first", n.first, "second", n.second); err != nil {
+			return nil, err
+		}
+		return Tuple{Kind: TUPLE, First: n.first, Second: n.second, Location: n.location}, nil
+	case PRINT:
+		if err := n.require("value", n.value); err != nil {
+			return nil, err
+		}
+		return Print{Kind: PRINT, Value: n.value, Location: n.location}, nil
+	case FIRST:
+		if err := n.require("value", n.value); err != nil {
+			return nil, err
+		}
+		return First{Kind: FIRST, Value: n.value, Location: n.location}, nil
+	case SECOND:
+		if err := n.require("value", n.value); err != nil {
+			return nil, err
+		}
+		return Second{Kind: SECOND, Value: n.value, Location: n.location}, nil
+	default:
+		return nil, Errorf(n.location, "invalid term kind: %s", n.kind)
 	}
-
-	f.Value, err = unmarshalTerm(bValue)
-	return f, err
 }
 
-func unmarshalSecond(data []byte) (Second, error) {
-	var (
-		s   Second
-		err error
-	)
+func (n *node) missing(field string) error {
+	return Errorf(n.location, "missing %s in %s", field, n.kind)
+}
 
-	if err := json.Unmarshal(data, &s); err != nil {
-		return Second{}, err
+// require reports the first missing term among pairs of field names and
+// terms.
+func (n *node) require(fields ...any) error {
+	for i := 0; i < len(fields); i += 2 {
+		if fields[i+1] == nil {
+			return n.missing(fields[i].(string))
+		}
 	}
+	return nil
+}
 
-	bValue, err := json.Marshal(s.Value)
-	if err != nil {
-		return Second{}, err
+// invalid reports the value of an Int, Str or Bool, which is missing or
+// has the wrong type.
+func (n *node) invalid() error {
+	if n.literal == nil {
+		return n.missing("value")
 	}
-
-	s.Value, err = unmarshalTerm(bValue)
-	return s, err
-
+	return Errorf(n.location, "invalid value for %s: %v", n.kind, n.literal)
 }
@@ -0,0 +1,87 @@
+package ast_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+)
+
+func TestDecodeKeysInAnyOrder(t *testing.T) {
+	src := `{"expression": {"location": {"start": 0, "end": 5, "filename": "a"}, "lhs": {"value": 1, "kind": "Int"},
+		"rhs": {"kind": "Str", "value": "a"}, "op": "Add", "extra": [1, {"x": null}], "kind": "Binary"}, "name": "a"}`
+	f, err := ast.Decode(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ast.Binary{
+		Kind:     ast.BINARY,
+		Lhs:      ast.Int{Kind: ast.INT, Value: 1},
+		Op:       ast.Add,
+		Rhs:      ast.Str{Kind: ast.STR, Value: "a"},
+		Location: ast.Location{Start: 0, End: 5, Filename: "a"},
+	}
+	if f.Name != "a" || !reflect.DeepEqual(f.Expression, want) {
+		t.Errorf("got %+v", f)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`{"expression": {"kind": "Foo"}}`, "invalid term kind: Foo"},
+		{`{"expression": {"kind": "Print", "value": {"kind": "Bar"}}}`, "invalid term kind: Bar"},
+		{`{"expression": {"kind": "Call", "callee": null, "arguments": []}}`, "missing callee in Call"},
+		{`{"expression": {"kind": "Int", "value": 4294967296}}`, "invalid integer 4294967296"},
+		{`{"expression": {"kind": "Int", "value": "1"}}`, "invalid value for Int: 1"},
+		{`{"expression": {"kind": "Var"`, "unexpected end of JSON input"},
+	}
+
+	for _, tt := range tests {
+		_, err := ast.Decode(strings.NewReader(tt.src))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestDecodeMissingFields(t *testing.T) {
+	const loc = `"location": {"start": 1, "end": 2, "filename": "a"}`
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`{"name": "a", "location": {"start": 0, "end": 0, "filename": "a"}}`, "a:0:0: missing expression in file"},
+		{`{"expression": {"kind": "Print", ` + loc + `}}`, "a:1:2: missing value in Print"},
+		{`{"expression": {"kind": "First", "value": null, ` + loc + `}}`, "a:1:2: missing value in First"},
+		{`{"expression": {"kind": "Let", "name": {"text": "x"}, "value": {"kind": "Int", "value": 1}, ` + loc + `}}`, "a:1:2: missing next in Let"},
+		{`{"expression": {"kind": "Let", "name": {"text": "x"}, "value": {"kind": "Int", "value": 1}, "next": null, ` + loc + `}}`, "a:1:2: missing next in Let"},
+		{`{"expression": {"kind": "Let", "value": {"kind": "Int", "value": 1}, "next": {"kind": "Int", "value": 1}, ` + loc + `}}`, "a:1:2: missing name in Let"},
+		{`{"expression": {"kind": "If", "condition": {"kind": "Bool", "value": true}, "then": {"kind": "Int", "value": 1}, ` + loc + `}}`, "a:1:2: missing otherwise in If"},
+		{`{"expression": {"kind": "Call", "arguments": [], ` + loc + `}}`, "a:1:2: missing callee in Call"},
+		{`{"expression": {"kind": "Call", "callee": {"kind": "Var", "text": "f"}, ` + loc + `}}`, "a:1:2: missing arguments in Call"},
+		{`{"expression": {"kind": "Call", "callee": {"kind": "Var", "text": "f"}, "arguments": [null], ` + loc + `}}`, "a:1:2: missing argument 1 in Call"},
+		{`{"expression": {"kind": "Function", "value": {"kind": "Int", "value": 1}, ` + loc + `}}`, "a:1:2: missing parameters in Function"},
+		{`{"expression": {"kind": "Binary", "lhs": {"kind": "Int", "value": 1}, "op": "Add", ` + loc + `}}`, "a:1:2: missing rhs in Binary"},
+		{`{"expression": {"kind": "Binary", "lhs": {"kind": "Int", "value": 1}, "op": "Pow", "rhs": {"kind": "Int", "value": 1}, ` + loc + `}}`, `a:1:2: unknown binary op "Pow"`},
+		{`{"expression": {"kind": "Tuple", "second": {"kind": "Int", "value": 1}, ` + loc + `}}`, "a:1:2: missing first in Tuple"},
+		{`{"expression": {"kind": "Var", ` + loc + `}}`, "a:1:2: missing text in Var"},
+		{`{"expression": {"kind": "Int", ` + loc + `}}`, "a:1:2: missing value in Int"},
+	}
+
+	for _, tt := range tests {
+		_, err := ast.Decode(strings.NewReader(tt.src))
+		var aerr *ast.Error
+		if !errors.As(err, &aerr) {
+			t.Errorf("%s: expected an *ast.Error, got %v", tt.src, err)
+			continue
+		}
+		if aerr.Error() != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.src, aerr.Error(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
+
+// The methods below encode every node in the JSON format of the reference
+// implementation. The kind is written from the type of the node, so nodes
+// built without one still encode correctly, and the annotations of the
+// resolver are left out.
+
+func (i Int) MarshalJSON() ([]byte, error)      { return marshal(i) }
+func (s Str) MarshalJSON() ([]byte, error)      { return marshal(s) }
+func (b Bool) MarshalJSON() ([]byte, error)     { return marshal(b) }
+func (v Var) MarshalJSON() ([]byte, error)      { return marshal(v) }
+func (f Function) MarshalJSON() ([]byte, error) { return marshal(f) }
+func (c Call) MarshalJSON() ([]byte, error)     { return marshal(c) }
+func (l Let) MarshalJSON() ([]byte, error)      { return marshal(l) }
+func (i If) MarshalJSON() ([]byte, error)       { return marshal(i) }
+func (b Binary) MarshalJSON() ([]byte, error)   { return marshal(b) }
+func (t Tuple) MarshalJSON() ([]byte, error)    { return marshal(t) }
+func (p Print) MarshalJSON() ([]byte, error)    { return marshal(p) }
+func (f First) MarshalJSON() ([]byte, error)    { return marshal(f) }
+func (s Second) MarshalJSON() ([]byte, error)   { return marshal(s) }
+
+// encoder writes a node and all of its children into a single buffer, so
+// encoding takes time linear in the size of the tree however deep it is.
+type encoder struct {
+	buf bytes.Buffer
+	// values writes strings and terms that are not nodes into buf. It
+	// does not escape HTML characters, leaving that choice to the encoder
+	// the node is written with.
+	values *json.Encoder
+	err    error
+}
+
+func marshal(t Term) ([]byte, error) {
+	e := &encoder{}
+	e.values = json.NewEncoder(&e.buf)
+	e.values.SetEscapeHTML(false)
+	e.term(t)
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.buf.Bytes(), nil
+}
+
+// value writes v with encoding/json, without the newline Encode ends with.
+func (e *encoder) value(v any) {
+	if e.err != nil {
+		return
+	}
+	if err := e.values.Encode(v); err != nil {
+		e.err = err
+		return
+	}
+	e.buf.Truncate(e.buf.Len() - 1)
+}
+
+// open starts the object of a node of the given kind, which key and close
+// continue.
+func (e *encoder) open(kind string) {
+	e.buf.WriteString(`{"kind":"`)
+	e.buf.WriteString(kind)
+	e.buf.WriteByte('"')
+}
+
+func (e *encoder) key(name string) {
+	e.buf.WriteString(`,"`)
+	e.buf.WriteString(name)
+	e.buf.WriteString(`":`)
+}
+
+// close writes the location of a node and ends its object.
+func (e *encoder) close(loc Location) {
+	e.key("location")
+	e.location(loc)
+	e.buf.WriteByte('}')
+}
+
+func (e *encoder) location(loc Location) {
+	e.buf.WriteString(`{"start":`)
+	e.buf.WriteString(strconv.Itoa(loc.Start))
+	e.buf.WriteString(`,"end":`)
+	e.buf.WriteString(strconv.Itoa(loc.End))
+	e.buf.WriteString(`,"filename":`)
+	e.value(loc.Filename)
+	e.buf.WriteByte('}')
+}
+
+func (e *encoder) term(t Term) {
+	switch n := t.(type) {
+	case nil:
+		e.buf.WriteString("null")
+	case Int:
+		e.open(INT)
+		e.key("value")
+		e.buf.WriteString(strconv.FormatInt(int64(n.Value), 10))
+		e.close(n.Location)
+	case Str:
+		e.open(STR)
+		e.key("value")
+		e.value(n.Value)
+		e.close(n.Location)
+	case Bool:
+		e.open(BOOL)
+		e.key("value")
+		e.buf.WriteString(strconv.FormatBool(n.Value))
+		e.close(n.Location)
+	case Var:
+		e.open(VAR)
+		e.key("text")
+		e.value(n.Text)
+		e.close(n.Location)
+	case Function:
+		e.open(FUNCTION)
+		e.key("parameters")
+		e.buf.WriteByte('[')
+		for i, param := range n.Parameters {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			e.parameter(param)
+		}
+		e.buf.WriteByte(']')
+		e.key("value")
+		e.term(n.Value)
+		e.close(n.Location)
+	case Call:
+		e.open(CALL)
+		e.key("callee")
+		e.term(n.Callee)
+		e.key("arguments")
+		e.buf.WriteByte('[')
+		for i, arg := range n.Arguments {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			e.term(arg)
+		}
+		e.buf.WriteByte(']')
+		e.close(n.Location)
+	case Let:
+		e.open(LET)
+		e.key("name")
+		e.parameter(n.Name)
+		e.key("value")
+		e.term(n.Value)
+		e.key("next")
+		e.term(n.Next)
+		e.close(n.Location)
+	case If:
+		e.open(IF)
+		e.key("condition")
+		e.term(n.Condition)
+		e.key("then")
+		e.term(n.Then)
+		e.key("otherwise")
+		e.term(n.Otherwise)
+		e.close(n.Location)
+	case Binary:
+		e.open(BINARY)
+		e.key("lhs")
+		e.term(n.Lhs)
+		e.key("op")
+		e.value(n.Op)
+		e.key("rhs")
+		e.term(n.Rhs)
+		e.close(n.Location)
+	case Tuple:
+		e.open(TUPLE)
+		e.key("first")
+		e.term(n.First)
+		e.key("second")
+		e.term(n.Second)
+		e.close(n.Location)
+	case Print:
+		e.open(PRINT)
+		e.key("value")
+		e.term(n.Value)
+		e.close(n.Location)
+	case First:
+		e.open(FIRST)
+		e.key("value")
+		e.term(n.Value)
+		e.close(n.Location)
+	case Second:
+		e.open(SECOND)
+		e.key("value")
+		e.term(n.Value)
+		e.close(n.Location)
+	default:
+		e.value(t)
+	}
+}
+
+func (e *encoder) parameter(p Parameter) {
+	e.buf.WriteString(`{"text":`)
+	e.value(p.Text)
+	e.key("location")
+	e.location(p.Location)
+	e.buf.WriteByte('}')
+}
@@ -0,0 +1,108 @@
+package ast_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/parser"
+)
+
+// generic decodes data without the AST types, so documents can be compared
+// regardless of key order and spacing.
+func generic(t *testing.T, data []byte) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestRoundTrip(t *testing.T) {
+	names, err := filepath.Glob("../files/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) == 0 {
+		t.Fatal("no files to test")
+	}
+
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var f ast.File
+		if err := json.Unmarshal(data, &f); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		encoded, err := json.Marshal(&f)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got, want := generic(t, encoded), generic(t, data); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: re-encoded AST differs from the original:\n%s", name, encoded)
+		}
+	}
+}
+
+func TestMarshalEveryNode(t *testing.T) {
+	src := `let t = (first((1, "a")), second((true, false)));
+let f = fn () => { if (t == t) { print(f) } else { 1 + 2 } };
+f()`
+	f, err := parser.ParseString("test.rinha", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded ast.File
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	reencoded, err := json.Marshal(&decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := generic(t, reencoded), generic(t, encoded); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %s, want %s", reencoded, encoded)
+	}
+}
+
+func TestMarshalWritesKind(t *testing.T) {
+	term := ast.Call{
+		Callee:   ast.Var{Text: "f", Depth: 1, Index: 2},
+		Location: ast.Location{Start: 0, End: 3, Filename: "a.rinha"},
+	}
+	got, err := json.Marshal(term)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"kind":"Call","callee":{"kind":"Var","text":"f","location":{"start":0,"end":0,"filename":""}},"arguments":[],"location":{"start":0,"end":3,"filename":"a.rinha"}}`
+	if string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// BenchmarkMarshalNested encodes a deep chain of lets, which takes time
+// linear in its depth only if children are not re-encoded by every parent.
+func BenchmarkMarshalNested(b *testing.B) {
+	var term ast.Term = ast.Int{Value: 1}
+	for i := 0; i < 2000; i++ {
+		term = ast.Let{Name: ast.Parameter{Text: "x"}, Value: ast.Str{Value: "<a>"}, Next: term}
+	}
+	f := ast.File{Name: "nested.rinha", Expression: term}
+
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(&f); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
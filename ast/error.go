@@ -0,0 +1,19 @@
+package ast
+
+import "fmt"
+
+// Error is a problem found in a program before it runs, like a syntax, type
+// or code generation error, reported at the location it was found.
+type Error struct {
+	Location Location
+	Message  string
+}
+
+// Errorf returns an Error at loc with a formatted message.
+func Errorf(loc Location, format string, args ...any) *Error {
+	return &Error{Location: loc, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.Location.Filename, e.Location.Start, e.Location.End, e.Message)
+}
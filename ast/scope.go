@@ -4,21 +4,22 @@ type Scope map[string]Term
 
 const SCOPE_DEFAULT_SIZE = 32
 
-func (s Scope) Clone() Scope {
-	clone := make(Scope, len(s)+SCOPE_DEFAULT_SIZE)
-	for k, v := range s {
-		clone[k] = v
-	}
-	return clone
+// Frame holds the variables of a function call in slots, addressed by the
+// resolver, and links to the frame holding the variables its closure
+// captured.
+type Frame struct {
+	Parent *Frame
+	Slots  []Term
+}
+
+func NewFrame(parent *Frame, size int) *Frame {
+	return &Frame{Parent: parent, Slots: make([]Term, size)}
 }
 
-func (s Scope) Zip(other Scope) Scope {
-    clone := make(Scope, len(s)+len(other))
-    for k, v := range s {
-        clone[k] = v
-    }
-    for k, v := range other {
-        clone[k] = v
-    }
-    return clone
+// Lookup returns the variable in slot index of the frame depth levels up.
+func (f *Frame) Lookup(depth, index int) Term {
+	for ; depth > 0; depth-- {
+		f = f.Parent
+	}
+	return f.Slots[index]
 }
@@ -0,0 +1,60 @@
+package ast_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+)
+
+// The benchmarks below model one call of a function with two parameters
+// that reads them and two variables of the enclosing function, with 16
+// variables in scope: Scope is how environments were built before the
+// resolver, Frame is how they are built now.
+
+// merge copies scopes into a new one, like calls used to merge the scope of
+// the caller with the environment of the closure.
+func merge(scopes ...ast.Scope) ast.Scope {
+	merged := make(ast.Scope, ast.SCOPE_DEFAULT_SIZE)
+	for _, scope := range scopes {
+		for name, v := range scope {
+			merged[name] = v
+		}
+	}
+	return merged
+}
+
+func BenchmarkScopeCall(b *testing.B) {
+	caller := make(ast.Scope, ast.SCOPE_DEFAULT_SIZE)
+	for i := 0; i < 16; i++ {
+		caller["v"+strconv.Itoa(i)] = i
+	}
+	env := merge(caller)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		scope := merge(caller, env)
+		scope["x"], scope["y"] = i, i
+		_ = scope["x"]
+		_ = scope["y"]
+		_ = scope["v3"]
+		_ = scope["v12"]
+	}
+}
+
+func BenchmarkFrameCall(b *testing.B) {
+	outer := ast.NewFrame(nil, 16)
+	for i := range outer.Slots {
+		outer.Slots[i] = i
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		frame := ast.NewFrame(outer, 2)
+		frame.Slots[0], frame.Slots[1] = i, i
+		_ = frame.Lookup(0, 0)
+		_ = frame.Lookup(0, 1)
+		_ = frame.Lookup(1, 3)
+		_ = frame.Lookup(1, 12)
+	}
+}
@@ -1,45 +1,49 @@
 package ast
 
 type Visitor interface {
-	Int(Scope, Int) Term
-	Str(Scope, Str) Term
-	Bool(Scope, Bool) Term
-	Let(Scope, Let) Term
-	Function(Scope, Function) Term
-	If(Scope, If) Term
-	Binary(Scope, Binary) Term
-	Var(Scope, Var) Term
-	Print(Scope, Print) Term
-	Call(Scope, Call) Term
-	Tuple(Scope, Tuple) Term
-	First(Scope, First) Term
-	Second(Scope, Second) Term
+	Int(*Frame, Int) Term
+	Str(*Frame, Str) Term
+	Bool(*Frame, Bool) Term
+	Let(*Frame, Let) Term
+	Function(*Frame, Function) Term
+	If(*Frame, If) Term
+	Binary(*Frame, Binary) Term
+	Var(*Frame, Var) Term
+	Print(*Frame, Print) Term
+	Call(*Frame, Call) Term
+	Tuple(*Frame, Tuple) Term
+	First(*Frame, First) Term
+	Second(*Frame, Second) Term
 }
 
-func Walk(v Visitor, scope Scope, node Term) Term {
+func Walk(v Visitor, env *Frame, node Term) Term {
 	switch n := node.(type) {
-	case Int, Str, Bool:
-		return n
+	case Int:
+		return v.Int(env, n)
+	case Str:
+		return v.Str(env, n)
+	case Bool:
+		return v.Bool(env, n)
 	case Let:
-		return v.Let(scope, n)
+		return v.Let(env, n)
 	case Function:
-		return v.Function(scope, n)
+		return v.Function(env, n)
 	case If:
-		return v.If(scope, n)
+		return v.If(env, n)
 	case Binary:
-		return v.Binary(scope, n)
+		return v.Binary(env, n)
 	case Var:
-		return v.Var(scope, n)
+		return v.Var(env, n)
 	case Print:
-		return v.Print(scope, n)
+		return v.Print(env, n)
 	case Call:
-		return v.Call(scope, n)
+		return v.Call(env, n)
 	case Tuple:
-		return v.Tuple(scope, n)
+		return v.Tuple(env, n)
 	case First:
-		return v.First(scope, n)
+		return v.First(env, n)
 	case Second:
-		return v.Second(scope, n)
+		return v.Second(env, n)
 	}
 	return nil
 }
@@ -0,0 +1,374 @@
+// Package c translates Rinha programs into portable C99.
+package c
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/closure"
+	"github.com/ghhernandes/rinha-compiler-go/diag"
+	"github.com/ghhernandes/rinha-compiler-go/purity"
+)
+
+// ErrNoCompiler is returned by Compile when no C compiler is on the PATH.
+var ErrNoCompiler = errors.New("no C compiler found")
+
+// function is a closure converted function being lowered to a C function.
+type function struct {
+	ir *closure.Function
+	// locals holds the C variable of each local slot.
+	locals []string
+	body   bytes.Buffer
+}
+
+type generator struct {
+	sources *diag.SourceMap
+	pure    purity.Set
+	fn      *function
+	strings map[string]string
+	globals bytes.Buffer
+	idents  int
+}
+
+// Generate writes a C99 program that behaves like running f with the
+// interpreter: it prints the same output and fails with the same runtime
+// errors. Locations in errors are rendered with sources when it is not nil.
+func Generate(w io.Writer, f *ast.File, sources *diag.SourceMap) (err error) {
+	program, err := closure.Convert(f)
+	if err != nil {
+		return err
+	}
+
+	g := &generator{
+		sources: sources,
+		pure:    purity.Analyze(f.Expression),
+		strings: make(map[string]string),
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			gerr, ok := r.(*ast.Error)
+			if !ok {
+				panic(r)
+			}
+			err = gerr
+		}
+	}()
+
+	functions := make([]*function, len(program.Functions))
+	for i, fn := range program.Functions {
+		functions[i] = g.function(fn)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "/* Code generated by rinha build --target=c from %s. DO NOT EDIT. */\n\n", f.Name)
+	b.WriteString(runtime)
+	b.WriteString("\n/* Program */\n\n")
+	b.Write(g.globals.Bytes())
+	for _, fn := range functions[1:] {
+		fmt.Fprintf(&b, "static Value fn_%d(Closure *self, const Value *args);\n", fn.ir.Index)
+	}
+	for _, fn := range functions[1:] {
+		fmt.Fprintf(&b, "\nstatic Value fn_%d(Closure *self, const Value *args) {\n", fn.ir.Index)
+		b.Write(fn.body.Bytes())
+		b.WriteString("}\n")
+	}
+	b.WriteString("\nstatic void *rt_main(void *arg) {\n(void)arg;\n")
+	b.Write(functions[0].body.Bytes())
+	b.WriteString("return NULL;\n}\n")
+	b.WriteString("\nint main(void) {\nrt_start(rt_main);\nfflush(stdout);\nreturn 0;\n}\n")
+
+	_, err = w.Write(indent(b.Bytes()))
+	return err
+}
+
+// Compiler returns the C compiler found on the PATH, or "" when there is
+// none. The CC environment variable takes precedence.
+func Compiler() string {
+	candidates := []string{"cc", "gcc", "clang"}
+	if cc := os.Getenv("CC"); cc != "" {
+		candidates = append([]string{cc}, candidates...)
+	}
+	for _, cc := range candidates {
+		if path, err := exec.LookPath(cc); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// Compile compiles the C file source into the executable output.
+func Compile(source, output string) error {
+	cc := Compiler()
+	if cc == "" {
+		return ErrNoCompiler
+	}
+	cmd := exec.Command(cc, "-std=c99", "-O2", "-pthread", "-o", output, source)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w\n%s", cc, err, out)
+	}
+	return nil
+}
+
+// Build generates the C program for f next to output, as output.c, and
+// compiles it into the executable output.
+func Build(f *ast.File, sources *diag.SourceMap, output string) error {
+	var src bytes.Buffer
+	if err := Generate(&src, f, sources); err != nil {
+		return err
+	}
+	source := output + ".c"
+	if err := os.WriteFile(source, src.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return Compile(source, output)
+}
+
+// indent indents the generated code by braces, so it reads like hand
+// written C.
+func indent(src []byte) []byte {
+	var (
+		out   bytes.Buffer
+		depth int
+	)
+	for _, line := range strings.Split(string(src), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "}") && depth > 0 {
+			depth--
+		}
+		if trimmed != "" && !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, " ") && depth > 0 {
+			out.WriteString(strings.Repeat("\t", depth))
+		}
+		out.WriteString(line)
+		out.WriteString("\n")
+		if strings.HasSuffix(trimmed, "{") {
+			depth++
+		}
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n"))
+}
+
+func (g *generator) errorf(loc ast.Location, format string, args ...any) {
+	panic(ast.Errorf(loc, format, args...))
+}
+
+func (g *generator) emit(format string, args ...any) {
+	fmt.Fprintf(&g.fn.body, format, args...)
+	g.fn.body.WriteString("\n")
+}
+
+func (g *generator) ident(name string) string {
+	g.idents++
+	return fmt.Sprintf("v_%s_%d", name, g.idents)
+}
+
+func (g *generator) temp() string {
+	g.idents++
+	return fmt.Sprintf("t%d", g.idents)
+}
+
+// bind assigns expr to a new temporary and returns it, so that terms are
+// evaluated in the order the interpreter evaluates them.
+func (g *generator) bind(expr string) string {
+	t := g.temp()
+	g.emit("Value %s = %s;", t, expr)
+	return t
+}
+
+func (g *generator) loc(loc ast.Location) string {
+	if g.sources == nil {
+		return quote(fmt.Sprintf("%s:%d:%d", loc.Filename, loc.Start, loc.End))
+	}
+	return quote(g.sources.Format(loc))
+}
+
+// quote returns s as a C string literal. Quotes, backslashes, question
+// marks (which could start a trigraph) and non-printable bytes are written as
+// octal escapes, which are always exactly three digits long.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= ' ' && c <= '~' && c != '"' && c != '\\' && c != '?' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "\\%03o", c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// str returns a static Str holding s.
+func (g *generator) str(s string) string {
+	if name, ok := g.strings[s]; ok {
+		return name
+	}
+	name := fmt.Sprintf("str_%d", len(g.strings))
+	g.strings[s] = name
+	fmt.Fprintf(&g.globals, "static const Str %s = {%d, %s};\n", name, len(s), quote(s))
+	return name
+}
+
+// function lowers fn to the body of a C function. Parameters are read from
+// args, and main just evaluates its body.
+func (g *generator) function(fn *closure.Function) *function {
+	g.fn = &function{ir: fn, locals: make([]string, fn.Locals)}
+	for i, param := range fn.Params {
+		g.fn.locals[i] = g.ident(param)
+		g.emit("Value %s = args[%d];", g.fn.locals[i], i)
+	}
+	result := g.term(fn.Body)
+	if fn.Index == 0 {
+		g.emit("(void)%s;", result)
+	} else {
+		g.emit("return %s;", result)
+	}
+	return g.fn
+}
+
+// term writes the statements evaluating e and returns a C expression, free
+// of side effects, holding its value.
+func (g *generator) term(e closure.Expr) string {
+	switch n := e.(type) {
+	case closure.Int:
+		return fmt.Sprintf("rt_int((int32_t)%d)", n.Value)
+	case closure.Str:
+		return fmt.Sprintf("rt_str(&%s)", g.str(n.Value))
+	case closure.Bool:
+		return fmt.Sprintf("rt_bool(%t)", n.Value)
+	case closure.Local:
+		return g.fn.locals[n.Slot]
+	case closure.Capture:
+		return fmt.Sprintf("self->captures[%d]", n.Index)
+	case closure.Self:
+		return "rt_closure_value(self)"
+	case closure.Undefined:
+		return g.bind(fmt.Sprintf("rt_undefined(%s, %s)", g.loc(n.Location), quote(n.Name)))
+	case closure.Let:
+		value := g.term(n.Value)
+		ident := g.ident(n.Name)
+		g.fn.locals[n.Slot] = ident
+		g.emit("Value %s = %s;", ident, value)
+		if n.Next == nil {
+			return ident
+		}
+		return g.term(n.Next)
+	case closure.Closure:
+		return g.bind(g.closure(n))
+	case closure.If:
+		return g.cond(n)
+	case closure.Binary:
+		return g.binary(n)
+	case closure.Call:
+		return g.call(n)
+	case closure.Tuple:
+		first := g.term(n.First)
+		second := g.term(n.Second)
+		return g.bind(fmt.Sprintf("rt_tuple(%s, %s)", first, second))
+	case closure.Print:
+		return g.bind(fmt.Sprintf("rt_print(%s)", g.term(n.Value)))
+	case closure.First:
+		return g.bind(fmt.Sprintf("rt_as_tuple(%s, %s)->first", g.loc(n.Location), g.term(n.Value)))
+	case closure.Second:
+		return g.bind(fmt.Sprintf("rt_as_tuple(%s, %s)->second", g.loc(n.Location), g.term(n.Value)))
+	default:
+		panic(fmt.Sprintf("unexpected expression %T", e))
+	}
+}
+
+// closure returns the expression creating a closure of n.Function.
+func (g *generator) closure(n closure.Closure) string {
+	captures := "NULL"
+	if len(n.Captures) > 0 {
+		exprs := make([]string, len(n.Captures))
+		for i, capture := range n.Captures {
+			exprs[i] = g.term(capture)
+		}
+		captures = fmt.Sprintf("(const Value[]){%s}", strings.Join(exprs, ", "))
+	}
+	fn := n.Function
+	return fmt.Sprintf("rt_closure(fn_%d, %d, %t, %d, %s)", fn.Index, len(fn.Params), g.pure.Pure(fn.Source), len(fn.Captures), captures)
+}
+
+func (g *generator) cond(n closure.If) string {
+	condition := g.term(n.Condition)
+	result := g.temp()
+	g.emit("Value %s;", result)
+	g.emit("if (rt_cond(%s, %s)) {", g.loc(n.Location), condition)
+	g.emit("%s = %s;", result, g.term(n.Then))
+	g.emit("} else {")
+	g.emit("%s = %s;", result, g.term(n.Otherwise))
+	g.emit("}")
+	return result
+}
+
+var binaryFuncs = map[ast.BinaryOp]string{
+	ast.Add: "rt_add",
+	ast.Sub: "rt_sub",
+	ast.Mul: "rt_mul",
+	ast.Div: "rt_div",
+	ast.Rem: "rt_rem",
+}
+
+var comparisons = map[ast.BinaryOp]string{
+	ast.Lt:  "<",
+	ast.Lte: "<=",
+	ast.Gt:  ">",
+	ast.Gte: ">=",
+}
+
+func (g *generator) binary(n closure.Binary) string {
+	left := g.term(n.Lhs)
+	right := g.term(n.Rhs)
+	loc := g.loc(n.Location)
+
+	if fn, ok := binaryFuncs[n.Op]; ok {
+		return g.bind(fmt.Sprintf("%s(%s, %s, %s)", fn, loc, left, right))
+	}
+	if cmp, ok := comparisons[n.Op]; ok {
+		return g.bind(fmt.Sprintf("rt_bool(rt_compare(%s, %q, %s, %s) %s 0)", loc, n.Op, left, right, cmp))
+	}
+	switch n.Op {
+	case ast.Eq:
+		return g.bind(fmt.Sprintf("rt_bool(rt_eq(%s, %q, %s, %s))", loc, n.Op, left, right))
+	case ast.Neq:
+		return g.bind(fmt.Sprintf("rt_bool(!rt_eq(%s, %q, %s, %s))", loc, n.Op, left, right))
+	case ast.And:
+		g.emit("rt_bools(%s, %q, %s, %s);", loc, n.Op, left, right)
+		return g.bind(fmt.Sprintf("rt_bool(%s.as.b && %s.as.b)", left, right))
+	case ast.Or:
+		g.emit("rt_bools(%s, %q, %s, %s);", loc, n.Op, left, right)
+		return g.bind(fmt.Sprintf("rt_bool(%s.as.b || %s.as.b)", left, right))
+	default:
+		g.errorf(n.Location, "unknown binary operator %s", n.Op)
+		return ""
+	}
+}
+
+// call calls the callee with rt_call, or leaves it to the caller with
+// rt_tail when the call is in tail position.
+func (g *generator) call(n closure.Call) string {
+	callee := g.temp()
+	loc, name := g.loc(n.Location), quote(n.Name)
+	g.emit("Closure *%s = rt_callee(%s, %s, %s, %d);", callee, loc, name, g.term(n.Callee), len(n.Args))
+	args := "NULL"
+	if len(n.Args) > 0 {
+		terms := make([]string, len(n.Args))
+		for i, arg := range n.Args {
+			terms[i] = g.term(arg)
+		}
+		args = fmt.Sprintf("(const Value[]){%s}", strings.Join(terms, ", "))
+	}
+	if n.Tail {
+		return g.bind(fmt.Sprintf("rt_tail(%s, %s)", callee, args))
+	}
+	return g.bind(fmt.Sprintf("rt_call(%s, %s, %s, %s)", loc, name, callee, args))
+}
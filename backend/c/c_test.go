@@ -0,0 +1,34 @@
+package c_test
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/backend/c"
+	"github.com/ghhernandes/rinha-compiler-go/backend/internal/backendtest"
+)
+
+// programs are the programs run by this backend besides the shared ones.
+var programs = []backendtest.Program{
+	{Name: "fib", Src: `let fib = fn (n) => { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; print(fib(46))`},
+	{Name: "escapes", Src: `print("quote \" backslash \\ trigraph ??= é")`},
+}
+
+func TestCompiledProgramsMatchInterpreter(t *testing.T) {
+	if c.Compiler() == "" {
+		t.Skip("no C compiler available")
+	}
+
+	tests := append(append(append(append(backendtest.Programs, backendtest.Recursion...), backendtest.Unbound...), programs...), backendtest.Examples(t)...)
+	backendtest.MatchInterpreter(t, tests, func(t *testing.T, file *ast.File, path string) *exec.Cmd {
+		if err := c.Build(file, nil, path); err != nil {
+			t.Fatal(err)
+		}
+		return exec.Command(path)
+	})
+}
+
+func TestGenerateErrors(t *testing.T) {
+	backendtest.GenerateErrors(t, c.Generate)
+}
@@ -0,0 +1,531 @@
+package c
+
+// runtime is the C runtime prepended to every generated program. Values are
+// tagged unions; strings, tuples and closures live on the heap and are never
+// freed. Operations check their operands like interpreter.Binary does and
+// report the same messages, and calls nest as deep as in the interpreter.
+const runtime = `#include <inttypes.h>
+#include <pthread.h>
+#include <stdarg.h>
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+/* RT_TAIL is returned by a function ending with a call, which is left in
+   rt_next for its caller to make. Programs never see it. */
+typedef enum { RT_INT, RT_STR, RT_BOOL, RT_TUPLE, RT_CLOSURE, RT_TAIL } Tag;
+
+typedef struct Str Str;
+typedef struct Tuple Tuple;
+typedef struct Closure Closure;
+typedef struct Memo Memo;
+
+typedef struct {
+	Tag tag;
+	union {
+		int32_t i;
+		bool b;
+		const Str *s;
+		const Tuple *t;
+		Closure *c;
+	} as;
+} Value;
+
+struct Str {
+	size_t len;
+	const char *data;
+};
+
+struct Tuple {
+	Value first;
+	Value second;
+};
+
+typedef Value (*Fn)(Closure *self, const Value *args);
+
+struct Closure {
+	Fn fn;
+	int arity;
+	/* memo holds the results of calls to pure functions, or is NULL. */
+	Memo *memo;
+	int ncaptures;
+	Value captures[];
+};
+
+static const char *rt_kinds[] = {"Int", "Str", "Bool", "Tuple", "Closure"};
+
+static void rt_fail(const char *loc, const char *format, ...);
+
+static void *rt_alloc(size_t size) {
+	void *p = malloc(size);
+	if (p == NULL) {
+		fputs("error: out of memory\n", stderr);
+		exit(1);
+	}
+	return p;
+}
+
+static Value rt_int(int32_t i) {
+	Value v = {RT_INT, {.i = i}};
+	return v;
+}
+
+static Value rt_bool(bool b) {
+	Value v = {RT_BOOL, {.b = b}};
+	return v;
+}
+
+static Value rt_str(const Str *s) {
+	Value v = {RT_STR, {.s = s}};
+	return v;
+}
+
+static Value rt_tuple(Value first, Value second) {
+	Tuple *t = rt_alloc(sizeof(Tuple));
+	t->first = first;
+	t->second = second;
+	Value v = {RT_TUPLE, {.t = t}};
+	return v;
+}
+
+static Value rt_closure_value(Closure *c) {
+	Value v = {RT_CLOSURE, {.c = c}};
+	return v;
+}
+
+static Memo *rt_memo_new(void);
+
+static Value rt_closure(Fn fn, int arity, bool pure, int ncaptures, const Value *captures) {
+	Closure *c = rt_alloc(sizeof(Closure) + ncaptures * sizeof(Value));
+	c->fn = fn;
+	c->arity = arity;
+	c->memo = pure ? rt_memo_new() : NULL;
+	c->ncaptures = ncaptures;
+	if (ncaptures > 0) {
+		memcpy(c->captures, captures, ncaptures * sizeof(Value));
+	}
+	return rt_closure_value(c);
+}
+
+/* Output */
+
+static void rt_write(Value v) {
+	char buf[16];
+	switch (v.tag) {
+	case RT_INT:
+		snprintf(buf, sizeof buf, "%" PRId32, v.as.i);
+		fputs(buf, stdout);
+		break;
+	case RT_STR:
+		fwrite(v.as.s->data, 1, v.as.s->len, stdout);
+		break;
+	case RT_BOOL:
+		fputs(v.as.b ? "true" : "false", stdout);
+		break;
+	case RT_TUPLE:
+		fputc('(', stdout);
+		rt_write(v.as.t->first);
+		fputs(", ", stdout);
+		rt_write(v.as.t->second);
+		fputc(')', stdout);
+		break;
+	case RT_CLOSURE:
+		fputs("<#closure>", stdout);
+		break;
+	}
+}
+
+static Value rt_print(Value v) {
+	rt_write(v);
+	fputc('\n', stdout);
+	return v;
+}
+
+static void rt_fail(const char *loc, const char *format, ...) {
+	va_list args;
+	fflush(stdout);
+	fputs("error: ", stderr);
+	va_start(args, format);
+	vfprintf(stderr, format, args);
+	va_end(args);
+	fprintf(stderr, "\n --> %s\n", loc);
+	exit(1);
+}
+
+/* Operators */
+
+static void rt_mismatch(const char *loc, const char *op, Value l, Value r) {
+	rt_fail(loc, "invalid operands for %s: %s and %s", op, rt_kinds[l.tag], rt_kinds[r.tag]);
+}
+
+static void rt_ints(const char *loc, const char *op, Value l, Value r) {
+	if (l.tag != RT_INT || r.tag != RT_INT) {
+		rt_mismatch(loc, op, l, r);
+	}
+}
+
+/* Arithmetic wraps around like Go's int32, which C leaves undefined for
+   signed integers, so it is done on unsigned ones. */
+static int32_t rt_wrap(uint32_t i) {
+	return (int32_t)i;
+}
+
+static const Str *rt_to_str(Value v) {
+	if (v.tag == RT_STR) {
+		return v.as.s;
+	}
+	char buf[16];
+	int n = snprintf(buf, sizeof buf, "%" PRId32, v.as.i);
+	Str *s = rt_alloc(sizeof(Str) + n);
+	char *data = (char *)(s + 1);
+	memcpy(data, buf, n);
+	s->len = n;
+	s->data = data;
+	return s;
+}
+
+static Value rt_concat(const Str *a, const Str *b) {
+	Str *s = rt_alloc(sizeof(Str) + a->len + b->len);
+	char *data = (char *)(s + 1);
+	memcpy(data, a->data, a->len);
+	memcpy(data + a->len, b->data, b->len);
+	s->len = a->len + b->len;
+	s->data = data;
+	return rt_str(s);
+}
+
+/* rt_add follows interpreter.add: Int + Int is an Int, and any other mix of
+   Int and Str concatenates. */
+static Value rt_add(const char *loc, Value l, Value r) {
+	if (l.tag == RT_INT && r.tag == RT_INT) {
+		return rt_int(rt_wrap((uint32_t)l.as.i + (uint32_t)r.as.i));
+	}
+	if ((l.tag == RT_INT || l.tag == RT_STR) && (r.tag == RT_INT || r.tag == RT_STR)) {
+		return rt_concat(rt_to_str(l), rt_to_str(r));
+	}
+	rt_mismatch(loc, "Add", l, r);
+	return l;
+}
+
+static Value rt_sub(const char *loc, Value l, Value r) {
+	rt_ints(loc, "Sub", l, r);
+	return rt_int(rt_wrap((uint32_t)l.as.i - (uint32_t)r.as.i));
+}
+
+static Value rt_mul(const char *loc, Value l, Value r) {
+	rt_ints(loc, "Mul", l, r);
+	return rt_int(rt_wrap((uint32_t)l.as.i * (uint32_t)r.as.i));
+}
+
+static Value rt_div(const char *loc, Value l, Value r) {
+	rt_ints(loc, "Div", l, r);
+	if (r.as.i == 0) {
+		rt_fail(loc, "division by zero");
+	}
+	if (r.as.i == -1) {
+		return rt_int(rt_wrap(-(uint32_t)l.as.i));
+	}
+	return rt_int(l.as.i / r.as.i);
+}
+
+static Value rt_rem(const char *loc, Value l, Value r) {
+	rt_ints(loc, "Rem", l, r);
+	if (r.as.i == 0) {
+		rt_fail(loc, "division by zero");
+	}
+	if (r.as.i == -1) {
+		return rt_int(0);
+	}
+	return rt_int(l.as.i % r.as.i);
+}
+
+static int rt_strcmp(const Str *a, const Str *b) {
+	size_t n = a->len < b->len ? a->len : b->len;
+	int c = memcmp(a->data, b->data, n);
+	if (c != 0) {
+		return c < 0 ? -1 : 1;
+	}
+	if (a->len != b->len) {
+		return a->len < b->len ? -1 : 1;
+	}
+	return 0;
+}
+
+static bool rt_eq(const char *loc, const char *op, Value l, Value r) {
+	if (l.tag == r.tag) {
+		switch (l.tag) {
+		case RT_INT:
+			return l.as.i == r.as.i;
+		case RT_STR:
+			return rt_strcmp(l.as.s, r.as.s) == 0;
+		case RT_BOOL:
+			return l.as.b == r.as.b;
+		default:
+			break;
+		}
+	}
+	rt_mismatch(loc, op, l, r);
+	return false;
+}
+
+static int rt_compare(const char *loc, const char *op, Value l, Value r) {
+	if (l.tag == RT_INT && r.tag == RT_INT) {
+		return l.as.i < r.as.i ? -1 : l.as.i > r.as.i;
+	}
+	if (l.tag == RT_STR && r.tag == RT_STR) {
+		return rt_strcmp(l.as.s, r.as.s);
+	}
+	rt_mismatch(loc, op, l, r);
+	return 0;
+}
+
+static void rt_bools(const char *loc, const char *op, Value l, Value r) {
+	if (l.tag != RT_BOOL || r.tag != RT_BOOL) {
+		rt_mismatch(loc, op, l, r);
+	}
+}
+
+static bool rt_cond(const char *loc, Value v) {
+	if (v.tag != RT_BOOL) {
+		rt_fail(loc, "condition must be a Bool");
+	}
+	return v.as.b;
+}
+
+static const Tuple *rt_as_tuple(const char *loc, Value v) {
+	if (v.tag != RT_TUPLE) {
+		rt_fail(loc, "not a tuple");
+	}
+	return v.as.t;
+}
+
+/* rt_undefined fails on reading a variable bound nowhere, which is only an
+   error once it is evaluated. */
+static Value rt_undefined(const char *loc, const char *name) {
+	rt_fail(loc, "undefined variable %s", name);
+	return rt_int(0);
+}
+
+/* Calls */
+
+/* rt_callee checks a call before its arguments are evaluated. */
+static Closure *rt_callee(const char *loc, const char *name, Value callee, int argc) {
+	if (callee.tag != RT_CLOSURE) {
+		rt_fail(loc, "cannot call a %s", rt_kinds[callee.tag]);
+	}
+	Closure *c = callee.as.c;
+	if (c->arity != argc) {
+		rt_fail(loc, "wrong number of arguments: %s expects %d, got %d", name, c->arity, argc);
+	}
+	return c;
+}
+
+/* Memoization: an open addressing table per closure, keyed on arguments.
+   Strings compare by content; tuples and closures by identity. */
+
+typedef struct {
+	uint64_t hash;
+	Value *args;
+	Value result;
+} Entry;
+
+struct Memo {
+	Entry *entries;
+	size_t cap;
+	size_t len;
+};
+
+static Memo *rt_memo_new(void) {
+	Memo *m = rt_alloc(sizeof(Memo));
+	m->cap = 16;
+	m->len = 0;
+	m->entries = rt_alloc(m->cap * sizeof(Entry));
+	memset(m->entries, 0, m->cap * sizeof(Entry));
+	return m;
+}
+
+static uint64_t rt_mix(uint64_t h, uint64_t x) {
+	h ^= x;
+	h *= 1099511628211ULL;
+	h ^= h >> 32;
+	return h;
+}
+
+static uint64_t rt_hash(const Value *args, int argc) {
+	uint64_t h = 14695981039346656037ULL;
+	for (int i = 0; i < argc; i++) {
+		Value v = args[i];
+		h = rt_mix(h, v.tag);
+		switch (v.tag) {
+		case RT_INT:
+			h = rt_mix(h, (uint32_t)v.as.i);
+			break;
+		case RT_BOOL:
+			h = rt_mix(h, v.as.b);
+			break;
+		case RT_STR:
+			for (size_t j = 0; j < v.as.s->len; j++) {
+				h = rt_mix(h, (unsigned char)v.as.s->data[j]);
+			}
+			break;
+		case RT_TUPLE:
+			h = rt_mix(h, (uint64_t)(uintptr_t)v.as.t);
+			break;
+		case RT_CLOSURE:
+			h = rt_mix(h, (uint64_t)(uintptr_t)v.as.c);
+			break;
+		}
+	}
+	return h | 1;
+}
+
+static bool rt_same(const Value *a, const Value *b, int argc) {
+	for (int i = 0; i < argc; i++) {
+		if (a[i].tag != b[i].tag) {
+			return false;
+		}
+		switch (a[i].tag) {
+		case RT_INT:
+			if (a[i].as.i != b[i].as.i) return false;
+			break;
+		case RT_BOOL:
+			if (a[i].as.b != b[i].as.b) return false;
+			break;
+		case RT_STR:
+			if (rt_strcmp(a[i].as.s, b[i].as.s) != 0) return false;
+			break;
+		case RT_TUPLE:
+			if (a[i].as.t != b[i].as.t) return false;
+			break;
+		case RT_CLOSURE:
+			if (a[i].as.c != b[i].as.c) return false;
+			break;
+		}
+	}
+	return true;
+}
+
+static Entry *rt_memo_find(Memo *m, uint64_t hash, const Value *args, int argc) {
+	size_t i = hash & (m->cap - 1);
+	for (;;) {
+		Entry *e = &m->entries[i];
+		if (e->hash == 0 || (e->hash == hash && rt_same(e->args, args, argc))) {
+			return e;
+		}
+		i = (i + 1) & (m->cap - 1);
+	}
+}
+
+static void rt_memo_grow(Memo *m, int argc) {
+	Entry *old = m->entries;
+	size_t cap = m->cap;
+	m->cap *= 2;
+	m->entries = rt_alloc(m->cap * sizeof(Entry));
+	memset(m->entries, 0, m->cap * sizeof(Entry));
+	for (size_t i = 0; i < cap; i++) {
+		if (old[i].hash != 0) {
+			*rt_memo_find(m, old[i].hash, old[i].args, argc) = old[i];
+		}
+	}
+	free(old);
+}
+
+/* rt_memo_get returns the memoized result of calling c with args, if any. */
+static bool rt_memo_get(Closure *c, const Value *args, Value *result) {
+	if (c->memo == NULL) {
+		return false;
+	}
+	Entry *e = rt_memo_find(c->memo, rt_hash(args, c->arity), args, c->arity);
+	if (e->hash == 0) {
+		return false;
+	}
+	*result = e->result;
+	return true;
+}
+
+static void rt_memo_put(Closure *c, const Value *args, Value result) {
+	Memo *m = c->memo;
+	uint64_t hash = rt_hash(args, c->arity);
+	if (2 * (m->len + 1) > m->cap) {
+		rt_memo_grow(m, c->arity);
+	}
+	Entry *e = rt_memo_find(m, hash, args, c->arity);
+	e->hash = hash;
+	e->args = rt_alloc(c->arity * sizeof(Value) + 1);
+	memcpy(e->args, args, c->arity * sizeof(Value));
+	e->result = result;
+	m->len++;
+}
+
+/* Tail calls are not made by the function ending with them: it leaves the
+   callee and its arguments in rt_next and returns RT_TAIL, and rt_call
+   makes the call instead, so a loop of tail calls runs in constant stack. */
+
+static Closure *rt_next;
+static Value *rt_next_args;
+static int rt_next_cap;
+
+static Value rt_tail(Closure *c, const Value *args) {
+	if (c->arity > rt_next_cap) {
+		rt_next_cap = c->arity;
+		free(rt_next_args);
+		rt_next_args = rt_alloc(rt_next_cap * sizeof(Value));
+	}
+	memcpy(rt_next_args, args, c->arity * sizeof(Value));
+	rt_next = c;
+	Value v = {RT_TAIL, {.i = 0}};
+	return v;
+}
+
+#define RT_MAX_DEPTH 100000
+
+static int rt_depth;
+
+/* rt_call calls c, and every call it ends with, like the interpreter does:
+   the chain stops at the first memoized call, and only the result of c is
+   memoized. Functions read their arguments before making any call, so the
+   arguments of tail calls need no copy. */
+static Value rt_call(const char *loc, const char *name, Closure *c, const Value *args) {
+	Value result;
+	if (rt_memo_get(c, args, &result)) {
+		return result;
+	}
+	if (rt_depth >= RT_MAX_DEPTH) {
+		rt_fail(loc, "stack overflow: calls to %s nested more than %d deep", name, RT_MAX_DEPTH);
+	}
+	rt_depth++;
+	result = c->fn(c, args);
+	while (result.tag == RT_TAIL) {
+		Closure *next = rt_next;
+		if (rt_memo_get(next, rt_next_args, &result)) {
+			break;
+		}
+		result = next->fn(next, rt_next_args);
+	}
+	rt_depth--;
+
+	if (c->memo != NULL) {
+		rt_memo_put(c, args, result);
+	}
+	return result;
+}
+
+/* RT_STACK_SIZE is the stack of the thread running the program, enough for
+   RT_MAX_DEPTH nested calls. Only the pages it uses are allocated. */
+#define RT_STACK_SIZE ((size_t)1 << 30)
+
+/* rt_start runs main on a thread with a stack of RT_STACK_SIZE, or on the
+   main thread when it cannot be created. */
+static void rt_start(void *(*main)(void *)) {
+	pthread_attr_t attr;
+	pthread_t thread;
+	if (pthread_attr_init(&attr) == 0 && pthread_attr_setstacksize(&attr, RT_STACK_SIZE) == 0 &&
+		pthread_create(&thread, &attr, main, NULL) == 0) {
+		pthread_join(thread, NULL);
+		return;
+	}
+	main(NULL);
+}
+`
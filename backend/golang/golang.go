@@ -0,0 +1,337 @@
+// Package golang translates Rinha programs into standalone Go programs.
+package golang
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/diag"
+	"github.com/ghhernandes/rinha-compiler-go/purity"
+)
+
+type scope struct {
+	parent *scope
+	name   string
+	ident  string
+}
+
+func (s *scope) lookup(name string) (string, bool) {
+	for ; s != nil; s = s.parent {
+		if s.name == name {
+			return s.ident, true
+		}
+	}
+	return "", false
+}
+
+type generator struct {
+	sources *diag.SourceMap
+	pure    purity.Set
+	b       bytes.Buffer
+	scope   *scope
+	idents  int
+}
+
+// Generate writes a Go program that behaves like running f with the
+// interpreter: it prints the same output and fails with the same runtime
+// errors. Locations in errors are rendered with sources when it is not nil.
+// Calls to pure functions are memoized, as the interpreter does.
+func Generate(w io.Writer, f *ast.File, sources *diag.SourceMap) (err error) {
+	g := &generator{sources: sources, pure: purity.Analyze(f.Expression)}
+
+	defer func() {
+		if r := recover(); r != nil {
+			gerr, ok := r.(*ast.Error)
+			if !ok {
+				panic(r)
+			}
+			err = gerr
+		}
+	}()
+
+	fmt.Fprintf(&g.b, "// Code generated by rinha build --target=go from %s. DO NOT EDIT.\n\n", f.Name)
+	g.b.WriteString("package main\n\n")
+	g.b.WriteString("import (\n\"bufio\"\n\"fmt\"\n\"os\"\n\"strconv\"\n\"strings\"\n)\n\n")
+	g.b.WriteString("func main() {\ndefer rtRecover()\n")
+	result := g.term(f.Expression)
+	fmt.Fprintf(&g.b, "_ = %s\n}\n", result)
+	g.b.WriteString(runtime)
+
+	src, err := format.Source(g.b.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting generated code: %w", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// Build generates the Go program for f and compiles it with `go build` into
+// the executable output.
+func Build(f *ast.File, sources *diag.SourceMap, output string) error {
+	dir, err := os.MkdirTemp("", "rinha-go")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	var src bytes.Buffer
+	if err := Generate(&src, f, sources); err != nil {
+		return err
+	}
+	main := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(main, src.Bytes(), 0o644); err != nil {
+		return err
+	}
+
+	output, err = filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("go", "build", "-o", output, main)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("go build: %w\n%s", err, out)
+	}
+	return nil
+}
+
+func (g *generator) errorf(loc ast.Location, format string, args ...any) {
+	panic(ast.Errorf(loc, format, args...))
+}
+
+// ident returns a fresh Go identifier for name. Rinha names are prefixed so
+// they never clash with Go keywords or the runtime.
+func (g *generator) ident(name string) string {
+	g.idents++
+	return fmt.Sprintf("v_%s_%d", name, g.idents)
+}
+
+func (g *generator) temp() string {
+	g.idents++
+	return fmt.Sprintf("t%d", g.idents)
+}
+
+func (g *generator) loc(loc ast.Location) string {
+	if g.sources == nil {
+		return strconv.Quote(fmt.Sprintf("%s:%d:%d", loc.Filename, loc.Start, loc.End))
+	}
+	return strconv.Quote(g.sources.Format(loc))
+}
+
+// bind assigns expr to a new temporary and returns it, so that terms are
+// evaluated in the order the interpreter evaluates them.
+func (g *generator) bind(expr string) string {
+	t := g.temp()
+	fmt.Fprintf(&g.b, "var %s Value = %s\n", t, expr)
+	return t
+}
+
+// term writes the statements evaluating node and returns a Go expression,
+// free of side effects, holding its value.
+func (g *generator) term(node ast.Term) string {
+	switch n := node.(type) {
+	case ast.Int:
+		return fmt.Sprintf("Value(int32(%d))", n.Value)
+	case ast.Str:
+		return fmt.Sprintf("Value(%s)", strconv.Quote(n.Value))
+	case ast.Bool:
+		return fmt.Sprintf("Value(%t)", n.Value)
+	case ast.Var:
+		ident, ok := g.scope.lookup(n.Text)
+		if !ok {
+			return g.bind(fmt.Sprintf("rtUndefined(%s, %s)", g.loc(n.Location), strconv.Quote(n.Text)))
+		}
+		return ident
+	case ast.Let:
+		return g.let(n, false)
+	case ast.Function:
+		return g.bind(g.function(n, ""))
+	case ast.If:
+		return g.cond(n, false)
+	case ast.Binary:
+		return g.binary(n)
+	case ast.Call:
+		return g.call(n, false)
+	case ast.Tuple:
+		first := g.term(n.First)
+		second := g.term(n.Second)
+		return g.bind(fmt.Sprintf("&Tuple{First: %s, Second: %s}", first, second))
+	case ast.Print:
+		return g.bind(fmt.Sprintf("rtPrint(%s)", g.term(n.Value)))
+	case ast.First:
+		return g.bind(fmt.Sprintf("rtTuple(%s, %s).First", g.loc(n.Location), g.term(n.Value)))
+	case ast.Second:
+		return g.bind(fmt.Sprintf("rtTuple(%s, %s).Second", g.loc(n.Location), g.term(n.Value)))
+	default:
+		g.errorf(ast.LocationOf(node), "unsupported term %T", node)
+		return ""
+	}
+}
+
+// tail is term for the result of a function: calls whose result is that of
+// the function return a *tailCall for rtCall to make instead, so chains of
+// them run without growing the stack.
+func (g *generator) tail(node ast.Term) string {
+	switch n := node.(type) {
+	case ast.Let:
+		return g.let(n, true)
+	case ast.If:
+		return g.cond(n, true)
+	case ast.Call:
+		return g.call(n, true)
+	default:
+		return g.term(node)
+	}
+}
+
+func (g *generator) let(n ast.Let, tail bool) string {
+	outer := g.scope
+	ident := g.ident(n.Name.Text)
+
+	if fn, ok := n.Value.(ast.Function); ok {
+		// The binding is declared first so the function can call itself.
+		fmt.Fprintf(&g.b, "var %s Value\n", ident)
+		g.scope = &scope{parent: outer, name: n.Name.Text, ident: ident}
+		fmt.Fprintf(&g.b, "%s = %s\n", ident, g.function(fn, n.Name.Text))
+	} else {
+		value := g.term(n.Value)
+		fmt.Fprintf(&g.b, "var %s Value = %s\n", ident, value)
+		g.scope = &scope{parent: outer, name: n.Name.Text, ident: ident}
+	}
+	fmt.Fprintf(&g.b, "_ = %s\n", ident)
+
+	if n.Next == nil {
+		g.scope = outer
+		return ident
+	}
+	var result string
+	if tail {
+		result = g.tail(n.Next)
+	} else {
+		result = g.term(n.Next)
+	}
+	g.scope = outer
+	return result
+}
+
+// function returns an expression creating a closure for fn. Pure functions
+// get a memoization table per closure, keyed on their arguments, holding
+// the results they compute themselves rather than leave to a tail call.
+func (g *generator) function(fn ast.Function, name string) string {
+	var (
+		outer = g.b
+		saved = g.scope
+		arity = len(fn.Parameters)
+		memo  = g.pure.Pure(fn)
+	)
+	g.b = bytes.Buffer{}
+
+	for i, param := range fn.Parameters {
+		ident := g.ident(param.Text)
+		fmt.Fprintf(&g.b, "%s := args[%d]\n_ = %s\n", ident, i, ident)
+		g.scope = &scope{parent: g.scope, name: param.Text, ident: ident}
+	}
+	result := g.tail(fn.Value)
+	body := g.b.String()
+	g.b, g.scope = outer, saved
+
+	var b strings.Builder
+	if !memo {
+		fmt.Fprintf(&b, "&Closure{Arity: %d, Fn: func(args []Value) Value {\n%sreturn %s\n}}", arity, body, result)
+		return b.String()
+	}
+
+	keys := make([]string, arity)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("args[%d]", i)
+	}
+	fmt.Fprintf(&b, "func() *Closure {\nmemo := make(map[[%d]Value]Value)\n", arity)
+	fmt.Fprintf(&b, "return &Closure{Arity: %d, Fn: func(args []Value) Value {\n", arity)
+	fmt.Fprintf(&b, "key := [%d]Value{%s}\n", arity, strings.Join(keys, ", "))
+	b.WriteString("if v, ok := memo[key]; ok {\nreturn v\n}\n")
+	fmt.Fprintf(&b, "%sif _, ok := %s.(*tailCall); !ok {\nmemo[key] = %s\n}\nreturn %s\n}}\n}()", body, result, result, result)
+	return b.String()
+}
+
+func (g *generator) cond(n ast.If, tail bool) string {
+	branch := g.term
+	if tail {
+		branch = g.tail
+	}
+	condition := g.term(n.Condition)
+	result := g.temp()
+	fmt.Fprintf(&g.b, "var %s Value\n", result)
+	fmt.Fprintf(&g.b, "if rtCond(%s, %s) {\n", g.loc(n.Location), condition)
+	fmt.Fprintf(&g.b, "%s = %s\n", result, branch(n.Then))
+	g.b.WriteString("} else {\n")
+	fmt.Fprintf(&g.b, "%s = %s\n", result, branch(n.Otherwise))
+	g.b.WriteString("}\n")
+	return result
+}
+
+func (g *generator) binary(n ast.Binary) string {
+	left := g.term(n.Lhs)
+	right := g.term(n.Rhs)
+	loc := g.loc(n.Location)
+
+	switch n.Op {
+	case ast.Add:
+		return g.bind(fmt.Sprintf("rtAdd(%s, %s, %s)", loc, left, right))
+	case ast.Sub:
+		return g.bind(fmt.Sprintf("rtSub(%s, %s, %s)", loc, left, right))
+	case ast.Mul:
+		return g.bind(fmt.Sprintf("rtMul(%s, %s, %s)", loc, left, right))
+	case ast.Div:
+		return g.bind(fmt.Sprintf("rtDiv(%s, %s, %s)", loc, left, right))
+	case ast.Rem:
+		return g.bind(fmt.Sprintf("rtRem(%s, %s, %s)", loc, left, right))
+	case ast.Eq:
+		return g.bind(fmt.Sprintf("rtEq(%s, %q, %s, %s)", loc, n.Op, left, right))
+	case ast.Neq:
+		return g.bind(fmt.Sprintf("!rtEq(%s, %q, %s, %s)", loc, n.Op, left, right))
+	case ast.Lt:
+		return g.bind(fmt.Sprintf("rtCompare(%s, %q, %s, %s) < 0", loc, n.Op, left, right))
+	case ast.Lte:
+		return g.bind(fmt.Sprintf("rtCompare(%s, %q, %s, %s) <= 0", loc, n.Op, left, right))
+	case ast.Gt:
+		return g.bind(fmt.Sprintf("rtCompare(%s, %q, %s, %s) > 0", loc, n.Op, left, right))
+	case ast.Gte:
+		return g.bind(fmt.Sprintf("rtCompare(%s, %q, %s, %s) >= 0", loc, n.Op, left, right))
+	case ast.And:
+		return g.bind(fmt.Sprintf("func() bool { a, b := rtBools(%s, %q, %s, %s); return a && b }()", loc, n.Op, left, right))
+	case ast.Or:
+		return g.bind(fmt.Sprintf("func() bool { a, b := rtBools(%s, %q, %s, %s); return a || b }()", loc, n.Op, left, right))
+	default:
+		g.errorf(n.Location, "unknown binary operator %s", n.Op)
+		return ""
+	}
+}
+
+// call makes a call with rtCall, or returns a *tailCall for the caller to
+// make when tail is set.
+func (g *generator) call(n ast.Call, tail bool) string {
+	name := "<anonymous>"
+	if v, ok := n.Callee.(ast.Var); ok {
+		name = v.Text
+	}
+
+	callee := g.temp()
+	loc := g.loc(n.Location)
+	fmt.Fprintf(&g.b, "%s := rtCallee(%s, %q, %s, %d)\n", callee, loc, name, g.term(n.Callee), len(n.Arguments))
+	args := make([]string, len(n.Arguments))
+	for i, arg := range n.Arguments {
+		args[i] = g.term(arg)
+	}
+	if tail {
+		return g.bind(fmt.Sprintf("Value(&tailCall{%s, []Value{%s}})", callee, strings.Join(args, ", ")))
+	}
+	return g.bind(fmt.Sprintf("rtCall(%s, %q, %s, []Value{%s})", loc, name, callee, strings.Join(args, ", ")))
+}
@@ -0,0 +1,33 @@
+package golang_test
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/backend/golang"
+	"github.com/ghhernandes/rinha-compiler-go/backend/internal/backendtest"
+)
+
+// programs are the programs run by this backend besides the shared ones.
+var programs = []backendtest.Program{
+	{Name: "fib", Src: `let fib = fn (n) => { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; print(fib(46))`},
+}
+
+func TestGeneratedProgramsMatchInterpreter(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+
+	tests := append(append(append(append(backendtest.Programs, backendtest.Recursion...), backendtest.Unbound...), programs...), backendtest.Examples(t)...)
+	backendtest.MatchInterpreter(t, tests, func(t *testing.T, file *ast.File, path string) *exec.Cmd {
+		if err := golang.Build(file, nil, path); err != nil {
+			t.Fatal(err)
+		}
+		return exec.Command(path)
+	})
+}
+
+func TestGenerateErrors(t *testing.T) {
+	backendtest.GenerateErrors(t, golang.Generate)
+}
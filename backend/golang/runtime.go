@@ -0,0 +1,254 @@
+package golang
+
+// runtime is appended to every generated program. It mirrors the values and
+// errors of the interpreter: Int is int32, tuples and closures are pointers
+// so they can be used as memoization keys, every operation checks its
+// operands the same way interpreter.Binary does, and calls nest as deep as
+// in the interpreter.
+const runtime = `
+type Value = any
+
+type Tuple struct {
+	First  Value
+	Second Value
+}
+
+type Closure struct {
+	Arity int
+	Fn    func(args []Value) Value
+}
+
+var out = bufio.NewWriterSize(os.Stdout, 1<<16)
+
+type rtError struct {
+	msg string
+	loc string
+}
+
+func rtFail(loc, format string, args ...any) {
+	panic(&rtError{msg: fmt.Sprintf(format, args...), loc: loc})
+}
+
+func rtRecover() {
+	r := recover()
+	out.Flush()
+	if r == nil {
+		return
+	}
+	e, ok := r.(*rtError)
+	if !ok {
+		panic(r)
+	}
+	fmt.Fprintf(os.Stderr, "error: %s\n --> %s\n", e.msg, e.loc)
+	os.Exit(1)
+}
+
+func rtKind(v Value) string {
+	switch v.(type) {
+	case int32:
+		return "Int"
+	case string:
+		return "Str"
+	case bool:
+		return "Bool"
+	case *Tuple:
+		return "Tuple"
+	case *Closure:
+		return "Closure"
+	}
+	return "nil"
+}
+
+func rtString(v Value) string {
+	switch n := v.(type) {
+	case int32:
+		return strconv.FormatInt(int64(n), 10)
+	case string:
+		return n
+	case bool:
+		return strconv.FormatBool(n)
+	case *Tuple:
+		return "(" + rtString(n.First) + ", " + rtString(n.Second) + ")"
+	case *Closure:
+		return "<#closure>"
+	}
+	return ""
+}
+
+func rtPrint(v Value) Value {
+	out.WriteString(rtString(v))
+	out.WriteByte('\n')
+	return v
+}
+
+func rtMismatch(loc, op string, l, r Value) {
+	rtFail(loc, "invalid operands for %s: %s and %s", op, rtKind(l), rtKind(r))
+}
+
+func rtInts(loc, op string, l, r Value) (int32, int32) {
+	a, lok := l.(int32)
+	b, rok := r.(int32)
+	if !lok || !rok {
+		rtMismatch(loc, op, l, r)
+	}
+	return a, b
+}
+
+func rtBools(loc, op string, l, r Value) (bool, bool) {
+	a, lok := l.(bool)
+	b, rok := r.(bool)
+	if !lok || !rok {
+		rtMismatch(loc, op, l, r)
+	}
+	return a, b
+}
+
+func rtAdd(loc string, l, r Value) Value {
+	switch a := l.(type) {
+	case int32:
+		switch b := r.(type) {
+		case int32:
+			return a + b
+		case string:
+			return rtString(a) + b
+		}
+	case string:
+		switch r.(type) {
+		case int32, string:
+			return a + rtString(r)
+		}
+	}
+	rtMismatch(loc, "Add", l, r)
+	return nil
+}
+
+func rtSub(loc string, l, r Value) Value {
+	a, b := rtInts(loc, "Sub", l, r)
+	return a - b
+}
+
+func rtMul(loc string, l, r Value) Value {
+	a, b := rtInts(loc, "Mul", l, r)
+	return a * b
+}
+
+func rtDiv(loc string, l, r Value) Value {
+	a, b := rtInts(loc, "Div", l, r)
+	if b == 0 {
+		rtFail(loc, "division by zero")
+	}
+	return a / b
+}
+
+func rtRem(loc string, l, r Value) Value {
+	a, b := rtInts(loc, "Rem", l, r)
+	if b == 0 {
+		rtFail(loc, "division by zero")
+	}
+	return a % b
+}
+
+func rtEq(loc, op string, l, r Value) bool {
+	switch a := l.(type) {
+	case int32:
+		if b, ok := r.(int32); ok {
+			return a == b
+		}
+	case string:
+		if b, ok := r.(string); ok {
+			return a == b
+		}
+	case bool:
+		if b, ok := r.(bool); ok {
+			return a == b
+		}
+	}
+	rtMismatch(loc, op, l, r)
+	return false
+}
+
+func rtCompare(loc, op string, l, r Value) int {
+	switch a := l.(type) {
+	case int32:
+		if b, ok := r.(int32); ok {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+			return 0
+		}
+	case string:
+		if b, ok := r.(string); ok {
+			return strings.Compare(a, b)
+		}
+	}
+	rtMismatch(loc, op, l, r)
+	return 0
+}
+
+func rtCond(loc string, v Value) bool {
+	b, ok := v.(bool)
+	if !ok {
+		rtFail(loc, "condition must be a Bool")
+	}
+	return b
+}
+
+// rtUndefined fails on reading a variable bound nowhere, which is only an
+// error once it is evaluated.
+func rtUndefined(loc, name string) Value {
+	rtFail(loc, "undefined variable %s", name)
+	return nil
+}
+
+// rtCallee checks a call before its arguments are evaluated.
+func rtCallee(loc, name string, callee Value, argc int) *Closure {
+	c, ok := callee.(*Closure)
+	if !ok {
+		rtFail(loc, "cannot call a %s", rtKind(callee))
+	}
+	if c.Arity != argc {
+		rtFail(loc, "wrong number of arguments: %s expects %d, got %d", name, c.Arity, argc)
+	}
+	return c
+}
+
+func rtTuple(loc string, v Value) *Tuple {
+	t, ok := v.(*Tuple)
+	if !ok {
+		rtFail(loc, "not a tuple")
+	}
+	return t
+}
+
+// tailCall is returned by a function ending with a call, for rtCall to
+// make. Programs never see it.
+type tailCall struct {
+	c    *Closure
+	args []Value
+}
+
+const rtMaxDepth = 100000
+
+var rtDepth int
+
+// rtCall calls c, and every call it ends with, in a loop.
+func rtCall(loc, name string, c *Closure, args []Value) Value {
+	if rtDepth >= rtMaxDepth {
+		rtFail(loc, "stack overflow: calls to %s nested more than %d deep", name, rtMaxDepth)
+	}
+	rtDepth++
+	v := c.Fn(args)
+	for {
+		t, ok := v.(*tailCall)
+		if !ok {
+			break
+		}
+		v = t.c.Fn(t.args)
+	}
+	rtDepth--
+	return v
+}
+`
@@ -0,0 +1,160 @@
+// Package backendtest holds what the tests of the code generation backends
+// share: the programs they run, the check that a compiled program behaves
+// like the interpreter and the check of the errors found generating it.
+package backendtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/diag"
+	"github.com/ghhernandes/rinha-compiler-go/interpreter"
+	"github.com/ghhernandes/rinha-compiler-go/parser"
+	"github.com/ghhernandes/rinha-compiler-go/runtime"
+)
+
+type Program struct {
+	Name string
+	Src  string
+}
+
+// Programs are run by the tests of every backend, which add their own.
+var Programs = []Program{
+	{"closure", `let add = fn (a) => { fn (b) => { a + b } }; let inc = add(1); print(inc(41))`},
+	{"shadowing", `let x = 1; let f = fn (x) => { x * 2 }; let x = 5; print(f(x) + x)`},
+	{"tuple", `let t = (1, ("a", true)); let _ = print(t); print(first(second(t)))`},
+	{"concat", `let _ = print(1 + "a" + 2); print("x" + "y")`},
+	{"closure print", `print((fn () => { 1 }, 2))`},
+	{"wrap around", `let _ = print(2147483647 + 1); print(-2147483647 - 2 * 1)`},
+	{"division", `let _ = print(-7 / 2); print(-7 % 2)`},
+	{"comparison", `print(("a" < "b", (1 >= 1, (true == false, (1 != 2, (true && false, false || true))))))`},
+	{"memoized prints", `let log = fn (x) => { print(x) }; let f = fn (x) => { x + 1 }; let _ = log(f(1)); log(f(1))`},
+	{"evaluation order", `let f = fn (a, b) => { a }; let _ = f(print(1), print(2)); print(print(3) + print(4))`},
+	{"division by zero", `let _ = print("before"); 1 / 0`},
+	{"type mismatch", `print(1 - "a")`},
+	{"wrong arity", `let f = fn (a) => { a }; f(1, print(2))`},
+	{"not callable", `let x = 1; x(print(1))`},
+	{"not a tuple", `first(1)`},
+	{"bad condition", `if (1) { 1 } else { 2 }`},
+	{"nested capture", `let x = 10; let f = fn (y) => { fn () => { fn (z) => { x + y + z } } }; print(f(1)()(2))`},
+	{"recursive inner lambda", `let f = fn (n) => { let g = fn () => { f(n - 1) }; if (n == 0) { 0 } else { g() } }; print(f(3))`},
+	{"string keys", `let f = fn (s) => { s + "!" }; let _ = print(f("a" + "b")); print(f("ab"))`},
+}
+
+// Recursion are programs making a million tail calls, or nesting calls as
+// deep as the interpreter allows and deeper.
+var Recursion = []Program{
+	{"tail calls", `let f = fn (n, acc) => { if (n == 0) { acc } else { f(n - 1, acc + 1) } }; print(f(1000000, 0))`},
+	{"mutual tail calls", `let odd = fn (n, even) => { if (n == 0) { false } else { even(n - 1) } }; let even = fn (n) => { if (n == 0) { true } else { odd(n - 1, even) } }; print(even(1000001))`},
+	{"deep recursion", `let sum = fn (n) => { if (n == 0) { 0 } else { n + sum(n - 1) } }; print(sum(90000))`},
+	{"stack overflow", `let sum = fn (n) => { if (n == 0) { 0 } else { n + sum(n - 1) } }; print(sum(200000))`},
+}
+
+// Unbound are programs using variables bound nowhere, which are errors only
+// when they are evaluated.
+var Unbound = []Program{
+	{"unbound variable not reached", `let _ = print("start"); if (true) { print(1) } else { nope }`},
+	{"unbound variable", `let _ = print("start"); let f = fn () => { nope }; f()`},
+}
+
+// Examples returns the programs in the files directory of the repository.
+func Examples(t *testing.T) []Program {
+	names, err := filepath.Glob("../../files/*.rinha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	programs := make([]Program, len(names))
+	for i, name := range names {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		programs[i] = Program{filepath.Base(name), string(src)}
+	}
+	return programs
+}
+
+// Interpret runs file, returning its output and the message of the runtime
+// error it failed with, if any.
+func Interpret(t *testing.T, file *ast.File) (string, string) {
+	var out bytes.Buffer
+	err := interpreter.New(&out, file).Execute(context.Background())
+	var rerr *runtime.RuntimeError
+	if errors.As(err, &rerr) {
+		return out.String(), rerr.Message
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.String(), ""
+}
+
+// MatchInterpreter compiles every program with build, which returns the
+// command running it, and checks that it prints what the interpreter does
+// and fails with the same error. Programs run in parallel; path is a file
+// name of their own in a temporary directory.
+func MatchInterpreter(t *testing.T, programs []Program, build func(t *testing.T, file *ast.File, path string) *exec.Cmd) {
+	dir := t.TempDir()
+	for i, tt := range programs {
+		i, tt := i, tt
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Parallel()
+
+			file, err := parser.ParseString("test.rinha", tt.Src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, wantErr := Interpret(t, file)
+
+			cmd := build(t, file, filepath.Join(dir, strings.Repeat("p", i+1)))
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout, cmd.Stderr = &stdout, &stderr
+			err = cmd.Run()
+
+			if stdout.String() != want {
+				t.Errorf("got output %q, want %q", stdout.String(), want)
+			}
+			if wantErr == "" {
+				if err != nil {
+					t.Errorf("failed with %v: %s", err, stderr.String())
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error %q", wantErr)
+			}
+			if got, _, _ := strings.Cut(stderr.String(), "\n"); got != "error: "+wantErr {
+				t.Errorf("got %q, want %q", got, "error: "+wantErr)
+			}
+		})
+	}
+}
+
+// GenerateErrors checks that generate reports a binary operator the
+// language does not have, which only a program built without the parser
+// can use, as an error at the location of the operation.
+func GenerateErrors(t *testing.T, generate func(w io.Writer, f *ast.File, sources *diag.SourceMap) error) {
+	file, err := parser.ParseString("test.rinha", `1 + 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := file.Expression.(ast.Binary)
+	binary.Op = "Pow"
+	file.Expression = binary
+
+	var gerr *ast.Error
+	if err := generate(io.Discard, file, nil); !errors.As(err, &gerr) {
+		t.Fatalf("expected a generation error, got %v", err)
+	}
+	if gerr.Error() != "test.rinha:0:5: unknown binary operator Pow" {
+		t.Errorf("got %q", gerr.Error())
+	}
+}
@@ -0,0 +1,351 @@
+// Package js translates Rinha programs into ES2020 scripts that run in
+// browsers and Node.js.
+package js
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/diag"
+	"github.com/ghhernandes/rinha-compiler-go/purity"
+)
+
+type scope struct {
+	parent *scope
+	name   string
+	ident  string
+}
+
+func (s *scope) lookup(name string) (string, bool) {
+	for ; s != nil; s = s.parent {
+		if s.name == name {
+			return s.ident, true
+		}
+	}
+	return "", false
+}
+
+type generator struct {
+	sources *diag.SourceMap
+	pure    purity.Set
+	b       bytes.Buffer
+	scope   *scope
+	idents  int
+}
+
+// Generate writes a script that behaves like running f with the
+// interpreter: it prints the same output and fails with the same runtime
+// errors. Locations in errors are rendered with sources when it is not nil.
+// Calls to pure functions are memoized, as the interpreter does.
+//
+// The script runs in its own function scope, so it can be loaded either as
+// a classic script or as a module. Under Node.js, that function runs on a
+// worker thread whose stack is large enough for calls nesting as deep as
+// the interpreter allows.
+func Generate(w io.Writer, f *ast.File, sources *diag.SourceMap) (err error) {
+	g := &generator{sources: sources, pure: purity.Analyze(f.Expression)}
+
+	defer func() {
+		if r := recover(); r != nil {
+			gerr, ok := r.(*ast.Error)
+			if !ok {
+				panic(r)
+			}
+			err = gerr
+		}
+	}()
+
+	fmt.Fprintf(&g.b, "// Code generated by rinha build --target=js from %s. DO NOT EDIT.\n\n", f.Name)
+	g.b.WriteString("\"use strict\";\n\n(() => {\nconst rinha = () => {\n")
+	for _, line := range strings.SplitAfter(runtime, "\n") {
+		if strings.TrimSpace(line) != "" {
+			g.b.WriteString("\t")
+		}
+		g.b.WriteString(line)
+	}
+	g.b.WriteString("\ntry {\n")
+	result := g.term(f.Expression)
+	fmt.Fprintf(&g.b, "void %s;\n", result)
+	g.b.WriteString("} catch (e) {\nif (!(e instanceof RinhaError)) {\nthrow e;\n}\n")
+	g.b.WriteString("rt_err(\"error: \" + e.message + \"\\n --> \" + e.loc);\n")
+	g.b.WriteString("if (typeof process !== \"undefined\") {\nprocess.exitCode = 1;\n}\n}\n};\n\n")
+	g.b.WriteString(start)
+	g.b.WriteString("})();\n")
+
+	_, err = w.Write(indent(g.b.Bytes()))
+	return err
+}
+
+// start runs the function rinha holding the program, on a worker thread
+// under Node.js.
+const start = `if (typeof process !== "undefined" && process.release?.name === "node") {
+import("node:worker_threads").then(({ Worker }) => {
+const worker = new Worker("(" + rinha + ")()", { eval: true, resourceLimits: { stackSizeMb: 1024 } });
+worker.on("exit", (code) => {
+process.exitCode = code;
+});
+});
+} else {
+rinha();
+}
+`
+
+// indent indents the generated code by braces, leaving lines that are
+// already indented, like the runtime's, as they are.
+func indent(src []byte) []byte {
+	var (
+		out   bytes.Buffer
+		depth int
+	)
+	for _, line := range strings.Split(string(src), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "}") && depth > 0 {
+			depth--
+		}
+		if trimmed != "" && !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, " ") && depth > 0 {
+			out.WriteString(strings.Repeat("\t", depth))
+		}
+		out.WriteString(line)
+		out.WriteString("\n")
+		if strings.HasSuffix(trimmed, "{") {
+			depth++
+		}
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n"))
+}
+
+func (g *generator) errorf(loc ast.Location, format string, args ...any) {
+	panic(ast.Errorf(loc, format, args...))
+}
+
+// ident returns a fresh JavaScript identifier for name. Rinha names are
+// prefixed so they never clash with keywords or the runtime.
+func (g *generator) ident(name string) string {
+	g.idents++
+	return fmt.Sprintf("v_%s_%d", name, g.idents)
+}
+
+func (g *generator) temp() string {
+	g.idents++
+	return fmt.Sprintf("t%d", g.idents)
+}
+
+// quote returns s as a string literal. JSON strings are valid JavaScript
+// ones.
+func quote(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (g *generator) loc(loc ast.Location) string {
+	if g.sources == nil {
+		return quote(fmt.Sprintf("%s:%d:%d", loc.Filename, loc.Start, loc.End))
+	}
+	return quote(g.sources.Format(loc))
+}
+
+// bind assigns expr to a new temporary and returns it, so that terms are
+// evaluated in the order the interpreter evaluates them.
+func (g *generator) bind(expr string) string {
+	t := g.temp()
+	fmt.Fprintf(&g.b, "const %s = %s;\n", t, expr)
+	return t
+}
+
+// term writes the statements evaluating node and returns an expression,
+// free of side effects, holding its value.
+func (g *generator) term(node ast.Term) string {
+	switch n := node.(type) {
+	case ast.Int:
+		if n.Value < 0 {
+			return fmt.Sprintf("(%d)", n.Value)
+		}
+		return fmt.Sprint(n.Value)
+	case ast.Str:
+		return quote(n.Value)
+	case ast.Bool:
+		return fmt.Sprint(n.Value)
+	case ast.Var:
+		ident, ok := g.scope.lookup(n.Text)
+		if !ok {
+			return g.bind(fmt.Sprintf("rt_undefined(%s, %s)", g.loc(n.Location), quote(n.Text)))
+		}
+		return ident
+	case ast.Let:
+		return g.let(n, false)
+	case ast.Function:
+		return g.bind(g.function(n))
+	case ast.If:
+		return g.cond(n, false)
+	case ast.Binary:
+		return g.binary(n)
+	case ast.Call:
+		return g.call(n, false)
+	case ast.Tuple:
+		first := g.term(n.First)
+		second := g.term(n.Second)
+		return g.bind(fmt.Sprintf("new Tuple(%s, %s)", first, second))
+	case ast.Print:
+		return g.bind(fmt.Sprintf("rt_print(%s)", g.term(n.Value)))
+	case ast.First:
+		return g.bind(fmt.Sprintf("rt_tuple(%s, %s).first", g.loc(n.Location), g.term(n.Value)))
+	case ast.Second:
+		return g.bind(fmt.Sprintf("rt_tuple(%s, %s).second", g.loc(n.Location), g.term(n.Value)))
+	default:
+		g.errorf(ast.LocationOf(node), "unsupported term %T", node)
+		return ""
+	}
+}
+
+// tail is term for the result of a function: calls whose result is that of
+// the function return a TailCall for rt_call to make instead, so chains of
+// them run without growing the stack.
+func (g *generator) tail(node ast.Term) string {
+	switch n := node.(type) {
+	case ast.Let:
+		return g.let(n, true)
+	case ast.If:
+		return g.cond(n, true)
+	case ast.Call:
+		return g.call(n, true)
+	default:
+		return g.term(node)
+	}
+}
+
+func (g *generator) let(n ast.Let, tail bool) string {
+	outer := g.scope
+	ident := g.ident(n.Name.Text)
+
+	if fn, ok := n.Value.(ast.Function); ok {
+		// The binding is in scope of its value so the function can call
+		// itself.
+		g.scope = &scope{parent: outer, name: n.Name.Text, ident: ident}
+		fmt.Fprintf(&g.b, "const %s = %s;\n", ident, g.function(fn))
+	} else {
+		value := g.term(n.Value)
+		fmt.Fprintf(&g.b, "const %s = %s;\n", ident, value)
+		g.scope = &scope{parent: outer, name: n.Name.Text, ident: ident}
+	}
+
+	if n.Next == nil {
+		g.scope = outer
+		return ident
+	}
+	var result string
+	if tail {
+		result = g.tail(n.Next)
+	} else {
+		result = g.term(n.Next)
+	}
+	g.scope = outer
+	return result
+}
+
+// function returns an expression creating a closure for fn. Pure functions
+// are passed to rt_memo, which gives them a cache of their results.
+func (g *generator) function(fn ast.Function) string {
+	outer, saved := g.b, g.scope
+	g.b = bytes.Buffer{}
+
+	params := make([]string, len(fn.Parameters))
+	for i, param := range fn.Parameters {
+		params[i] = g.ident(param.Text)
+		g.scope = &scope{parent: g.scope, name: param.Text, ident: params[i]}
+	}
+	result := g.tail(fn.Value)
+	body := g.b.String()
+	g.b, g.scope = outer, saved
+
+	closure := fmt.Sprintf("(%s) => {\n%sreturn %s;\n}", strings.Join(params, ", "), body, result)
+	if g.pure.Pure(fn) {
+		return fmt.Sprintf("rt_memo(%s)", closure)
+	}
+	return closure
+}
+
+func (g *generator) cond(n ast.If, tail bool) string {
+	branch := g.term
+	if tail {
+		branch = g.tail
+	}
+	condition := g.term(n.Condition)
+	result := g.temp()
+	fmt.Fprintf(&g.b, "let %s;\n", result)
+	fmt.Fprintf(&g.b, "if (rt_cond(%s, %s)) {\n", g.loc(n.Location), condition)
+	fmt.Fprintf(&g.b, "%s = %s;\n", result, branch(n.Then))
+	g.b.WriteString("} else {\n")
+	fmt.Fprintf(&g.b, "%s = %s;\n", result, branch(n.Otherwise))
+	g.b.WriteString("}\n")
+	return result
+}
+
+var binaryFuncs = map[ast.BinaryOp]string{
+	ast.Add: "rt_add",
+	ast.Sub: "rt_sub",
+	ast.Mul: "rt_mul",
+	ast.Div: "rt_div",
+	ast.Rem: "rt_rem",
+}
+
+func (g *generator) binary(n ast.Binary) string {
+	left := g.term(n.Lhs)
+	right := g.term(n.Rhs)
+	loc := g.loc(n.Location)
+	op := quote(string(n.Op))
+
+	if fn, ok := binaryFuncs[n.Op]; ok {
+		return g.bind(fmt.Sprintf("%s(%s, %s, %s)", fn, loc, left, right))
+	}
+	switch n.Op {
+	case ast.Eq:
+		return g.bind(fmt.Sprintf("rt_eq(%s, %s, %s, %s)", loc, op, left, right))
+	case ast.Neq:
+		return g.bind(fmt.Sprintf("!rt_eq(%s, %s, %s, %s)", loc, op, left, right))
+	case ast.Lt:
+		return g.bind(fmt.Sprintf("rt_compare(%s, %s, %s, %s) < 0", loc, op, left, right))
+	case ast.Lte:
+		return g.bind(fmt.Sprintf("rt_compare(%s, %s, %s, %s) <= 0", loc, op, left, right))
+	case ast.Gt:
+		return g.bind(fmt.Sprintf("rt_compare(%s, %s, %s, %s) > 0", loc, op, left, right))
+	case ast.Gte:
+		return g.bind(fmt.Sprintf("rt_compare(%s, %s, %s, %s) >= 0", loc, op, left, right))
+	case ast.And:
+		fmt.Fprintf(&g.b, "rt_bools(%s, %s, %s, %s);\n", loc, op, left, right)
+		return g.bind(fmt.Sprintf("%s && %s", left, right))
+	case ast.Or:
+		fmt.Fprintf(&g.b, "rt_bools(%s, %s, %s, %s);\n", loc, op, left, right)
+		return g.bind(fmt.Sprintf("%s || %s", left, right))
+	default:
+		g.errorf(n.Location, "unknown binary operator %s", n.Op)
+		return ""
+	}
+}
+
+// call makes a call with rt_call, or returns a TailCall for the caller to
+// make when tail is set.
+func (g *generator) call(n ast.Call, tail bool) string {
+	name := "<anonymous>"
+	if v, ok := n.Callee.(ast.Var); ok {
+		name = v.Text
+	}
+
+	callee := g.temp()
+	loc := g.loc(n.Location)
+	fmt.Fprintf(&g.b, "const %s = rt_callee(%s, %s, %s, %d);\n", callee, loc, quote(name), g.term(n.Callee), len(n.Arguments))
+	args := make([]string, len(n.Arguments))
+	for i, arg := range n.Arguments {
+		args[i] = g.term(arg)
+	}
+	if tail {
+		return g.bind(fmt.Sprintf("new TailCall(%s, [%s])", callee, strings.Join(args, ", ")))
+	}
+	return g.bind(fmt.Sprintf("rt_call(%s, %s, %s, [%s])", loc, quote(name), callee, strings.Join(args, ", ")))
+}
@@ -0,0 +1,48 @@
+package js_test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/backend/internal/backendtest"
+	"github.com/ghhernandes/rinha-compiler-go/backend/js"
+)
+
+// programs are the programs run by this backend besides the shared ones.
+var programs = []backendtest.Program{
+	{Name: "min int", Src: `let m = -2147483647 - 1; let _ = print(m); let _ = print(m / -1); let _ = print(m % -1); let _ = print(m * -1); print("" + m)`},
+	{Name: "multiplication", Src: `print(123456789 * 987654321)`},
+	{Name: "string comparison", Src: `print(("ab" < "a", ("a" <= "ab", ("b" > "ab", ("ab" == "a" + "b", "" != "")))))`},
+	{Name: "code point order", Src: `print(("" < "😀", "😀" > ""))`},
+	{Name: "memoized tuples", Src: `let f = fn (t) => { first(t) + 1 }; let t = (1, 2); print((f(t), (f(t), f((1, 2)))))`},
+	{Name: "long output", Src: `let f = fn (n) => { if (n == 0) { 0 } else { let _ = print("line " + n); f(n - 1) } }; f(2000)`},
+	{Name: "comparison mismatch", Src: `print(true < false)`},
+	{Name: "escapes", Src: `print("quote \" backslash \\ é </script>")`},
+}
+
+func TestScriptsMatchInterpreter(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not available")
+	}
+
+	tests := append(append(append(append(backendtest.Programs, backendtest.Recursion...), backendtest.Unbound...), programs...), backendtest.Examples(t)...)
+	backendtest.MatchInterpreter(t, tests, func(t *testing.T, file *ast.File, path string) *exec.Cmd {
+		var src bytes.Buffer
+		if err := js.Generate(&src, file, nil); err != nil {
+			t.Fatal(err)
+		}
+		script := path + ".js"
+		if err := os.WriteFile(script, src.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return exec.Command(node, script)
+	})
+}
+
+func TestGenerateErrors(t *testing.T) {
+	backendtest.GenerateErrors(t, js.Generate)
+}
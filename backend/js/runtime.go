@@ -0,0 +1,263 @@
+package js
+
+// runtime is the JavaScript runtime every generated program starts with.
+// Ints are numbers kept in the int32 range, Strs are strings, Bools are
+// booleans, tuples are Tuple objects and closures are functions, whose
+// length is their arity. Operations check their operands like
+// interpreter.Binary does and throw the same messages, and calls nest as
+// deep as in the interpreter.
+//
+// Programs print through globalThis.rinhaPrint and report errors through
+// globalThis.rinhaError when a page defines them, and to the console
+// otherwise.
+const runtime = `class Tuple {
+	constructor(first, second) {
+		this.first = first;
+		this.second = second;
+	}
+}
+
+// TailCall is returned by a function ending with a call, for rt_call to
+// make. Programs never see it.
+class TailCall {
+	constructor(fn, args) {
+		this.fn = fn;
+		this.args = args;
+	}
+}
+
+class RinhaError extends Error {
+	constructor(message, loc) {
+		super(message);
+		this.loc = loc;
+	}
+}
+
+const rt_out = globalThis.rinhaPrint ?? ((line) => console.log(line));
+const rt_err = globalThis.rinhaError ?? ((text) => console.error(text));
+
+function rt_fail(loc, message) {
+	throw new RinhaError(message, loc);
+}
+
+function rt_kind(v) {
+	switch (typeof v) {
+	case "number":
+		return "Int";
+	case "string":
+		return "Str";
+	case "boolean":
+		return "Bool";
+	case "function":
+		return "Closure";
+	default:
+		return "Tuple";
+	}
+}
+
+function rt_show(v) {
+	if (v instanceof Tuple) {
+		return "(" + rt_show(v.first) + ", " + rt_show(v.second) + ")";
+	}
+	if (typeof v === "function") {
+		return "<#closure>";
+	}
+	return String(v);
+}
+
+function rt_print(v) {
+	rt_out(rt_show(v));
+	return v;
+}
+
+function rt_mismatch(loc, op, l, r) {
+	rt_fail(loc, "invalid operands for " + op + ": " + rt_kind(l) + " and " + rt_kind(r));
+}
+
+function rt_ints(loc, op, l, r) {
+	if (typeof l !== "number" || typeof r !== "number") {
+		rt_mismatch(loc, op, l, r);
+	}
+}
+
+// rt_add follows interpreter.add: Int + Int is an Int, and any other mix of
+// Int and Str concatenates. Arithmetic wraps around like Go's int32.
+function rt_add(loc, l, r) {
+	const lk = typeof l, rk = typeof r;
+	if (lk === "number" && rk === "number") {
+		return (l + r) | 0;
+	}
+	if ((lk === "number" || lk === "string") && (rk === "number" || rk === "string")) {
+		return String(l) + String(r);
+	}
+	rt_mismatch(loc, "Add", l, r);
+}
+
+function rt_sub(loc, l, r) {
+	rt_ints(loc, "Sub", l, r);
+	return (l - r) | 0;
+}
+
+function rt_mul(loc, l, r) {
+	rt_ints(loc, "Mul", l, r);
+	return Math.imul(l, r);
+}
+
+// Division truncates towards zero; the | 0 also wraps -2147483648 / -1
+// around, as Go does.
+function rt_div(loc, l, r) {
+	rt_ints(loc, "Div", l, r);
+	if (r === 0) {
+		rt_fail(loc, "division by zero");
+	}
+	return (l / r) | 0;
+}
+
+function rt_rem(loc, l, r) {
+	rt_ints(loc, "Rem", l, r);
+	if (r === 0) {
+		rt_fail(loc, "division by zero");
+	}
+	return (l % r) | 0;
+}
+
+// rt_strcmp orders strings by code point, like Go orders their UTF-8 bytes.
+// Comparing UTF-16 code units only differs when surrogates are involved.
+const rt_surrogates = /[\uD800-\uDFFF]/;
+
+function rt_strcmp(a, b) {
+	if (!rt_surrogates.test(a) && !rt_surrogates.test(b)) {
+		return a < b ? -1 : a > b ? 1 : 0;
+	}
+	const x = Array.from(a, (c) => c.codePointAt(0));
+	const y = Array.from(b, (c) => c.codePointAt(0));
+	for (let i = 0; i < x.length && i < y.length; i++) {
+		if (x[i] !== y[i]) {
+			return x[i] < y[i] ? -1 : 1;
+		}
+	}
+	return x.length < y.length ? -1 : x.length > y.length ? 1 : 0;
+}
+
+function rt_eq(loc, op, l, r) {
+	const k = typeof l;
+	if (k === typeof r && (k === "number" || k === "string" || k === "boolean")) {
+		return l === r;
+	}
+	rt_mismatch(loc, op, l, r);
+}
+
+function rt_compare(loc, op, l, r) {
+	const k = typeof l;
+	if (k === typeof r && (k === "number" || k === "string")) {
+		return k === "string" ? rt_strcmp(l, r) : l < r ? -1 : l > r ? 1 : 0;
+	}
+	rt_mismatch(loc, op, l, r);
+}
+
+function rt_bools(loc, op, l, r) {
+	if (typeof l !== "boolean" || typeof r !== "boolean") {
+		rt_mismatch(loc, op, l, r);
+	}
+}
+
+function rt_cond(loc, v) {
+	if (typeof v !== "boolean") {
+		rt_fail(loc, "condition must be a Bool");
+	}
+	return v;
+}
+
+function rt_tuple(loc, v) {
+	if (!(v instanceof Tuple)) {
+		rt_fail(loc, "not a tuple");
+	}
+	return v;
+}
+
+// rt_undefined fails on reading a variable bound nowhere, which is only an
+// error once it is evaluated.
+function rt_undefined(loc, name) {
+	rt_fail(loc, "undefined variable " + name);
+}
+
+// rt_callee checks a call before its arguments are evaluated.
+function rt_callee(loc, name, v, argc) {
+	if (typeof v !== "function") {
+		rt_fail(loc, "cannot call a " + rt_kind(v));
+	}
+	if (v.length !== argc) {
+		rt_fail(loc, "wrong number of arguments: " + name + " expects " + v.length + ", got " + argc);
+	}
+	return v;
+}
+
+// Memoization keys hold Ints, Strs and Bools by value, and tuples and
+// closures by identity.
+const rt_ids = new WeakMap();
+let rt_next_id = 0;
+
+function rt_key(args) {
+	let key = "";
+	for (const a of args) {
+		switch (typeof a) {
+		case "number":
+			key += "i" + a + ",";
+			break;
+		case "boolean":
+			key += a ? "t," : "f,";
+			break;
+		case "string":
+			key += "s" + a.length + ":" + a;
+			break;
+		default:
+			if (!rt_ids.has(a)) {
+				rt_ids.set(a, rt_next_id++);
+			}
+			key += "o" + rt_ids.get(a) + ",";
+		}
+	}
+	return key;
+}
+
+// rt_memo gives fn, a pure function, a cache of its results by arguments.
+function rt_memo(fn) {
+	fn.memo = new Map();
+	return fn;
+}
+
+const RT_MAX_DEPTH = 100000;
+let rt_depth = 0;
+
+// rt_call calls fn, and every call it ends with, like the interpreter does:
+// the chain stops at the first memoized call, and only the result of fn is
+// memoized.
+function rt_call(loc, name, fn, args) {
+	let key;
+	if (fn.memo !== undefined) {
+		key = rt_key(args);
+		const v = fn.memo.get(key);
+		if (v !== undefined) {
+			return v;
+		}
+	}
+	if (rt_depth >= RT_MAX_DEPTH) {
+		rt_fail(loc, "stack overflow: calls to " + name + " nested more than " + RT_MAX_DEPTH + " deep");
+	}
+	rt_depth++;
+	let v = fn(...args);
+	while (v instanceof TailCall) {
+		const next = v.fn.memo?.get(rt_key(v.args));
+		if (next !== undefined) {
+			v = next;
+			break;
+		}
+		v = v.fn(...v.args);
+	}
+	rt_depth--;
+	if (key !== undefined) {
+		fn.memo.set(key, v);
+	}
+	return v;
+}
+`
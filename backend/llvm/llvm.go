@@ -0,0 +1,492 @@
+// Package llvm translates Rinha programs into textual LLVM IR. Functions are
+// closure converted: each one receives its closure, holding the variables
+// it captures, as an extra parameter. Values, printing and strings are left
+// to a small C runtime the IR is linked with.
+package llvm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/backend/c"
+	"github.com/ghhernandes/rinha-compiler-go/closure"
+	"github.com/ghhernandes/rinha-compiler-go/diag"
+	"github.com/ghhernandes/rinha-compiler-go/purity"
+)
+
+// ErrNoCompiler is returned by Compile when neither clang nor llc and a C
+// compiler are on the PATH.
+var ErrNoCompiler = errors.New("no LLVM toolchain found")
+
+// Value tags, in the order of value.Kind. The runtime defines them too.
+const (
+	tagInt int64 = iota
+	tagStr
+	tagBool
+	tagTuple
+	tagClosure
+)
+
+// closureCaptures is the offset of the captured values in a closure.
+const closureCaptures = 24
+
+// function is a closure converted function being lowered to an LLVM
+// function.
+type function struct {
+	ir *closure.Function
+	// locals holds the operand of each local slot.
+	locals []string
+	body   bytes.Buffer
+	temps  int
+	labels int
+	// block is the label of the basic block being written.
+	block string
+	// memo holds the arguments of a pure function, stored for rt_memo_put,
+	// or is "".
+	memo string
+}
+
+type generator struct {
+	sources *diag.SourceMap
+	pure    purity.Set
+	fn      *function
+	strs    map[string]string
+	cstrs   map[string]string
+	globals bytes.Buffer
+}
+
+const declarations = `declare i64 @rt_print(i64)
+declare i64 @rt_add(i64, i64, ptr)
+declare i64 @rt_sub(i64, i64, ptr)
+declare i64 @rt_mul(i64, i64, ptr)
+declare i64 @rt_div(i64, i64, ptr)
+declare i64 @rt_rem(i64, i64, ptr)
+declare i64 @rt_eq(i64, i64, ptr)
+declare i64 @rt_neq(i64, i64, ptr)
+declare i64 @rt_lt(i64, i64, ptr)
+declare i64 @rt_lte(i64, i64, ptr)
+declare i64 @rt_gt(i64, i64, ptr)
+declare i64 @rt_gte(i64, i64, ptr)
+declare i64 @rt_and(i64, i64, ptr)
+declare i64 @rt_or(i64, i64, ptr)
+declare i32 @rt_cond(i64, ptr)
+declare i64 @rt_tuple(i64, i64)
+declare i64 @rt_first(i64, ptr)
+declare i64 @rt_second(i64, ptr)
+declare i64 @rt_undefined(ptr, ptr)
+declare ptr @rt_closure(ptr, i32, i32, i32)
+declare ptr @rt_callee(i64, ptr, i32, ptr)
+declare ptr @rt_memo_get(ptr, ptr)
+declare void @rt_memo_put(ptr, ptr, i64)
+declare void @rt_enter(ptr, ptr)
+declare void @rt_leave()
+`
+
+// Generate writes the LLVM IR of a program that behaves like running f with
+// the interpreter: it prints the same output and fails with the same runtime
+// errors once linked with the runtime. Locations in errors are rendered with
+// sources when it is not nil.
+func Generate(w io.Writer, f *ast.File, sources *diag.SourceMap) (err error) {
+	program, err := closure.Convert(f)
+	if err != nil {
+		return err
+	}
+
+	g := &generator{
+		sources: sources,
+		pure:    purity.Analyze(f.Expression),
+		strs:    make(map[string]string),
+		cstrs:   make(map[string]string),
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			gerr, ok := r.(*ast.Error)
+			if !ok {
+				panic(r)
+			}
+			err = gerr
+		}
+	}()
+
+	functions := make([]*function, len(program.Functions))
+	for i, fn := range program.Functions {
+		functions[i] = g.function(fn)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "; Code generated by rinha build --target=llvm from %s. DO NOT EDIT.\n\n", f.Name)
+	b.WriteString(declarations)
+	if g.globals.Len() > 0 {
+		b.WriteString("\n")
+		b.Write(g.globals.Bytes())
+	}
+	for _, fn := range functions[1:] {
+		b.WriteString("\n")
+		b.Write(fn.body.Bytes())
+		b.WriteString("}\n")
+	}
+	b.WriteString("\ndefine void @program() {\nentry:\n")
+	b.Write(functions[0].body.Bytes())
+	b.WriteString("}\n")
+
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// Available reports whether Compile can find a toolchain.
+func Available() bool {
+	if _, err := exec.LookPath("clang"); err == nil {
+		return true
+	}
+	_, err := exec.LookPath("llc")
+	return err == nil && c.Compiler() != ""
+}
+
+var llvmVersion = regexp.MustCompile(`LLVM version (\d+)`)
+
+// Compile compiles the IR file ir and the runtime into the executable
+// output, with clang or else with llc and the C compiler.
+func Compile(ir, output string) error {
+	dir, err := os.MkdirTemp("", "rinha-llvm")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	rt := filepath.Join(dir, "runtime.c")
+	if err := os.WriteFile(rt, []byte(runtime), 0o644); err != nil {
+		return err
+	}
+
+	if clang, err := exec.LookPath("clang"); err == nil {
+		return run(clang, "-O2", "-pthread", "-o", output, ir, rt)
+	}
+	llc, err := exec.LookPath("llc")
+	cc := c.Compiler()
+	if err != nil || cc == "" {
+		return ErrNoCompiler
+	}
+	args := []string{"-O2", "-relocation-model=pic", "-filetype=obj", "-o", filepath.Join(dir, "program.o"), ir}
+	// Opaque pointers became the default in LLVM 15.
+	version, _ := exec.Command(llc, "--version").Output()
+	if m := llvmVersion.FindSubmatch(version); m != nil {
+		if major, _ := strconv.Atoi(string(m[1])); major < 15 {
+			args = append(args, "-opaque-pointers")
+		}
+	}
+	if err := run(llc, args...); err != nil {
+		return err
+	}
+	return run(cc, "-O2", "-pthread", "-o", output, filepath.Join(dir, "program.o"), rt)
+}
+
+func run(name string, args ...string) error {
+	if out, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w\n%s", name, err, out)
+	}
+	return nil
+}
+
+// Build generates the IR for f next to output, as output.ll, and compiles
+// it into the executable output.
+func Build(f *ast.File, sources *diag.SourceMap, output string) error {
+	var ir bytes.Buffer
+	if err := Generate(&ir, f, sources); err != nil {
+		return err
+	}
+	source := output + ".ll"
+	if err := os.WriteFile(source, ir.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return Compile(source, output)
+}
+
+func (g *generator) errorf(loc ast.Location, format string, args ...any) {
+	panic(ast.Errorf(loc, format, args...))
+}
+
+func (g *generator) emit(format string, args ...any) {
+	g.fn.body.WriteString("  ")
+	fmt.Fprintf(&g.fn.body, format, args...)
+	g.fn.body.WriteString("\n")
+}
+
+// bind assigns instr to a new temporary and returns it.
+func (g *generator) bind(format string, args ...any) string {
+	g.fn.temps++
+	t := fmt.Sprintf("%%t%d", g.fn.temps)
+	g.emit("%s = %s", t, fmt.Sprintf(format, args...))
+	return t
+}
+
+func (g *generator) label(name string) {
+	fmt.Fprintf(&g.fn.body, "%s:\n", name)
+	g.fn.block = name
+}
+
+// escape returns s as the contents of an LLVM string constant.
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= ' ' && c <= '~' && c != '"' && c != '\\' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "\\%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// str returns a constant Str holding s.
+func (g *generator) str(s string) string {
+	if name, ok := g.strs[s]; ok {
+		return name
+	}
+	name := fmt.Sprintf("@str.%d", len(g.strs))
+	g.strs[s] = name
+	fmt.Fprintf(&g.globals, "%s = private unnamed_addr constant { i64, [%d x i8] } { i64 %d, [%d x i8] c\"%s\" }, align 8\n", name, len(s), len(s), len(s), escape(s))
+	return name
+}
+
+// cstr returns a constant NUL terminated string holding s.
+func (g *generator) cstr(s string) string {
+	if name, ok := g.cstrs[s]; ok {
+		return name
+	}
+	name := fmt.Sprintf("@cstr.%d", len(g.cstrs))
+	g.cstrs[s] = name
+	fmt.Fprintf(&g.globals, "%s = private unnamed_addr constant [%d x i8] c\"%s\\00\"\n", name, len(s)+1, escape(s))
+	return name
+}
+
+func (g *generator) loc(loc ast.Location) string {
+	if g.sources == nil {
+		return g.cstr(fmt.Sprintf("%s:%d:%d", loc.Filename, loc.Start, loc.End))
+	}
+	return g.cstr(g.sources.Format(loc))
+}
+
+// term writes the instructions evaluating e and returns the operand
+// holding its value.
+func (g *generator) term(e closure.Expr) string {
+	switch n := e.(type) {
+	case closure.Int:
+		return strconv.FormatInt(int64(uint64(uint32(n.Value))<<32), 10)
+	case closure.Str:
+		return g.bind("or i64 ptrtoint (ptr %s to i64), %d", g.str(n.Value), tagStr)
+	case closure.Bool:
+		var b int64
+		if n.Value {
+			b = 1
+		}
+		return strconv.FormatInt(b<<32|tagBool, 10)
+	case closure.Local:
+		return g.fn.locals[n.Slot]
+	case closure.Capture:
+		p := g.bind("getelementptr inbounds i8, ptr %%self, i64 %d", closureCaptures+8*n.Index)
+		return g.bind("load i64, ptr %s", p)
+	case closure.Self:
+		return g.bind("or i64 %s, %d", g.bind("ptrtoint ptr %%self to i64"), tagClosure)
+	case closure.Undefined:
+		return g.bind("call i64 @rt_undefined(ptr %s, ptr %s)", g.cstr(n.Name), g.loc(n.Location))
+	case closure.Let:
+		value := g.term(n.Value)
+		g.fn.locals[n.Slot] = value
+		if n.Next == nil {
+			return value
+		}
+		return g.term(n.Next)
+	case closure.Closure:
+		return g.closure(n)
+	case closure.If:
+		return g.cond(n)
+	case closure.Binary:
+		fn, ok := binaryFuncs[n.Op]
+		if !ok {
+			g.errorf(n.Location, "unknown binary operator %s", n.Op)
+		}
+		left := g.term(n.Lhs)
+		right := g.term(n.Rhs)
+		return g.bind("call i64 @%s(i64 %s, i64 %s, ptr %s)", fn, left, right, g.loc(n.Location))
+	case closure.Call:
+		return g.call(n)
+	case closure.Tuple:
+		first := g.term(n.First)
+		second := g.term(n.Second)
+		return g.bind("call i64 @rt_tuple(i64 %s, i64 %s)", first, second)
+	case closure.Print:
+		return g.bind("call i64 @rt_print(i64 %s)", g.term(n.Value))
+	case closure.First:
+		return g.bind("call i64 @rt_first(i64 %s, ptr %s)", g.term(n.Value), g.loc(n.Location))
+	case closure.Second:
+		return g.bind("call i64 @rt_second(i64 %s, ptr %s)", g.term(n.Value), g.loc(n.Location))
+	default:
+		panic(fmt.Sprintf("unexpected expression %T", e))
+	}
+}
+
+var binaryFuncs = map[ast.BinaryOp]string{
+	ast.Add: "rt_add",
+	ast.Sub: "rt_sub",
+	ast.Mul: "rt_mul",
+	ast.Div: "rt_div",
+	ast.Rem: "rt_rem",
+	ast.Eq:  "rt_eq",
+	ast.Neq: "rt_neq",
+	ast.Lt:  "rt_lt",
+	ast.Lte: "rt_lte",
+	ast.Gt:  "rt_gt",
+	ast.Gte: "rt_gte",
+	ast.And: "rt_and",
+	ast.Or:  "rt_or",
+}
+
+// branch writes the instructions evaluating the condition of n and
+// branching on it, and returns the labels of both branches and of the block
+// they join in.
+func (g *generator) branch(n closure.If) (then, otherwise, end string) {
+	condition := g.term(n.Condition)
+	c := g.bind("call i32 @rt_cond(i64 %s, ptr %s)", condition, g.loc(n.Location))
+	b := g.bind("icmp ne i32 %s, 0", c)
+
+	g.fn.labels++
+	then, otherwise, end = fmt.Sprintf("then.%d", g.fn.labels), fmt.Sprintf("else.%d", g.fn.labels), fmt.Sprintf("end.%d", g.fn.labels)
+	g.emit("br i1 %s, label %%%s, label %%%s", b, then, otherwise)
+	return then, otherwise, end
+}
+
+func (g *generator) cond(n closure.If) string {
+	then, otherwise, end := g.branch(n)
+
+	g.label(then)
+	a := g.term(n.Then)
+	fromThen := g.fn.block
+	g.emit("br label %%%s", end)
+
+	g.label(otherwise)
+	o := g.term(n.Otherwise)
+	fromOtherwise := g.fn.block
+	g.emit("br label %%%s", end)
+
+	g.label(end)
+	return g.bind("phi i64 [ %s, %%%s ], [ %s, %%%s ]", a, fromThen, o, fromOtherwise)
+}
+
+// function lowers fn to an LLVM function, or to the body of the program
+// the runtime runs. Pure functions look their arguments up in the memo of
+// their closure before running their body. Functions use the tailcc calling
+// convention, which turns their calls in tail position into jumps.
+func (g *generator) function(fn *closure.Function) *function {
+	g.fn = &function{ir: fn, locals: make([]string, fn.Locals), block: "entry"}
+	if fn.Index == 0 {
+		g.term(fn.Body)
+		g.emit("ret void")
+		return g.fn
+	}
+
+	params := []string{"ptr %self"}
+	for i, param := range fn.Params {
+		g.fn.temps++
+		g.fn.locals[i] = fmt.Sprintf("%%%s.%d", param, g.fn.temps)
+		params = append(params, "i64 "+g.fn.locals[i])
+	}
+	fmt.Fprintf(&g.fn.body, "define internal tailcc i64 @fn.%d(%s) {\nentry:\n", fn.Index, strings.Join(params, ", "))
+
+	if g.pure.Pure(fn.Source) {
+		args := g.bind("alloca i64, i32 %d, align 8", max(len(fn.Params), 1))
+		for i, param := range params[1:] {
+			p := g.bind("getelementptr inbounds i64, ptr %s, i64 %d", args, i)
+			g.emit("store %s, ptr %s", param, p)
+		}
+		memoized := g.bind("call ptr @rt_memo_get(ptr %%self, ptr %s)", args)
+		hit := g.bind("icmp ne ptr %s, null", memoized)
+		g.emit("br i1 %s, label %%memoized, label %%body", hit)
+		g.label("memoized")
+		g.emit("ret i64 %s", g.bind("load i64, ptr %s", memoized))
+		g.label("body")
+		g.fn.memo = args
+	}
+	g.ret(fn.Body)
+	return g.fn
+}
+
+// ret writes the instructions evaluating e and returning its value, which
+// pure functions memoize unless a call in tail position returns it: like in
+// the interpreter, only the result of the first call of a chain of tail
+// calls is memoized, by the function computing it.
+func (g *generator) ret(e closure.Expr) {
+	switch n := e.(type) {
+	case closure.Let:
+		if n.Next != nil {
+			g.fn.locals[n.Slot] = g.term(n.Value)
+			g.ret(n.Next)
+			return
+		}
+	case closure.If:
+		then, otherwise, _ := g.branch(n)
+		g.label(then)
+		g.ret(n.Then)
+		g.label(otherwise)
+		g.ret(n.Otherwise)
+		return
+	case closure.Call:
+		if n.Tail {
+			fn, args := g.callee(n)
+			g.emit("ret i64 %s", g.bind("tail call tailcc i64 %s(%s)", fn, args))
+			return
+		}
+	}
+	result := g.term(e)
+	if g.fn.memo != "" {
+		g.emit("call void @rt_memo_put(ptr %%self, ptr %s, i64 %s)", g.fn.memo, result)
+	}
+	g.emit("ret i64 %s", result)
+}
+
+// closure writes the instructions creating a closure of n.Function.
+func (g *generator) closure(n closure.Closure) string {
+	fn := n.Function
+	memoize := 0
+	if g.pure.Pure(fn.Source) {
+		memoize = 1
+	}
+	closure := g.bind("call ptr @rt_closure(ptr @fn.%d, i32 %d, i32 %d, i32 %d)", fn.Index, len(fn.Params), memoize, len(fn.Captures))
+	for i, capture := range n.Captures {
+		value := g.term(capture)
+		p := g.bind("getelementptr inbounds i8, ptr %s, i64 %d", closure, closureCaptures+8*i)
+		g.emit("store i64 %s, ptr %s", value, p)
+	}
+	return g.bind("or i64 %s, %d", g.bind("ptrtoint ptr %s to i64", closure), tagClosure)
+}
+
+// callee writes the instructions evaluating the callee and the arguments
+// of n, and returns the function to call and its arguments.
+func (g *generator) callee(n closure.Call) (string, string) {
+	callee := g.term(n.Callee)
+	closure := g.bind("call ptr @rt_callee(i64 %s, ptr %s, i32 %d, ptr %s)", callee, g.cstr(n.Name), len(n.Args), g.loc(n.Location))
+	args := []string{"ptr " + closure}
+	for _, arg := range n.Args {
+		args = append(args, "i64 "+g.term(arg))
+	}
+	return g.bind("load ptr, ptr %s", closure), strings.Join(args, ", ")
+}
+
+// call writes a call not in tail position, which rt_enter and rt_leave
+// count to report a stack overflow when calls nest too deep.
+func (g *generator) call(n closure.Call) string {
+	fn, args := g.callee(n)
+	g.emit("call void @rt_enter(ptr %s, ptr %s)", g.cstr(n.Name), g.loc(n.Location))
+	result := g.bind("call tailcc i64 %s(%s)", fn, args)
+	g.emit("call void @rt_leave()")
+	return result
+}
@@ -0,0 +1,85 @@
+package llvm_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/backend/internal/backendtest"
+	"github.com/ghhernandes/rinha-compiler-go/backend/llvm"
+	"github.com/ghhernandes/rinha-compiler-go/parser"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// programs are the programs run by this backend besides the shared ones.
+var programs = []backendtest.Program{
+	{Name: "fib", Src: `let fib = fn (n) => { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; print(fib(46))`},
+	{Name: "nested conditions", Src: `let f = fn (a, b) => { if (a) { if (b) { 1 } else { 2 } } else { 3 } }; print((f(true, false), f(false, true)))`},
+	{Name: "escapes", Src: `print("quote \" backslash \\ é")`},
+}
+
+func examples(t *testing.T) []string {
+	files, err := filepath.Glob("../../files/*.rinha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestGolden(t *testing.T) {
+	for _, name := range examples(t) {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			src, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file, err := parser.ParseString(filepath.Join("files", filepath.Base(name)), string(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got bytes.Buffer
+			if err := llvm.Generate(&got, file, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", strings.TrimSuffix(filepath.Base(name), ".rinha")+".ll")
+			if *update {
+				if err := os.WriteFile(golden, got.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != string(want) {
+				t.Errorf("generated IR differs from %s; run go test -update to accept it:\n%s", golden, got.String())
+			}
+		})
+	}
+}
+
+func TestCompiledProgramsMatchInterpreter(t *testing.T) {
+	if !llvm.Available() {
+		t.Skip("no LLVM toolchain available")
+	}
+
+	tests := append(append(append(append(backendtest.Programs, backendtest.Recursion...), backendtest.Unbound...), programs...), backendtest.Examples(t)...)
+	backendtest.MatchInterpreter(t, tests, func(t *testing.T, file *ast.File, path string) *exec.Cmd {
+		if err := llvm.Build(file, nil, path); err != nil {
+			t.Fatal(err)
+		}
+		return exec.Command(path)
+	})
+}
+
+func TestGenerateErrors(t *testing.T) {
+	backendtest.GenerateErrors(t, llvm.Generate)
+}
@@ -0,0 +1,498 @@
+package llvm
+
+// runtime is the C runtime generated programs are linked with. Values are
+// 64 bit words: Ints and Bools keep their payload in the high 32 bits, and
+// Strs, tuples and closures are pointers to the heap, or to constants for
+// string literals, with the tag in their low bits. Nothing is ever freed.
+// Operations check their operands like interpreter.Binary does and report
+// the same messages, and calls nest as deep as in the interpreter.
+const runtime = `#include <inttypes.h>
+#include <pthread.h>
+#include <stdarg.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+typedef uint64_t Value;
+
+enum { RT_INT, RT_STR, RT_BOOL, RT_TUPLE, RT_CLOSURE, RT_TAG_MASK = 7 };
+
+typedef struct {
+	uint64_t len;
+	char data[];
+} Str;
+
+typedef struct {
+	Value first;
+	Value second;
+} Tuple;
+
+typedef struct Memo Memo;
+
+/* The generated code reads fn and the captures, so their layout is fixed:
+   fn at offset 0 and the captures from offset 24. */
+typedef struct {
+	void *fn;
+	int32_t arity;
+	int32_t ncaptures;
+	Memo *memo;
+	Value captures[];
+} Closure;
+
+static const char *rt_kinds[] = {"Int", "Str", "Bool", "Tuple", "Closure"};
+
+static int rt_tag(Value v) {
+	return v & RT_TAG_MASK;
+}
+
+static int32_t rt_as_int(Value v) {
+	return (int32_t)(uint32_t)(v >> 32);
+}
+
+static int rt_as_bool(Value v) {
+	return (int)(v >> 32);
+}
+
+static void *rt_as_ptr(Value v) {
+	return (void *)(uintptr_t)(v & ~(Value)RT_TAG_MASK);
+}
+
+static Value rt_int(int32_t i) {
+	return (Value)(uint32_t)i << 32 | RT_INT;
+}
+
+static Value rt_bool(int b) {
+	return (Value)(b != 0) << 32 | RT_BOOL;
+}
+
+static Value rt_ptr(const void *p, int tag) {
+	return (Value)(uintptr_t)p | tag;
+}
+
+static void rt_fail(const char *loc, const char *format, ...) {
+	va_list args;
+	fflush(stdout);
+	fputs("error: ", stderr);
+	va_start(args, format);
+	vfprintf(stderr, format, args);
+	va_end(args);
+	fprintf(stderr, "\n --> %s\n", loc);
+	exit(1);
+}
+
+static void *rt_alloc(size_t size) {
+	void *p = malloc(size);
+	if (p == NULL) {
+		fputs("error: out of memory\n", stderr);
+		exit(1);
+	}
+	return p;
+}
+
+/* Output */
+
+static void rt_write(Value v) {
+	switch (rt_tag(v)) {
+	case RT_INT:
+		printf("%" PRId32, rt_as_int(v));
+		break;
+	case RT_STR: {
+		const Str *s = rt_as_ptr(v);
+		fwrite(s->data, 1, s->len, stdout);
+		break;
+	}
+	case RT_BOOL:
+		fputs(rt_as_bool(v) ? "true" : "false", stdout);
+		break;
+	case RT_TUPLE: {
+		const Tuple *t = rt_as_ptr(v);
+		fputc('(', stdout);
+		rt_write(t->first);
+		fputs(", ", stdout);
+		rt_write(t->second);
+		fputc(')', stdout);
+		break;
+	}
+	default:
+		fputs("<#closure>", stdout);
+		break;
+	}
+}
+
+Value rt_print(Value v) {
+	rt_write(v);
+	fputc('\n', stdout);
+	return v;
+}
+
+/* Operators */
+
+static void rt_mismatch(const char *loc, const char *op, Value l, Value r) {
+	rt_fail(loc, "invalid operands for %s: %s and %s", op, rt_kinds[rt_tag(l)], rt_kinds[rt_tag(r)]);
+}
+
+static void rt_ints(const char *loc, const char *op, Value l, Value r) {
+	if (rt_tag(l) != RT_INT || rt_tag(r) != RT_INT) {
+		rt_mismatch(loc, op, l, r);
+	}
+}
+
+static const Str *rt_to_str(Value v) {
+	if (rt_tag(v) == RT_STR) {
+		return rt_as_ptr(v);
+	}
+	char buf[16];
+	int n = snprintf(buf, sizeof buf, "%" PRId32, rt_as_int(v));
+	Str *s = rt_alloc(sizeof(Str) + n);
+	memcpy(s->data, buf, n);
+	s->len = n;
+	return s;
+}
+
+static Value rt_concat(const Str *a, const Str *b) {
+	Str *s = rt_alloc(sizeof(Str) + a->len + b->len);
+	memcpy(s->data, a->data, a->len);
+	memcpy(s->data + a->len, b->data, b->len);
+	s->len = a->len + b->len;
+	return rt_ptr(s, RT_STR);
+}
+
+/* rt_add follows interpreter.add: Int + Int is an Int, and any other mix of
+   Int and Str concatenates. Arithmetic wraps around like Go's int32, which C
+   leaves undefined for signed integers, so it is done on unsigned ones. */
+Value rt_add(Value l, Value r, const char *loc) {
+	if (rt_tag(l) == RT_INT && rt_tag(r) == RT_INT) {
+		return rt_int((int32_t)((uint32_t)rt_as_int(l) + (uint32_t)rt_as_int(r)));
+	}
+	if (rt_tag(l) <= RT_STR && rt_tag(r) <= RT_STR) {
+		return rt_concat(rt_to_str(l), rt_to_str(r));
+	}
+	rt_mismatch(loc, "Add", l, r);
+	return l;
+}
+
+Value rt_sub(Value l, Value r, const char *loc) {
+	rt_ints(loc, "Sub", l, r);
+	return rt_int((int32_t)((uint32_t)rt_as_int(l) - (uint32_t)rt_as_int(r)));
+}
+
+Value rt_mul(Value l, Value r, const char *loc) {
+	rt_ints(loc, "Mul", l, r);
+	return rt_int((int32_t)((uint32_t)rt_as_int(l) * (uint32_t)rt_as_int(r)));
+}
+
+Value rt_div(Value l, Value r, const char *loc) {
+	rt_ints(loc, "Div", l, r);
+	if (rt_as_int(r) == 0) {
+		rt_fail(loc, "division by zero");
+	}
+	if (rt_as_int(r) == -1) {
+		return rt_int((int32_t)-(uint32_t)rt_as_int(l));
+	}
+	return rt_int(rt_as_int(l) / rt_as_int(r));
+}
+
+Value rt_rem(Value l, Value r, const char *loc) {
+	rt_ints(loc, "Rem", l, r);
+	if (rt_as_int(r) == 0) {
+		rt_fail(loc, "division by zero");
+	}
+	if (rt_as_int(r) == -1) {
+		return rt_int(0);
+	}
+	return rt_int(rt_as_int(l) % rt_as_int(r));
+}
+
+static int rt_strcmp(const Str *a, const Str *b) {
+	size_t n = a->len < b->len ? a->len : b->len;
+	int c = memcmp(a->data, b->data, n);
+	if (c != 0) {
+		return c < 0 ? -1 : 1;
+	}
+	if (a->len != b->len) {
+		return a->len < b->len ? -1 : 1;
+	}
+	return 0;
+}
+
+static int rt_equal(const char *loc, const char *op, Value l, Value r) {
+	if (rt_tag(l) == rt_tag(r)) {
+		switch (rt_tag(l)) {
+		case RT_INT:
+		case RT_BOOL:
+			return l == r;
+		case RT_STR:
+			return rt_strcmp(rt_as_ptr(l), rt_as_ptr(r)) == 0;
+		}
+	}
+	rt_mismatch(loc, op, l, r);
+	return 0;
+}
+
+static int rt_compare(const char *loc, const char *op, Value l, Value r) {
+	if (rt_tag(l) == RT_INT && rt_tag(r) == RT_INT) {
+		return rt_as_int(l) < rt_as_int(r) ? -1 : rt_as_int(l) > rt_as_int(r);
+	}
+	if (rt_tag(l) == RT_STR && rt_tag(r) == RT_STR) {
+		return rt_strcmp(rt_as_ptr(l), rt_as_ptr(r));
+	}
+	rt_mismatch(loc, op, l, r);
+	return 0;
+}
+
+static void rt_bools(const char *loc, const char *op, Value l, Value r) {
+	if (rt_tag(l) != RT_BOOL || rt_tag(r) != RT_BOOL) {
+		rt_mismatch(loc, op, l, r);
+	}
+}
+
+Value rt_eq(Value l, Value r, const char *loc) {
+	return rt_bool(rt_equal(loc, "Eq", l, r));
+}
+
+Value rt_neq(Value l, Value r, const char *loc) {
+	return rt_bool(!rt_equal(loc, "Neq", l, r));
+}
+
+Value rt_lt(Value l, Value r, const char *loc) {
+	return rt_bool(rt_compare(loc, "Lt", l, r) < 0);
+}
+
+Value rt_lte(Value l, Value r, const char *loc) {
+	return rt_bool(rt_compare(loc, "Lte", l, r) <= 0);
+}
+
+Value rt_gt(Value l, Value r, const char *loc) {
+	return rt_bool(rt_compare(loc, "Gt", l, r) > 0);
+}
+
+Value rt_gte(Value l, Value r, const char *loc) {
+	return rt_bool(rt_compare(loc, "Gte", l, r) >= 0);
+}
+
+Value rt_and(Value l, Value r, const char *loc) {
+	rt_bools(loc, "And", l, r);
+	return rt_bool(rt_as_bool(l) && rt_as_bool(r));
+}
+
+Value rt_or(Value l, Value r, const char *loc) {
+	rt_bools(loc, "Or", l, r);
+	return rt_bool(rt_as_bool(l) || rt_as_bool(r));
+}
+
+int32_t rt_cond(Value v, const char *loc) {
+	if (rt_tag(v) != RT_BOOL) {
+		rt_fail(loc, "condition must be a Bool");
+	}
+	return rt_as_bool(v);
+}
+
+/* Tuples */
+
+Value rt_tuple(Value first, Value second) {
+	Tuple *t = rt_alloc(sizeof(Tuple));
+	t->first = first;
+	t->second = second;
+	return rt_ptr(t, RT_TUPLE);
+}
+
+static const Tuple *rt_as_tuple(Value v, const char *loc) {
+	if (rt_tag(v) != RT_TUPLE) {
+		rt_fail(loc, "not a tuple");
+	}
+	return rt_as_ptr(v);
+}
+
+Value rt_first(Value v, const char *loc) {
+	return rt_as_tuple(v, loc)->first;
+}
+
+Value rt_second(Value v, const char *loc) {
+	return rt_as_tuple(v, loc)->second;
+}
+
+/* rt_undefined fails on reading a variable bound nowhere, which is only an
+   error once it is evaluated. */
+Value rt_undefined(const char *name, const char *loc) {
+	rt_fail(loc, "undefined variable %s", name);
+	return rt_int(0);
+}
+
+/* Closures */
+
+static Memo *rt_memo_new(void);
+
+/* rt_closure allocates a closure; the caller stores its captures. Closures
+   are aligned like every malloc result, leaving room for the tag. */
+Closure *rt_closure(void *fn, int32_t arity, int32_t pure, int32_t ncaptures) {
+	Closure *c = rt_alloc(sizeof(Closure) + ncaptures * sizeof(Value));
+	c->fn = fn;
+	c->arity = arity;
+	c->ncaptures = ncaptures;
+	c->memo = pure ? rt_memo_new() : NULL;
+	return c;
+}
+
+/* rt_callee checks a call before its arguments are evaluated. */
+Closure *rt_callee(Value callee, const char *name, int32_t argc, const char *loc) {
+	if (rt_tag(callee) != RT_CLOSURE) {
+		rt_fail(loc, "cannot call a %s", rt_kinds[rt_tag(callee)]);
+	}
+	Closure *c = rt_as_ptr(callee);
+	if (c->arity != argc) {
+		rt_fail(loc, "wrong number of arguments: %s expects %" PRId32 ", got %" PRId32, name, c->arity, argc);
+	}
+	return c;
+}
+
+/* Memoization: pure functions look their arguments up in an open
+   addressing table of their closure before running, and store their result
+   after. Strings compare by content; everything else by its bits, so
+   tuples and closures by identity. */
+
+typedef struct {
+	uint64_t hash;
+	Value *args;
+	Value result;
+} Entry;
+
+struct Memo {
+	Entry *entries;
+	size_t cap;
+	size_t len;
+};
+
+static Memo *rt_memo_new(void) {
+	Memo *m = rt_alloc(sizeof(Memo));
+	m->cap = 16;
+	m->len = 0;
+	m->entries = rt_alloc(m->cap * sizeof(Entry));
+	memset(m->entries, 0, m->cap * sizeof(Entry));
+	return m;
+}
+
+static uint64_t rt_mix(uint64_t h, uint64_t x) {
+	h ^= x;
+	h *= 1099511628211ULL;
+	h ^= h >> 32;
+	return h;
+}
+
+static uint64_t rt_hash(const Value *args, int argc) {
+	uint64_t h = 14695981039346656037ULL;
+	for (int i = 0; i < argc; i++) {
+		if (rt_tag(args[i]) == RT_STR) {
+			const Str *s = rt_as_ptr(args[i]);
+			for (size_t j = 0; j < s->len; j++) {
+				h = rt_mix(h, (unsigned char)s->data[j]);
+			}
+		} else {
+			h = rt_mix(h, args[i]);
+		}
+	}
+	return h | 1;
+}
+
+static int rt_same(const Value *a, const Value *b, int argc) {
+	for (int i = 0; i < argc; i++) {
+		if (a[i] == b[i]) {
+			continue;
+		}
+		if (rt_tag(a[i]) != RT_STR || rt_tag(b[i]) != RT_STR || rt_strcmp(rt_as_ptr(a[i]), rt_as_ptr(b[i])) != 0) {
+			return 0;
+		}
+	}
+	return 1;
+}
+
+static Entry *rt_memo_find(Memo *m, uint64_t hash, const Value *args, int argc) {
+	size_t i = hash & (m->cap - 1);
+	for (;;) {
+		Entry *e = &m->entries[i];
+		if (e->hash == 0 || (e->hash == hash && rt_same(e->args, args, argc))) {
+			return e;
+		}
+		i = (i + 1) & (m->cap - 1);
+	}
+}
+
+static void rt_memo_grow(Memo *m, int argc) {
+	Entry *old = m->entries;
+	size_t cap = m->cap;
+	m->cap *= 2;
+	m->entries = rt_alloc(m->cap * sizeof(Entry));
+	memset(m->entries, 0, m->cap * sizeof(Entry));
+	for (size_t i = 0; i < cap; i++) {
+		if (old[i].hash != 0) {
+			*rt_memo_find(m, old[i].hash, old[i].args, argc) = old[i];
+		}
+	}
+	free(old);
+}
+
+/* rt_memo_get returns the memoized result of calling c with args, or NULL. */
+Value *rt_memo_get(Closure *c, const Value *args) {
+	Entry *e = rt_memo_find(c->memo, rt_hash(args, c->arity), args, c->arity);
+	return e->hash != 0 ? &e->result : NULL;
+}
+
+void rt_memo_put(Closure *c, const Value *args, Value result) {
+	Memo *m = c->memo;
+	if (2 * (m->len + 1) > m->cap) {
+		rt_memo_grow(m, c->arity);
+	}
+	uint64_t hash = rt_hash(args, c->arity);
+	Entry *e = rt_memo_find(m, hash, args, c->arity);
+	if (e->hash == 0) {
+		m->len++;
+	}
+	e->hash = hash;
+	e->args = rt_alloc(c->arity * sizeof(Value) + 1);
+	memcpy(e->args, args, c->arity * sizeof(Value));
+	e->result = result;
+}
+
+/* Calls */
+
+#define RT_MAX_DEPTH 100000
+
+static int rt_depth;
+
+/* rt_enter and rt_leave surround every call not in tail position. */
+void rt_enter(const char *name, const char *loc) {
+	if (rt_depth >= RT_MAX_DEPTH) {
+		rt_fail(loc, "stack overflow: calls to %s nested more than %d deep", name, RT_MAX_DEPTH);
+	}
+	rt_depth++;
+}
+
+void rt_leave(void) {
+	rt_depth--;
+}
+
+/* program is the generated code. It runs on a thread with a stack of
+   RT_STACK_SIZE, enough for RT_MAX_DEPTH nested calls, or on the main
+   thread when that cannot be created. Only the pages used are allocated. */
+#define RT_STACK_SIZE ((size_t)1 << 30)
+
+void program(void);
+
+static void *rt_run(void *arg) {
+	(void)arg;
+	program();
+	return NULL;
+}
+
+int main(void) {
+	pthread_attr_t attr;
+	pthread_t thread;
+	if (pthread_attr_init(&attr) == 0 && pthread_attr_setstacksize(&attr, RT_STACK_SIZE) == 0 &&
+		pthread_create(&thread, &attr, rt_run, NULL) == 0) {
+		pthread_join(thread, NULL);
+	} else {
+		program();
+	}
+	return 0;
+}
+`
@@ -0,0 +1,145 @@
+package wasm
+
+import "fmt"
+
+// asm appends instructions to a function, resolving local and global names
+// as it goes. Calls are resolved by link once every function is defined.
+type asm struct {
+	g      *generator
+	m      *Module
+	fn     *Func
+	locals map[string]int
+}
+
+// function adds a function to the module and returns an asm writing its
+// body.
+func (g *generator) function(name string, params []Local, results ...ValType) *asm {
+	m := g.m
+	types := make([]ValType, len(params))
+	for i, p := range params {
+		types[i] = p.Type
+	}
+	fn := &Func{
+		Name:   name,
+		Type:   m.typeOf(FuncType{Params: types, Results: results}),
+		Params: params,
+		Result: results,
+	}
+	m.Funcs = append(m.Funcs, fn)
+
+	a := &asm{g: g, m: m, fn: fn, locals: make(map[string]int)}
+	for i, p := range params {
+		a.locals[p.Name] = i
+	}
+	return a
+}
+
+// link resolves the function names of calls to their indices.
+func (m *Module) link() {
+	indices := make(map[string]int)
+	for i := range m.Imports {
+		indices[m.Imports[i].Func] = i
+	}
+	for i, fn := range m.Funcs {
+		indices[fn.Name] = len(m.Imports) + i
+	}
+	for _, fn := range m.Funcs {
+		for i, in := range fn.Body {
+			if in.Op != OpCall {
+				continue
+			}
+			index, ok := indices[in.Name]
+			if !ok {
+				panic(fmt.Sprintf("wasm: call to undefined function %s", in.Name))
+			}
+			fn.Body[i].Imm = int64(index)
+		}
+	}
+	for i, exp := range m.Exports {
+		if exp.Kind == 0 && exp.Index < 0 {
+			m.Exports[i].Index = indices[exp.Name]
+		}
+	}
+}
+
+func (a *asm) local(name string, t ValType) string {
+	if _, ok := a.locals[name]; ok {
+		panic(fmt.Sprintf("wasm: local %s redeclared in %s", name, a.fn.Name))
+	}
+	a.locals[name] = len(a.fn.Params) + len(a.fn.Locals)
+	a.fn.Locals = append(a.fn.Locals, Local{Name: name, Type: t})
+	return name
+}
+
+func (a *asm) emit(in Instr) {
+	a.fn.Body = append(a.fn.Body, in)
+}
+
+func (a *asm) op(ops ...Op) {
+	for _, op := range ops {
+		a.emit(Instr{Op: op})
+	}
+}
+
+func (a *asm) index(op Op, name string) {
+	index, ok := a.locals[name]
+	if !ok {
+		panic(fmt.Sprintf("wasm: undefined local %s in %s", name, a.fn.Name))
+	}
+	a.emit(Instr{Op: op, Imm: int64(index), Name: name})
+}
+
+func (a *asm) get(name string) { a.index(OpLocalGet, name) }
+func (a *asm) set(name string) { a.index(OpLocalSet, name) }
+func (a *asm) tee(name string) { a.index(OpLocalTee, name) }
+
+func (a *asm) global(op Op, name string) {
+	for i, g := range a.m.Globals {
+		if g.Name == name {
+			a.emit(Instr{Op: op, Imm: int64(i), Name: name})
+			return
+		}
+	}
+	panic(fmt.Sprintf("wasm: undefined global %s", name))
+}
+
+func (a *asm) i32(n int32) { a.emit(Instr{Op: OpI32Const, Imm: int64(n)}) }
+func (a *asm) i64(n int64) { a.emit(Instr{Op: OpI64Const, Imm: n}) }
+
+func (a *asm) call(name string) { a.emit(Instr{Op: OpCall, Name: name}) }
+
+func (a *asm) mem(op Op, offset int32) { a.emit(Instr{Op: op, Imm: int64(offset)}) }
+
+// begin opens a block, loop or if whose result has type t, or none when t
+// is 0.
+func (a *asm) begin(op Op, t ValType) { a.emit(Instr{Op: op, Block: t}) }
+func (a *asm) br(op Op, depth int)    { a.emit(Instr{Op: op, Imm: int64(depth)}) }
+
+// Values are i64s holding a tag in the low bits and a 32 bit payload, an
+// Int, a Bool or the address of a heap object, in the high ones.
+
+// tag pushes the tag of the value in local v.
+func (a *asm) tag(v string) {
+	a.get(v)
+	a.op(OpI32WrapI64)
+	a.i32(tagMask)
+	a.op(OpI32And)
+}
+
+// payload pushes the payload of the value in local v.
+func (a *asm) payload(v string) {
+	a.get(v)
+	a.i64(32)
+	a.op(OpI64ShrU, OpI32WrapI64)
+}
+
+// box turns the i32 payload on the stack into a value with the given tag.
+func (a *asm) box(tag int64) {
+	a.op(OpI64ExtendI32U)
+	a.i64(32)
+	a.op(OpI64Shl)
+	if tag != tagInt {
+		a.i64(tag)
+		a.op(OpI64Or)
+	}
+}
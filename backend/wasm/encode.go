@@ -0,0 +1,221 @@
+package wasm
+
+import (
+	"bytes"
+	"io"
+)
+
+// Section ids of the binary format.
+const (
+	sectionType     = 1
+	sectionImport   = 2
+	sectionFunction = 3
+	sectionTable    = 4
+	sectionMemory   = 5
+	sectionGlobal   = 6
+	sectionExport   = 7
+	sectionElem     = 9
+	sectionCode     = 10
+	sectionData     = 11
+)
+
+const funcref = 0x70
+
+// Magic and Version start every binary module.
+var (
+	Magic   = []byte{0x00, 'a', 's', 'm'}
+	Version = []byte{0x01, 0x00, 0x00, 0x00}
+)
+
+type encoder struct {
+	bytes.Buffer
+}
+
+func (e *encoder) u32(n uint32) {
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		if n != 0 {
+			b |= 0x80
+		}
+		e.WriteByte(b)
+		if n == 0 {
+			return
+		}
+	}
+}
+
+func (e *encoder) s64(n int64) {
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		done := (n == 0 && b&0x40 == 0) || (n == -1 && b&0x40 != 0)
+		if !done {
+			b |= 0x80
+		}
+		e.WriteByte(b)
+		if done {
+			return
+		}
+	}
+}
+
+func (e *encoder) name(s string) {
+	e.u32(uint32(len(s)))
+	e.WriteString(s)
+}
+
+func (e *encoder) types(ts []ValType) {
+	e.u32(uint32(len(ts)))
+	for _, t := range ts {
+		e.WriteByte(byte(t))
+	}
+}
+
+// section writes a section whose contents are written by body, prefixed by
+// their size.
+func (e *encoder) section(id byte, count int, body func(e *encoder)) {
+	if count == 0 {
+		return
+	}
+	var contents encoder
+	contents.u32(uint32(count))
+	body(&contents)
+	e.WriteByte(id)
+	e.u32(uint32(contents.Len()))
+	e.Write(contents.Bytes())
+}
+
+func (e *encoder) instr(in Instr) {
+	e.WriteByte(in.Op.Code)
+	switch in.Op.imm {
+	case immIndex:
+		e.u32(uint32(in.Imm))
+	case immI32, immI64:
+		e.s64(in.Imm)
+	case immBlock:
+		if in.Block == 0 {
+			e.WriteByte(0x40)
+		} else {
+			e.WriteByte(byte(in.Block))
+		}
+	case immMem:
+		e.u32(in.Op.align)
+		e.u32(uint32(in.Imm))
+	case immCallIndirect:
+		e.u32(uint32(in.Imm))
+		e.WriteByte(0x00)
+	case immMemory:
+		e.WriteByte(0x00)
+	}
+}
+
+// WriteBinary writes m in the binary format.
+func (m *Module) WriteBinary(w io.Writer) error {
+	var e encoder
+	e.Write(Magic)
+	e.Write(Version)
+
+	e.section(sectionType, len(m.Types), func(e *encoder) {
+		for _, t := range m.Types {
+			e.WriteByte(0x60)
+			e.types(t.Params)
+			e.types(t.Results)
+		}
+	})
+	e.section(sectionImport, len(m.Imports), func(e *encoder) {
+		for _, imp := range m.Imports {
+			e.name(imp.Module)
+			e.name(imp.Name)
+			e.WriteByte(0x00)
+			e.u32(uint32(imp.Type))
+		}
+	})
+	e.section(sectionFunction, len(m.Funcs), func(e *encoder) {
+		for _, fn := range m.Funcs {
+			e.u32(uint32(fn.Type))
+		}
+	})
+	e.section(sectionTable, 1, func(e *encoder) {
+		e.WriteByte(funcref)
+		e.WriteByte(0x00)
+		e.u32(uint32(len(m.Table)))
+	})
+	e.section(sectionMemory, 1, func(e *encoder) {
+		e.WriteByte(0x00)
+		e.u32(uint32(m.Memory))
+	})
+	e.section(sectionGlobal, len(m.Globals), func(e *encoder) {
+		for _, g := range m.Globals {
+			e.WriteByte(byte(g.Type))
+			if g.Mutable {
+				e.WriteByte(0x01)
+			} else {
+				e.WriteByte(0x00)
+			}
+			if g.Type == I64 {
+				e.instr(Instr{Op: OpI64Const, Imm: g.Init})
+			} else {
+				e.instr(Instr{Op: OpI32Const, Imm: g.Init})
+			}
+			e.instr(Instr{Op: OpEnd})
+		}
+	})
+	e.section(sectionExport, len(m.Exports), func(e *encoder) {
+		for _, exp := range m.Exports {
+			e.name(exp.Name)
+			e.WriteByte(exp.Kind)
+			e.u32(uint32(exp.Index))
+		}
+	})
+	segments := 0
+	if len(m.Table) > 0 {
+		segments = 1
+	}
+	e.section(sectionElem, segments, func(e *encoder) {
+		e.u32(0)
+		e.instr(Instr{Op: OpI32Const, Imm: 0})
+		e.instr(Instr{Op: OpEnd})
+		e.u32(uint32(len(m.Table)))
+		for _, index := range m.Table {
+			e.u32(uint32(index))
+		}
+	})
+	e.section(sectionCode, len(m.Funcs), func(e *encoder) {
+		for _, fn := range m.Funcs {
+			var body encoder
+			// Locals are declared in runs of the same type.
+			var runs [][2]int
+			for _, l := range fn.Locals {
+				if n := len(runs); n > 0 && runs[n-1][1] == int(l.Type) {
+					runs[n-1][0]++
+				} else {
+					runs = append(runs, [2]int{1, int(l.Type)})
+				}
+			}
+			body.u32(uint32(len(runs)))
+			for _, run := range runs {
+				body.u32(uint32(run[0]))
+				body.WriteByte(byte(run[1]))
+			}
+			for _, in := range fn.Body {
+				body.instr(in)
+			}
+			body.instr(Instr{Op: OpEnd})
+			e.u32(uint32(body.Len()))
+			e.Write(body.Bytes())
+		}
+	})
+	e.section(sectionData, len(m.Data), func(e *encoder) {
+		for _, d := range m.Data {
+			e.u32(0)
+			e.instr(Instr{Op: OpI32Const, Imm: int64(d.Offset)})
+			e.instr(Instr{Op: OpEnd})
+			e.u32(uint32(len(d.Bytes)))
+			e.Write(d.Bytes)
+		}
+	})
+
+	_, err := w.Write(e.Bytes())
+	return err
+}
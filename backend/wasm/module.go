@@ -0,0 +1,212 @@
+package wasm
+
+import "fmt"
+
+type ValType byte
+
+const (
+	I32 ValType = 0x7f
+	I64 ValType = 0x7e
+)
+
+func (t ValType) String() string {
+	switch t {
+	case I32:
+		return "i32"
+	case I64:
+		return "i64"
+	}
+	return fmt.Sprintf("valtype(%#x)", byte(t))
+}
+
+// immediate describes the operands that follow an opcode.
+type immediate int
+
+const (
+	immNone immediate = iota
+	immIndex
+	immI32
+	immI64
+	immBlock
+	// immMem is a memory access: Imm is the offset, the alignment is
+	// implied by the opcode.
+	immMem
+	immCallIndirect
+	immMemory
+)
+
+type Op struct {
+	Name  string
+	Code  byte
+	imm   immediate
+	align uint32
+}
+
+var (
+	OpUnreachable   = Op{"unreachable", 0x00, immNone, 0}
+	OpBlock         = Op{"block", 0x02, immBlock, 0}
+	OpLoop          = Op{"loop", 0x03, immBlock, 0}
+	OpIf            = Op{"if", 0x04, immBlock, 0}
+	OpElse          = Op{"else", 0x05, immNone, 0}
+	OpEnd           = Op{"end", 0x0b, immNone, 0}
+	OpBr            = Op{"br", 0x0c, immIndex, 0}
+	OpBrIf          = Op{"br_if", 0x0d, immIndex, 0}
+	OpReturn        = Op{"return", 0x0f, immNone, 0}
+	OpCall          = Op{"call", 0x10, immIndex, 0}
+	OpCallIndirect  = Op{"call_indirect", 0x11, immCallIndirect, 0}
+	OpDrop          = Op{"drop", 0x1a, immNone, 0}
+	OpSelect        = Op{"select", 0x1b, immNone, 0}
+	OpLocalGet      = Op{"local.get", 0x20, immIndex, 0}
+	OpLocalSet      = Op{"local.set", 0x21, immIndex, 0}
+	OpLocalTee      = Op{"local.tee", 0x22, immIndex, 0}
+	OpGlobalGet     = Op{"global.get", 0x23, immIndex, 0}
+	OpGlobalSet     = Op{"global.set", 0x24, immIndex, 0}
+	OpI32Load       = Op{"i32.load", 0x28, immMem, 2}
+	OpI64Load       = Op{"i64.load", 0x29, immMem, 3}
+	OpI32Load8U     = Op{"i32.load8_u", 0x2d, immMem, 0}
+	OpI32Store      = Op{"i32.store", 0x36, immMem, 2}
+	OpI64Store      = Op{"i64.store", 0x37, immMem, 3}
+	OpI32Store8     = Op{"i32.store8", 0x3a, immMem, 0}
+	OpMemorySize    = Op{"memory.size", 0x3f, immMemory, 0}
+	OpMemoryGrow    = Op{"memory.grow", 0x40, immMemory, 0}
+	OpI32Const      = Op{"i32.const", 0x41, immI32, 0}
+	OpI64Const      = Op{"i64.const", 0x42, immI64, 0}
+	OpI32Eqz        = Op{"i32.eqz", 0x45, immNone, 0}
+	OpI32Eq         = Op{"i32.eq", 0x46, immNone, 0}
+	OpI32Ne         = Op{"i32.ne", 0x47, immNone, 0}
+	OpI32LtS        = Op{"i32.lt_s", 0x48, immNone, 0}
+	OpI32LtU        = Op{"i32.lt_u", 0x49, immNone, 0}
+	OpI32GtS        = Op{"i32.gt_s", 0x4a, immNone, 0}
+	OpI32GtU        = Op{"i32.gt_u", 0x4b, immNone, 0}
+	OpI32LeS        = Op{"i32.le_s", 0x4c, immNone, 0}
+	OpI32LeU        = Op{"i32.le_u", 0x4d, immNone, 0}
+	OpI32GeS        = Op{"i32.ge_s", 0x4e, immNone, 0}
+	OpI32GeU        = Op{"i32.ge_u", 0x4f, immNone, 0}
+	OpI64Eqz        = Op{"i64.eqz", 0x50, immNone, 0}
+	OpI64Eq         = Op{"i64.eq", 0x51, immNone, 0}
+	OpI64Ne         = Op{"i64.ne", 0x52, immNone, 0}
+	OpI64LtS        = Op{"i64.lt_s", 0x53, immNone, 0}
+	OpI32Add        = Op{"i32.add", 0x6a, immNone, 0}
+	OpI32Sub        = Op{"i32.sub", 0x6b, immNone, 0}
+	OpI32Mul        = Op{"i32.mul", 0x6c, immNone, 0}
+	OpI32DivS       = Op{"i32.div_s", 0x6d, immNone, 0}
+	OpI32DivU       = Op{"i32.div_u", 0x6e, immNone, 0}
+	OpI32RemS       = Op{"i32.rem_s", 0x6f, immNone, 0}
+	OpI32RemU       = Op{"i32.rem_u", 0x70, immNone, 0}
+	OpI32And        = Op{"i32.and", 0x71, immNone, 0}
+	OpI32Or         = Op{"i32.or", 0x72, immNone, 0}
+	OpI32Shl        = Op{"i32.shl", 0x74, immNone, 0}
+	OpI32ShrU       = Op{"i32.shr_u", 0x76, immNone, 0}
+	OpI64Sub        = Op{"i64.sub", 0x7d, immNone, 0}
+	OpI64DivU       = Op{"i64.div_u", 0x80, immNone, 0}
+	OpI64RemU       = Op{"i64.rem_u", 0x82, immNone, 0}
+	OpI64And        = Op{"i64.and", 0x83, immNone, 0}
+	OpI64Or         = Op{"i64.or", 0x84, immNone, 0}
+	OpI64Shl        = Op{"i64.shl", 0x86, immNone, 0}
+	OpI64ShrS       = Op{"i64.shr_s", 0x87, immNone, 0}
+	OpI64ShrU       = Op{"i64.shr_u", 0x88, immNone, 0}
+	OpI32WrapI64    = Op{"i32.wrap_i64", 0xa7, immNone, 0}
+	OpI64ExtendI32S = Op{"i64.extend_i32_s", 0xac, immNone, 0}
+	OpI64ExtendI32U = Op{"i64.extend_i32_u", 0xad, immNone, 0}
+)
+
+// OpReturnCallIndirect is call_indirect replacing the frame of the caller,
+// from the tail call extension.
+var OpReturnCallIndirect = Op{"return_call_indirect", 0x13, immCallIndirect, 0}
+
+// Instr is a single instruction. Imm holds its immediate operand; Name is
+// the symbolic form of an index used in the text format. Block is the result
+// type of block, loop and if, or 0 for none.
+type Instr struct {
+	Op    Op
+	Imm   int64
+	Name  string
+	Block ValType
+}
+
+type FuncType struct {
+	Params  []ValType
+	Results []ValType
+}
+
+func (t FuncType) key() string {
+	return fmt.Sprint(t.Params, t.Results)
+}
+
+type Local struct {
+	Name string
+	Type ValType
+}
+
+type Func struct {
+	Name   string
+	Type   int
+	Params []Local
+	Result []ValType
+	Locals []Local
+	Body   []Instr
+}
+
+type Import struct {
+	Module string
+	Name   string
+	Func   string
+	Type   int
+}
+
+type Global struct {
+	Name    string
+	Type    ValType
+	Mutable bool
+	Init    int64
+}
+
+type Data struct {
+	Offset int32
+	Bytes  []byte
+}
+
+type Export struct {
+	Name string
+	// Kind is 0 for functions and 2 for memories.
+	Kind  byte
+	Index int
+}
+
+// Module is a WebAssembly module that can be written both in the binary and
+// the text format. Function indices count imports first.
+type Module struct {
+	Types   []FuncType
+	Imports []Import
+	Funcs   []*Func
+	// Table lists the functions reachable through call_indirect.
+	Table   []int
+	Memory  int
+	Globals []Global
+	Exports []Export
+	Data    []Data
+
+	types map[string]int
+}
+
+// typeOf returns the index of the function type, adding it if needed.
+func (m *Module) typeOf(t FuncType) int {
+	if m.types == nil {
+		m.types = make(map[string]int)
+	}
+	if index, ok := m.types[t.key()]; ok {
+		return index
+	}
+	index := len(m.Types)
+	m.Types = append(m.Types, t)
+	m.types[t.key()] = index
+	return index
+}
+
+// funcName returns the text name of the function with the given index.
+func (m *Module) funcName(index int) string {
+	if index < len(m.Imports) {
+		return m.Imports[index].Func
+	}
+	return m.Funcs[index-len(m.Imports)].Name
+}
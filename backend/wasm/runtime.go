@@ -0,0 +1,839 @@
+package wasm
+
+import "fmt"
+
+// Memory layout. Output is buffered at outAddr and handed to the host print
+// function when full, at the end of the program and before failing. Integers
+// are formatted backwards from scratchEnd. Static data follows, then the heap,
+// which is bump allocated and never freed.
+const (
+	outAddr    = 16
+	outSize    = 4096
+	scratchEnd = outAddr + outSize + 16
+	dataAddr   = scratchEnd
+	pageSize   = 1 << 16
+)
+
+// Value tags, in the order of value.Kind.
+const (
+	tagInt int64 = iota
+	tagStr
+	tagBool
+	tagTuple
+	tagClosure
+	tagMask = 7
+)
+
+// Heap objects. A Str is its length followed by its bytes, a tuple holds two
+// values, and a closure holds its table index, arity and number of captures
+// before the captured values.
+const (
+	closureArity    = 4
+	closureCaptures = 16
+)
+
+// maxDepth bounds nested calls like interpreter.DEFAULT_MAX_DEPTH does.
+const maxDepth = 100000
+
+var kinds = []string{"Int", "Str", "Bool", "Tuple", "Closure"}
+
+func params(names ...any) []Local {
+	locals := make([]Local, 0, len(names)/2)
+	for i := 0; i < len(names); i += 2 {
+		locals = append(locals, Local{Name: names[i].(string), Type: names[i+1].(ValType)})
+	}
+	return locals
+}
+
+// runtime defines the functions generated code calls. Operations check their
+// operands like interpreter.Binary does and fail with the same messages.
+func (g *generator) runtime() {
+	m := g.m
+	printType := m.typeOf(FuncType{Params: []ValType{I32, I32}})
+	m.Imports = []Import{
+		{Module: "rinha", Name: "print", Func: "host_print", Type: printType},
+		{Module: "rinha", Name: "fail", Func: "host_fail", Type: printType},
+	}
+	m.Globals = []Global{
+		{Name: "heap", Type: I32, Mutable: true},
+		{Name: "out", Type: I32, Mutable: true},
+		{Name: "depth", Type: I32, Mutable: true},
+	}
+
+	kindTable := make([]byte, 4*len(kinds))
+	for i, kind := range kinds {
+		putU32(kindTable[4*i:], uint32(g.str(kind)))
+	}
+	kindsAddr := g.data(kindTable)
+
+	// alloc returns size bytes of the heap, growing the memory if needed.
+	a := g.function("alloc", params("size", I32), I32)
+	a.local("ptr", I32)
+	a.global(OpGlobalGet, "heap")
+	a.tee("ptr")
+	a.get("size")
+	a.op(OpI32Add)
+	a.i32(7)
+	a.op(OpI32Add)
+	a.i32(-8)
+	a.op(OpI32And)
+	a.global(OpGlobalSet, "heap")
+	a.begin(OpBlock, 0)
+	a.global(OpGlobalGet, "heap")
+	a.op(OpMemorySize)
+	a.i32(16)
+	a.op(OpI32Shl, OpI32LeU)
+	a.br(OpBrIf, 0)
+	a.global(OpGlobalGet, "heap")
+	a.op(OpMemorySize)
+	a.i32(16)
+	a.op(OpI32Shl, OpI32Sub)
+	a.i32(pageSize - 1)
+	a.op(OpI32Add)
+	a.i32(16)
+	a.op(OpI32ShrU, OpMemoryGrow)
+	a.i32(-1)
+	a.op(OpI32Eq)
+	a.begin(OpIf, 0)
+	a.op(OpUnreachable)
+	a.op(OpEnd)
+	a.op(OpEnd)
+	a.get("ptr")
+
+	a = g.function("flush", nil)
+	a.global(OpGlobalGet, "out")
+	a.begin(OpIf, 0)
+	a.i32(outAddr)
+	a.global(OpGlobalGet, "out")
+	a.call("host_print")
+	a.i32(0)
+	a.global(OpGlobalSet, "out")
+	a.op(OpEnd)
+
+	a = g.function("out_byte", params("b", I32))
+	a.global(OpGlobalGet, "out")
+	a.i32(outSize)
+	a.op(OpI32Eq)
+	a.begin(OpIf, 0)
+	a.call("flush")
+	a.op(OpEnd)
+	a.global(OpGlobalGet, "out")
+	a.get("b")
+	a.mem(OpI32Store8, outAddr)
+	a.global(OpGlobalGet, "out")
+	a.i32(1)
+	a.op(OpI32Add)
+	a.global(OpGlobalSet, "out")
+
+	a = g.function("out_bytes", params("p", I32, "n", I32))
+	a.local("i", I32)
+	a.begin(OpBlock, 0)
+	a.begin(OpLoop, 0)
+	a.get("i")
+	a.get("n")
+	a.op(OpI32GeU)
+	a.br(OpBrIf, 1)
+	a.get("p")
+	a.get("i")
+	a.op(OpI32Add)
+	a.mem(OpI32Load8U, 0)
+	a.call("out_byte")
+	a.get("i")
+	a.i32(1)
+	a.op(OpI32Add)
+	a.set("i")
+	a.br(OpBr, 0)
+	a.op(OpEnd)
+	a.op(OpEnd)
+
+	a = g.function("out_str", params("s", I32))
+	a.get("s")
+	a.i32(4)
+	a.op(OpI32Add)
+	a.get("s")
+	a.mem(OpI32Load, 0)
+	a.call("out_bytes")
+
+	// itoa formats n backwards from scratchEnd and returns where it starts.
+	a = g.function("itoa", params("n", I32), I32)
+	a.local("x", I64)
+	a.local("p", I32)
+	a.local("neg", I32)
+	a.i32(scratchEnd)
+	a.set("p")
+	a.get("n")
+	a.op(OpI64ExtendI32S)
+	a.set("x")
+	a.get("x")
+	a.i64(0)
+	a.op(OpI64LtS)
+	a.tee("neg")
+	a.begin(OpIf, 0)
+	a.i64(0)
+	a.get("x")
+	a.op(OpI64Sub)
+	a.set("x")
+	a.op(OpEnd)
+	a.begin(OpLoop, 0)
+	a.get("p")
+	a.i32(1)
+	a.op(OpI32Sub)
+	a.tee("p")
+	a.get("x")
+	a.i64(10)
+	a.op(OpI64RemU, OpI32WrapI64)
+	a.i32('0')
+	a.op(OpI32Add)
+	a.mem(OpI32Store8, 0)
+	a.get("x")
+	a.i64(10)
+	a.op(OpI64DivU)
+	a.tee("x")
+	a.op(OpI64Eqz, OpI32Eqz)
+	a.br(OpBrIf, 0)
+	a.op(OpEnd)
+	a.get("neg")
+	a.begin(OpIf, 0)
+	a.get("p")
+	a.i32(1)
+	a.op(OpI32Sub)
+	a.tee("p")
+	a.i32('-')
+	a.mem(OpI32Store8, 0)
+	a.op(OpEnd)
+	a.get("p")
+
+	a = g.function("out_int", params("n", I32))
+	a.local("p", I32)
+	a.get("n")
+	a.call("itoa")
+	a.tee("p")
+	a.i32(scratchEnd)
+	a.get("p")
+	a.op(OpI32Sub)
+	a.call("out_bytes")
+
+	// write formats v like value.Value.String.
+	a = g.function("write", params("v", I64))
+	a.local("p", I32)
+	a.payload("v")
+	a.set("p")
+	a.tag("v")
+	a.op(OpI32Eqz)
+	a.begin(OpIf, 0)
+	a.get("p")
+	a.call("out_int")
+	a.op(OpReturn)
+	a.op(OpEnd)
+	a.tag("v")
+	a.i32(int32(tagStr))
+	a.op(OpI32Eq)
+	a.begin(OpIf, 0)
+	a.get("p")
+	a.call("out_str")
+	a.op(OpReturn)
+	a.op(OpEnd)
+	a.tag("v")
+	a.i32(int32(tagBool))
+	a.op(OpI32Eq)
+	a.begin(OpIf, 0)
+	a.i32(g.str("true"))
+	a.i32(g.str("false"))
+	a.get("p")
+	a.op(OpSelect)
+	a.call("out_str")
+	a.op(OpReturn)
+	a.op(OpEnd)
+	a.tag("v")
+	a.i32(int32(tagTuple))
+	a.op(OpI32Eq)
+	a.begin(OpIf, 0)
+	a.i32('(')
+	a.call("out_byte")
+	a.get("p")
+	a.mem(OpI64Load, 0)
+	a.call("write")
+	a.i32(g.str(", "))
+	a.call("out_str")
+	a.get("p")
+	a.mem(OpI64Load, 8)
+	a.call("write")
+	a.i32(')')
+	a.call("out_byte")
+	a.op(OpReturn)
+	a.op(OpEnd)
+	a.i32(g.str("<#closure>"))
+	a.call("out_str")
+
+	a = g.function("print", params("v", I64), I64)
+	a.get("v")
+	a.call("write")
+	a.i32('\n')
+	a.call("out_byte")
+	a.get("v")
+
+	a = g.function("kind", params("v", I64), I32)
+	a.tag("v")
+	a.i32(4)
+	a.op(OpI32Mul)
+	a.mem(OpI32Load, kindsAddr)
+
+	// Failures flush the output, write the message to the output buffer and
+	// hand it to the host fail function, which does not return.
+	a = g.function("fail_end", params("loc", I32))
+	a.i32(g.str("\n --> "))
+	a.call("out_str")
+	a.get("loc")
+	a.call("out_str")
+	a.i32(outAddr)
+	a.global(OpGlobalGet, "out")
+	a.call("host_fail")
+	a.op(OpUnreachable)
+
+	a = g.function("fail", params("msg", I32, "loc", I32))
+	a.call("flush")
+	a.get("msg")
+	a.call("out_str")
+	a.get("loc")
+	a.call("fail_end")
+
+	a = g.function("mismatch", params("op", I32, "l", I64, "r", I64, "loc", I32))
+	a.call("flush")
+	a.i32(g.str("invalid operands for "))
+	a.call("out_str")
+	a.get("op")
+	a.call("out_str")
+	a.i32(g.str(": "))
+	a.call("out_str")
+	a.get("l")
+	a.call("kind")
+	a.call("out_str")
+	a.i32(g.str(" and "))
+	a.call("out_str")
+	a.get("r")
+	a.call("kind")
+	a.call("out_str")
+	a.get("loc")
+	a.call("fail_end")
+
+	binary := params("l", I64, "r", I64, "loc", I32)
+	checked := params("op", I32, "l", I64, "r", I64, "loc", I32)
+
+	// ints fails unless both operands are Ints.
+	a = g.function("ints", checked)
+	a.tag("l")
+	a.tag("r")
+	a.op(OpI32Or)
+	a.begin(OpIf, 0)
+	a.mismatch("op")
+	a.op(OpEnd)
+
+	a = g.function("copy", params("dst", I32, "src", I32, "n", I32))
+	a.local("i", I32)
+	a.begin(OpBlock, 0)
+	a.begin(OpLoop, 0)
+	a.get("i")
+	a.get("n")
+	a.op(OpI32GeU)
+	a.br(OpBrIf, 1)
+	a.get("dst")
+	a.get("i")
+	a.op(OpI32Add)
+	a.get("src")
+	a.get("i")
+	a.op(OpI32Add)
+	a.mem(OpI32Load8U, 0)
+	a.mem(OpI32Store8, 0)
+	a.get("i")
+	a.i32(1)
+	a.op(OpI32Add)
+	a.set("i")
+	a.br(OpBr, 0)
+	a.op(OpEnd)
+	a.op(OpEnd)
+
+	// to_str returns the Str of an Int or Str value.
+	a = g.function("to_str", params("v", I64), I32)
+	a.local("p", I32)
+	a.local("n", I32)
+	a.local("s", I32)
+	a.tag("v")
+	a.i32(int32(tagStr))
+	a.op(OpI32Eq)
+	a.begin(OpIf, 0)
+	a.payload("v")
+	a.op(OpReturn)
+	a.op(OpEnd)
+	a.payload("v")
+	a.call("itoa")
+	a.set("p")
+	a.i32(scratchEnd)
+	a.get("p")
+	a.op(OpI32Sub)
+	a.set("n")
+	a.get("n")
+	a.i32(4)
+	a.op(OpI32Add)
+	a.call("alloc")
+	a.tee("s")
+	a.get("n")
+	a.mem(OpI32Store, 0)
+	a.get("s")
+	a.i32(4)
+	a.op(OpI32Add)
+	a.get("p")
+	a.get("n")
+	a.call("copy")
+	a.get("s")
+
+	a = g.function("concat", params("a", I32, "b", I32), I64)
+	a.local("la", I32)
+	a.local("lb", I32)
+	a.local("s", I32)
+	a.get("a")
+	a.mem(OpI32Load, 0)
+	a.set("la")
+	a.get("b")
+	a.mem(OpI32Load, 0)
+	a.set("lb")
+	a.get("la")
+	a.get("lb")
+	a.op(OpI32Add)
+	a.i32(4)
+	a.op(OpI32Add)
+	a.call("alloc")
+	a.tee("s")
+	a.get("la")
+	a.get("lb")
+	a.op(OpI32Add)
+	a.mem(OpI32Store, 0)
+	a.get("s")
+	a.i32(4)
+	a.op(OpI32Add)
+	a.get("a")
+	a.i32(4)
+	a.op(OpI32Add)
+	a.get("la")
+	a.call("copy")
+	a.get("s")
+	a.i32(4)
+	a.op(OpI32Add)
+	a.get("la")
+	a.op(OpI32Add)
+	a.get("b")
+	a.i32(4)
+	a.op(OpI32Add)
+	a.get("lb")
+	a.call("copy")
+	a.get("s")
+	a.box(tagStr)
+
+	// add follows interpreter.add: Int + Int is an Int, and any other mix of
+	// Int and Str concatenates.
+	a = g.function("add", binary, I64)
+	a.tag("l")
+	a.tag("r")
+	a.op(OpI32Or, OpI32Eqz)
+	a.begin(OpIf, 0)
+	a.payload("l")
+	a.payload("r")
+	a.op(OpI32Add)
+	a.box(tagInt)
+	a.op(OpReturn)
+	a.op(OpEnd)
+	a.tag("l")
+	a.i32(int32(tagStr))
+	a.op(OpI32LeU)
+	a.tag("r")
+	a.i32(int32(tagStr))
+	a.op(OpI32LeU)
+	a.op(OpI32And)
+	a.begin(OpIf, 0)
+	a.get("l")
+	a.call("to_str")
+	a.get("r")
+	a.call("to_str")
+	a.call("concat")
+	a.op(OpReturn)
+	a.op(OpEnd)
+	a.i32(g.str("Add"))
+	a.mismatch("")
+	a.op(OpUnreachable)
+
+	for _, op := range []struct {
+		name string
+		op   Op
+	}{{"Sub", OpI32Sub}, {"Mul", OpI32Mul}} {
+		a = g.function(lower(op.name), binary, I64)
+		a.ints(op.name)
+		a.payload("l")
+		a.payload("r")
+		a.op(op.op)
+		a.box(tagInt)
+	}
+
+	// Division by -1 is special cased, as i32.div_s traps on overflow where
+	// Go wraps around.
+	a = g.function("div", binary, I64)
+	a.ints("Div")
+	a.divisor()
+	a.payload("r")
+	a.i32(-1)
+	a.op(OpI32Eq)
+	a.begin(OpIf, I32)
+	a.i32(0)
+	a.payload("l")
+	a.op(OpI32Sub)
+	a.op(OpElse)
+	a.payload("l")
+	a.payload("r")
+	a.op(OpI32DivS)
+	a.op(OpEnd)
+	a.box(tagInt)
+
+	a = g.function("rem", binary, I64)
+	a.ints("Rem")
+	a.divisor()
+	a.payload("l")
+	a.payload("r")
+	a.op(OpI32RemS)
+	a.box(tagInt)
+
+	// strcmp compares two Strs bytewise, returning -1, 0 or 1.
+	a = g.function("strcmp", params("a", I32, "b", I32), I32)
+	a.local("la", I32)
+	a.local("lb", I32)
+	a.local("i", I32)
+	a.local("ca", I32)
+	a.local("cb", I32)
+	a.get("a")
+	a.mem(OpI32Load, 0)
+	a.set("la")
+	a.get("b")
+	a.mem(OpI32Load, 0)
+	a.set("lb")
+	a.begin(OpBlock, 0)
+	a.begin(OpLoop, 0)
+	a.get("i")
+	a.get("la")
+	a.op(OpI32GeU)
+	a.get("i")
+	a.get("lb")
+	a.op(OpI32GeU)
+	a.op(OpI32Or)
+	a.br(OpBrIf, 1)
+	a.get("a")
+	a.get("i")
+	a.op(OpI32Add)
+	a.mem(OpI32Load8U, 4)
+	a.set("ca")
+	a.get("b")
+	a.get("i")
+	a.op(OpI32Add)
+	a.mem(OpI32Load8U, 4)
+	a.set("cb")
+	a.get("ca")
+	a.get("cb")
+	a.op(OpI32Ne)
+	a.begin(OpIf, 0)
+	a.sign("ca", "cb")
+	a.op(OpReturn)
+	a.op(OpEnd)
+	a.get("i")
+	a.i32(1)
+	a.op(OpI32Add)
+	a.set("i")
+	a.br(OpBr, 0)
+	a.op(OpEnd)
+	a.op(OpEnd)
+	a.sign("la", "lb")
+
+	// equal compares Ints, Strs and Bools of the same kind.
+	a = g.function("equal", checked, I32)
+	a.tag("l")
+	a.tag("r")
+	a.op(OpI32Eq)
+	a.begin(OpIf, 0)
+	a.tag("l")
+	a.i32(int32(tagStr))
+	a.op(OpI32Eq)
+	a.begin(OpIf, 0)
+	a.payload("l")
+	a.payload("r")
+	a.call("strcmp")
+	a.op(OpI32Eqz, OpReturn)
+	a.op(OpEnd)
+	a.tag("l")
+	a.i32(int32(tagBool))
+	a.op(OpI32LeU)
+	a.begin(OpIf, 0)
+	a.get("l")
+	a.get("r")
+	a.op(OpI64Eq, OpReturn)
+	a.op(OpEnd)
+	a.op(OpEnd)
+	a.mismatch("op")
+	a.op(OpUnreachable)
+
+	// compare orders two Ints or two Strs, returning -1, 0 or 1.
+	a = g.function("compare", checked, I32)
+	a.local("a", I32)
+	a.local("b", I32)
+	a.tag("l")
+	a.tag("r")
+	a.op(OpI32Or, OpI32Eqz)
+	a.begin(OpIf, 0)
+	a.payload("l")
+	a.set("a")
+	a.payload("r")
+	a.set("b")
+	a.get("a")
+	a.get("b")
+	a.op(OpI32GtS)
+	a.get("a")
+	a.get("b")
+	a.op(OpI32LtS)
+	a.op(OpI32Sub, OpReturn)
+	a.op(OpEnd)
+	a.tag("l")
+	a.i32(int32(tagStr))
+	a.op(OpI32Eq)
+	a.tag("r")
+	a.i32(int32(tagStr))
+	a.op(OpI32Eq)
+	a.op(OpI32And)
+	a.begin(OpIf, 0)
+	a.payload("l")
+	a.payload("r")
+	a.call("strcmp")
+	a.op(OpReturn)
+	a.op(OpEnd)
+	a.mismatch("op")
+	a.op(OpUnreachable)
+
+	for _, cmp := range []struct {
+		name string
+		fn   string
+		test []Op
+	}{
+		{"Eq", "equal", nil},
+		{"Neq", "equal", []Op{OpI32Eqz}},
+		{"Lt", "compare", []Op{OpI32LtS}},
+		{"Lte", "compare", []Op{OpI32LeS}},
+		{"Gt", "compare", []Op{OpI32GtS}},
+		{"Gte", "compare", []Op{OpI32GeS}},
+	} {
+		a = g.function(lower(cmp.name), binary, I64)
+		a.i32(g.str(cmp.name))
+		a.get("l")
+		a.get("r")
+		a.get("loc")
+		a.call(cmp.fn)
+		if cmp.fn == "compare" {
+			a.i32(0)
+		}
+		a.op(cmp.test...)
+		a.box(tagBool)
+	}
+
+	// And and Or work on the values directly: the tags of two Bools are
+	// the same and their payloads are 0 or 1.
+	for _, op := range []struct {
+		name string
+		op   Op
+	}{{"And", OpI64And}, {"Or", OpI64Or}} {
+		a = g.function(lower(op.name), binary, I64)
+		a.tag("l")
+		a.i32(int32(tagBool))
+		a.op(OpI32Ne)
+		a.tag("r")
+		a.i32(int32(tagBool))
+		a.op(OpI32Ne)
+		a.op(OpI32Or)
+		a.begin(OpIf, 0)
+		a.i32(g.str(op.name))
+		a.mismatch("")
+		a.op(OpEnd)
+		a.get("l")
+		a.get("r")
+		a.op(op.op)
+	}
+
+	a = g.function("cond", params("v", I64, "loc", I32), I32)
+	a.tag("v")
+	a.i32(int32(tagBool))
+	a.op(OpI32Ne)
+	a.begin(OpIf, 0)
+	a.i32(g.str("condition must be a Bool"))
+	a.get("loc")
+	a.call("fail")
+	a.op(OpEnd)
+	a.payload("v")
+
+	a = g.function("tuple", params("a", I64, "b", I64), I64)
+	a.local("p", I32)
+	a.i32(16)
+	a.call("alloc")
+	a.tee("p")
+	a.get("a")
+	a.mem(OpI64Store, 0)
+	a.get("p")
+	a.get("b")
+	a.mem(OpI64Store, 8)
+	a.get("p")
+	a.box(tagTuple)
+
+	for i, name := range []string{"first", "second"} {
+		a = g.function(name, params("v", I64, "loc", I32), I64)
+		a.tag("v")
+		a.i32(int32(tagTuple))
+		a.op(OpI32Ne)
+		a.begin(OpIf, 0)
+		a.i32(g.str("not a tuple"))
+		a.get("loc")
+		a.call("fail")
+		a.op(OpEnd)
+		a.payload("v")
+		a.mem(OpI64Load, int32(8*i))
+	}
+
+	// closure allocates a closure; the caller stores its captures.
+	a = g.function("closure", params("index", I32, "arity", I32, "ncaptures", I32), I32)
+	a.local("p", I32)
+	a.get("ncaptures")
+	a.i32(8)
+	a.op(OpI32Mul)
+	a.i32(closureCaptures)
+	a.op(OpI32Add)
+	a.call("alloc")
+	a.tee("p")
+	a.get("index")
+	a.mem(OpI32Store, 0)
+	a.get("p")
+	a.get("arity")
+	a.mem(OpI32Store, closureArity)
+	a.get("p")
+	a.get("ncaptures")
+	a.mem(OpI32Store, 8)
+	a.get("p")
+
+	// callee checks a call before its arguments are evaluated and returns
+	// the closure to call.
+	a = g.function("callee", params("v", I64, "name", I32, "argc", I32, "loc", I32), I32)
+	a.tag("v")
+	a.i32(int32(tagClosure))
+	a.op(OpI32Ne)
+	a.begin(OpIf, 0)
+	a.call("flush")
+	a.i32(g.str("cannot call a "))
+	a.call("out_str")
+	a.get("v")
+	a.call("kind")
+	a.call("out_str")
+	a.get("loc")
+	a.call("fail_end")
+	a.op(OpEnd)
+	a.payload("v")
+	a.mem(OpI32Load, closureArity)
+	a.get("argc")
+	a.op(OpI32Ne)
+	a.begin(OpIf, 0)
+	a.call("flush")
+	a.i32(g.str("wrong number of arguments: "))
+	a.call("out_str")
+	a.get("name")
+	a.call("out_str")
+	a.i32(g.str(" expects "))
+	a.call("out_str")
+	a.payload("v")
+	a.mem(OpI32Load, closureArity)
+	a.call("out_int")
+	a.i32(g.str(", got "))
+	a.call("out_str")
+	a.get("argc")
+	a.call("out_int")
+	a.get("loc")
+	a.call("fail_end")
+	a.op(OpEnd)
+	a.payload("v")
+
+	// enter and leave surround every call not in tail position, failing
+	// when calls nest deeper than maxDepth.
+	a = g.function("enter", params("name", I32, "loc", I32))
+	a.global(OpGlobalGet, "depth")
+	a.i32(maxDepth)
+	a.op(OpI32GeU)
+	a.begin(OpIf, 0)
+	a.call("flush")
+	a.i32(g.str("stack overflow: calls to "))
+	a.call("out_str")
+	a.get("name")
+	a.call("out_str")
+	a.i32(g.str(fmt.Sprintf(" nested more than %d deep", maxDepth)))
+	a.call("out_str")
+	a.get("loc")
+	a.call("fail_end")
+	a.op(OpEnd)
+	a.global(OpGlobalGet, "depth")
+	a.i32(1)
+	a.op(OpI32Add)
+	a.global(OpGlobalSet, "depth")
+
+	a = g.function("leave", nil)
+	a.global(OpGlobalGet, "depth")
+	a.i32(1)
+	a.op(OpI32Sub)
+	a.global(OpGlobalSet, "depth")
+}
+
+// mismatch fails with an invalid operands error for l and r. The operator
+// name is in local op, or already on the stack when op is "".
+func (a *asm) mismatch(op string) {
+	if op != "" {
+		a.get(op)
+	}
+	a.get("l")
+	a.get("r")
+	a.get("loc")
+	a.call("mismatch")
+}
+
+// ints fails unless l and r are both Ints.
+func (a *asm) ints(op string) {
+	a.i32(a.g.str(op))
+	a.get("l")
+	a.get("r")
+	a.get("loc")
+	a.call("ints")
+}
+
+// divisor fails when r is zero.
+func (a *asm) divisor() {
+	a.payload("r")
+	a.op(OpI32Eqz)
+	a.begin(OpIf, 0)
+	a.i32(a.g.str("division by zero"))
+	a.get("loc")
+	a.call("fail")
+	a.op(OpEnd)
+}
+
+// sign pushes -1, 0 or 1 as the unsigned x is less than, equal to or greater
+// than y.
+func (a *asm) sign(x, y string) {
+	a.get(x)
+	a.get(y)
+	a.op(OpI32GtU)
+	a.get(x)
+	a.get(y)
+	a.op(OpI32LtU)
+	a.op(OpI32Sub)
+}
+
+func lower(s string) string {
+	return string(s[0]+'a'-'A') + s[1:]
+}
+
+func putU32(b []byte, n uint32) {
+	b[0], b[1], b[2], b[3] = byte(n), byte(n>>8), byte(n>>16), byte(n>>24)
+}
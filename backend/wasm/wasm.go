@@ -0,0 +1,381 @@
+// Package wasm compiles Rinha programs into WebAssembly modules, written in
+// either the binary or the text format.
+//
+// Modules import two host functions from "rinha": print(ptr, len), which
+// writes len bytes of memory to the standard output, and fail(ptr, len),
+// which reports a runtime error and must not return. They export their
+// memory and a main function running the program.
+package wasm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/closure"
+	"github.com/ghhernandes/rinha-compiler-go/diag"
+)
+
+// function is a closure converted function being lowered to a WebAssembly
+// function, which receives its closure as the first parameter.
+type function struct {
+	ir *closure.Function
+	a  *asm
+	// locals holds the WebAssembly local of each local slot.
+	locals []string
+}
+
+type generator struct {
+	m       *Module
+	sources *diag.SourceMap
+	fn      *function
+	static  []byte
+	strings map[string]int32
+	idents  int
+}
+
+// Compile translates f into a module that behaves like running it with the
+// interpreter, except that calls are not memoized: it prints the same output
+// and fails with the same runtime errors. Locations in errors are rendered
+// with sources when it is not nil.
+func Compile(f *ast.File, sources *diag.SourceMap) (m *Module, err error) {
+	program, err := closure.Convert(f)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{
+		m:       &Module{},
+		sources: sources,
+		strings: make(map[string]int32),
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			gerr, ok := r.(*ast.Error)
+			if !ok {
+				panic(r)
+			}
+			err = gerr
+		}
+	}()
+
+	g.runtime()
+
+	for _, fn := range program.Functions {
+		g.lower(fn)
+	}
+
+	heap := (dataAddr + len(g.static) + 7) &^ 7
+	g.m.Globals[0].Init = int64(heap)
+	g.m.Memory = heap/pageSize + 1
+	g.m.Data = []Data{{Offset: dataAddr, Bytes: g.static}}
+	g.m.Exports = []Export{{Name: "memory", Kind: 2}, {Name: "main", Kind: 0, Index: -1}}
+	g.m.link()
+	return g.m, nil
+}
+
+// Generate writes the binary module compiled from f.
+func Generate(w io.Writer, f *ast.File, sources *diag.SourceMap) error {
+	m, err := Compile(f, sources)
+	if err != nil {
+		return err
+	}
+	return m.WriteBinary(w)
+}
+
+// GenerateText writes the module compiled from f in the text format.
+func GenerateText(w io.Writer, f *ast.File, sources *diag.SourceMap) error {
+	m, err := Compile(f, sources)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, ";; Code generated by rinha build --target=wat from %s. DO NOT EDIT.\n", f.Name)
+	return m.WriteText(w)
+}
+
+// Loader is a Node.js script that runs the module next to it, named after
+// the script with a .wasm extension.
+const Loader = `#!/usr/bin/env node
+// The script is loaded as either a CommonJS or an ES module, depending on
+// the package it ends up in, so it only uses what both have. The module
+// runs on a worker thread, whose stack is large enough for calls nesting as
+// deep as the interpreter allows.
+async function run() {
+	const fs = await import('node:fs');
+	const { workerData } = await import('node:worker_threads');
+	let memory;
+
+	function write(fd, p, n) {
+		const bytes = Buffer.from(memory.buffer, p, n);
+		for (let off = 0; off < n; ) {
+			off += fs.writeSync(fd, bytes, off, n - off);
+		}
+	}
+
+	const imports = {
+		rinha: {
+			print: (p, n) => write(1, p, n),
+			fail: (p, n) => {
+				fs.writeSync(2, 'error: ');
+				write(2, p, n);
+				fs.writeSync(2, '\n');
+				process.exit(1);
+			},
+		},
+	};
+
+	const module = new WebAssembly.Module(fs.readFileSync(workerData + '.wasm'));
+	const instance = new WebAssembly.Instance(module, imports);
+	memory = instance.exports.memory;
+	instance.exports.main();
+}
+
+(async () => {
+	const { Worker } = await import('node:worker_threads');
+	const worker = new Worker('(' + run + ')()', {
+		eval: true,
+		workerData: process.argv[1],
+		resourceLimits: { stackSizeMb: 1024 },
+	});
+	worker.on('exit', (code) => {
+		process.exitCode = code;
+	});
+})();
+`
+
+// Build writes the module compiled from f to output.wasm and a script
+// running it with Node.js to output.
+func Build(f *ast.File, sources *diag.SourceMap, output string) error {
+	var b bytes.Buffer
+	if err := Generate(&b, f, sources); err != nil {
+		return err
+	}
+	if err := os.WriteFile(output+".wasm", b.Bytes(), 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(output, []byte(Loader), 0o755)
+}
+
+func (g *generator) errorf(loc ast.Location, format string, args ...any) {
+	panic(ast.Errorf(loc, format, args...))
+}
+
+// data adds b to the static data and returns its address.
+func (g *generator) data(b []byte) int32 {
+	for len(g.static)%4 != 0 {
+		g.static = append(g.static, 0)
+	}
+	addr := int32(dataAddr + len(g.static))
+	g.static = append(g.static, b...)
+	return addr
+}
+
+// str returns the address of a static Str holding s.
+func (g *generator) str(s string) int32 {
+	if addr, ok := g.strings[s]; ok {
+		return addr
+	}
+	b := make([]byte, 4+len(s))
+	putU32(b, uint32(len(s)))
+	copy(b[4:], s)
+	addr := g.data(b)
+	g.strings[s] = addr
+	return addr
+}
+
+func (g *generator) loc(loc ast.Location) int32 {
+	if g.sources == nil {
+		return g.str(fmt.Sprintf("%s:%d:%d", loc.Filename, loc.Start, loc.End))
+	}
+	return g.str(g.sources.Format(loc))
+}
+
+func (g *generator) ident(name string) string {
+	g.idents++
+	return fmt.Sprintf("v_%s_%d", name, g.idents)
+}
+
+func (g *generator) temp(t ValType) string {
+	g.idents++
+	return g.fn.a.local(fmt.Sprintf("t%d", g.idents), t)
+}
+
+// term writes the code pushing the value of e, evaluating its parts in the
+// order the interpreter does.
+func (g *generator) term(e closure.Expr) {
+	a := g.fn.a
+	switch n := e.(type) {
+	case closure.Int:
+		a.i64(int64(uint64(uint32(n.Value)) << 32))
+	case closure.Str:
+		a.i64(int64(g.str(n.Value))<<32 | tagStr)
+	case closure.Bool:
+		var b int64
+		if n.Value {
+			b = 1
+		}
+		a.i64(b<<32 | tagBool)
+	case closure.Local:
+		a.get(g.fn.locals[n.Slot])
+	case closure.Capture:
+		a.get("self")
+		a.mem(OpI64Load, int32(closureCaptures+8*n.Index))
+	case closure.Self:
+		a.get("self")
+		a.box(tagClosure)
+	case closure.Undefined:
+		a.i32(g.str("undefined variable " + n.Name))
+		a.i32(g.loc(n.Location))
+		a.call("fail")
+		a.op(OpUnreachable)
+	case closure.Let:
+		g.term(n.Value)
+		local := a.local(g.ident(n.Name), I64)
+		g.fn.locals[n.Slot] = local
+		if n.Next == nil {
+			a.tee(local)
+		} else {
+			a.set(local)
+			g.term(n.Next)
+		}
+	case closure.Closure:
+		g.closure(n)
+	case closure.If:
+		g.term(n.Condition)
+		a.i32(g.loc(n.Location))
+		a.call("cond")
+		a.begin(OpIf, I64)
+		g.term(n.Then)
+		a.op(OpElse)
+		g.term(n.Otherwise)
+		a.op(OpEnd)
+	case closure.Binary:
+		fn, ok := binaryFuncs[n.Op]
+		if !ok {
+			g.errorf(n.Location, "unknown binary operator %s", n.Op)
+		}
+		g.term(n.Lhs)
+		g.term(n.Rhs)
+		a.i32(g.loc(n.Location))
+		a.call(fn)
+	case closure.Call:
+		g.call(n)
+	case closure.Tuple:
+		g.term(n.First)
+		g.term(n.Second)
+		a.call("tuple")
+	case closure.Print:
+		g.term(n.Value)
+		a.call("print")
+	case closure.First:
+		g.term(n.Value)
+		a.i32(g.loc(n.Location))
+		a.call("first")
+	case closure.Second:
+		g.term(n.Value)
+		a.i32(g.loc(n.Location))
+		a.call("second")
+	default:
+		panic(fmt.Sprintf("unexpected expression %T", e))
+	}
+}
+
+var binaryFuncs = map[ast.BinaryOp]string{
+	ast.Add: "add",
+	ast.Sub: "sub",
+	ast.Mul: "mul",
+	ast.Div: "div",
+	ast.Rem: "rem",
+	ast.Eq:  "eq",
+	ast.Neq: "neq",
+	ast.Lt:  "lt",
+	ast.Lte: "lte",
+	ast.Gt:  "gt",
+	ast.Gte: "gte",
+	ast.And: "and",
+	ast.Or:  "or",
+}
+
+// signature returns the type of functions with the given arity: they take
+// their closure and arguments and return a value.
+func (g *generator) signature(arity int) FuncType {
+	params := []ValType{I32}
+	for i := 0; i < arity; i++ {
+		params = append(params, I64)
+	}
+	return FuncType{Params: params, Results: []ValType{I64}}
+}
+
+// lower writes fn as a WebAssembly function. Every function but main goes
+// in the table, at the index of its closures.
+func (g *generator) lower(fn *closure.Function) {
+	g.fn = &function{ir: fn, locals: make([]string, fn.Locals)}
+	if fn.Index == 0 {
+		g.fn.a = g.function("main", nil)
+		g.term(fn.Body)
+		g.fn.a.op(OpDrop)
+		g.fn.a.call("flush")
+		return
+	}
+
+	index := len(g.m.Imports) + len(g.m.Funcs)
+	locals := params("self", I32)
+	for i, param := range fn.Params {
+		g.fn.locals[i] = g.ident(param)
+		locals = append(locals, Local{Name: g.fn.locals[i], Type: I64})
+	}
+	g.fn.a = g.function(fmt.Sprintf("fn_%d", len(g.m.Table)), locals, I64)
+	g.m.Table = append(g.m.Table, index)
+	g.term(fn.Body)
+}
+
+// closure writes the code creating a closure of n.Function.
+func (g *generator) closure(n closure.Closure) {
+	a := g.fn.a
+	p := g.temp(I32)
+	a.i32(int32(n.Function.Index - 1))
+	a.i32(int32(len(n.Function.Params)))
+	a.i32(int32(len(n.Captures)))
+	a.call("closure")
+	a.set(p)
+	for i, capture := range n.Captures {
+		a.get(p)
+		g.term(capture)
+		a.mem(OpI64Store, int32(closureCaptures+8*i))
+	}
+	a.get(p)
+	a.box(tagClosure)
+}
+
+// call writes a call. Calls in tail position replace the frame of the
+// caller; the others are counted by enter and leave.
+func (g *generator) call(n closure.Call) {
+	a := g.fn.a
+	g.term(n.Callee)
+	a.i32(g.str(n.Name))
+	a.i32(int32(len(n.Args)))
+	a.i32(g.loc(n.Location))
+	a.call("callee")
+	callee := g.temp(I32)
+	a.set(callee)
+
+	a.get(callee)
+	for _, arg := range n.Args {
+		g.term(arg)
+	}
+	a.get(callee)
+	a.mem(OpI32Load, 0)
+	typ := int64(g.m.typeOf(g.signature(len(n.Args))))
+	if n.Tail {
+		a.emit(Instr{Op: OpReturnCallIndirect, Imm: typ})
+		return
+	}
+	a.i32(g.str(n.Name))
+	a.i32(g.loc(n.Location))
+	a.call("enter")
+	a.emit(Instr{Op: OpCallIndirect, Imm: typ})
+	a.call("leave")
+}
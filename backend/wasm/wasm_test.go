@@ -0,0 +1,137 @@
+package wasm_test
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/backend/internal/backendtest"
+	"github.com/ghhernandes/rinha-compiler-go/backend/wasm"
+	"github.com/ghhernandes/rinha-compiler-go/parser"
+)
+
+// programs are the programs run by this backend besides the shared ones.
+var programs = []backendtest.Program{
+	{Name: "min int", Src: `let _ = print(-2147483647 - 1); let _ = print((-2147483647 - 1) / -1); print("" + (-2147483647 - 1))`},
+	{Name: "string comparison", Src: `print(("ab" < "a", ("a" <= "ab", ("b" > "ab", ("ab" == "a" + "b", "" != "")))))`},
+	{Name: "long output", Src: `let f = fn (n) => { if (n == 0) { 0 } else { let _ = print("line " + n); f(n - 1) } }; f(2000)`},
+	{Name: "comparison mismatch", Src: `print(true < false)`},
+	{Name: "escapes", Src: `print("quote \" backslash \\ é")`},
+}
+
+func TestModulesMatchInterpreter(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not available")
+	}
+
+	tests := append(append(append(append(backendtest.Programs, backendtest.Recursion...), backendtest.Unbound...), programs...), backendtest.Examples(t)...)
+	backendtest.MatchInterpreter(t, tests, func(t *testing.T, file *ast.File, path string) *exec.Cmd {
+		if err := wasm.Build(file, nil, path); err != nil {
+			t.Fatal(err)
+		}
+		return exec.Command(node, path)
+	})
+}
+
+// section is a section of a binary module.
+type section struct {
+	id       byte
+	contents []byte
+}
+
+func u32(t *testing.T, b []byte) (uint32, []byte) {
+	var n uint32
+	for shift := 0; len(b) > 0; shift += 7 {
+		c := b[0]
+		b = b[1:]
+		n |= uint32(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return n, b
+		}
+	}
+	t.Fatal("truncated LEB128 number")
+	return 0, nil
+}
+
+func TestBinaryStructure(t *testing.T) {
+	file, err := parser.ParseString("test.rinha", backendtest.Programs[0].Src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := wasm.Generate(&b, file, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	module := b.Bytes()
+	if !bytes.HasPrefix(module, append(wasm.Magic, wasm.Version...)) {
+		t.Fatalf("bad header % x", module[:8])
+	}
+	var sections []section
+	for rest := module[8:]; len(rest) > 0; {
+		id := rest[0]
+		size, r := u32(t, rest[1:])
+		if int(size) > len(r) {
+			t.Fatalf("section %d is %d bytes long, only %d left", id, size, len(r))
+		}
+		sections = append(sections, section{id, r[:size]})
+		rest = r[size:]
+	}
+
+	var ids []byte
+	for _, s := range sections {
+		ids = append(ids, s.id)
+	}
+	// Type, import, function, table, memory, global, export, elem, code
+	// and data, in the order the specification requires.
+	if want := []byte{1, 2, 3, 4, 5, 6, 7, 9, 10, 11}; !bytes.Equal(ids, want) {
+		t.Fatalf("got sections %v, want %v", ids, want)
+	}
+
+	imports := sections[1].contents
+	count, imports := u32(t, imports)
+	if count != 2 {
+		t.Fatalf("got %d imports, want 2", count)
+	}
+	for _, want := range []string{"rinha", "print"} {
+		var n uint32
+		n, imports = u32(t, imports)
+		if got := string(imports[:n]); got != want {
+			t.Errorf("got import name %q, want %q", got, want)
+		}
+		imports = imports[n:]
+	}
+
+	// Every function declared has a body.
+	functions, _ := u32(t, sections[2].contents)
+	bodies, _ := u32(t, sections[8].contents)
+	if functions != bodies {
+		t.Errorf("%d functions declared, %d bodies", functions, bodies)
+	}
+
+	m, err := wasm.Compile(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text bytes.Buffer
+	if err := m.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`(import "rinha" "print" (func $host_print (type $t0)))`,
+		`(export "main" (func $main))`,
+		`(elem (i32.const 0) $fn_0 $fn_1)`,
+		`call_indirect (type `,
+	} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text format lacks %q", want)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	backendtest.GenerateErrors(t, wasm.Generate)
+}
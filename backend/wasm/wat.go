@@ -0,0 +1,122 @@
+package wasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteText writes m in the text format. Functions, locals and globals are
+// referred to by name; branch labels by depth.
+func (m *Module) WriteText(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "(module")
+	for i, t := range m.Types {
+		fmt.Fprintf(b, "  (type $t%d (func%s))\n", i, signature(t.Params, t.Results))
+	}
+	for _, imp := range m.Imports {
+		fmt.Fprintf(b, "  (import %q %q (func $%s (type $t%d)))\n", imp.Module, imp.Name, imp.Func, imp.Type)
+	}
+	fmt.Fprintf(b, "  (table %d funcref)\n", len(m.Table))
+	fmt.Fprintf(b, "  (memory %d)\n", m.Memory)
+	for _, g := range m.Globals {
+		typ := g.Type.String()
+		if g.Mutable {
+			typ = "(mut " + typ + ")"
+		}
+		fmt.Fprintf(b, "  (global $%s %s (%s.const %d))\n", g.Name, typ, g.Type, g.Init)
+	}
+	for _, exp := range m.Exports {
+		if exp.Kind == 2 {
+			fmt.Fprintf(b, "  (export %q (memory %d))\n", exp.Name, exp.Index)
+		} else {
+			fmt.Fprintf(b, "  (export %q (func $%s))\n", exp.Name, m.funcName(exp.Index))
+		}
+	}
+	if len(m.Table) > 0 {
+		fmt.Fprint(b, "  (elem (i32.const 0)")
+		for _, index := range m.Table {
+			fmt.Fprintf(b, " $%s", m.funcName(index))
+		}
+		fmt.Fprintln(b, ")")
+	}
+	for _, d := range m.Data {
+		fmt.Fprintf(b, "  (data (i32.const %d) \"%s\")\n", d.Offset, escape(d.Bytes))
+	}
+
+	for _, fn := range m.Funcs {
+		fmt.Fprintf(b, "  (func $%s (type $t%d)", fn.Name, fn.Type)
+		for _, p := range fn.Params {
+			fmt.Fprintf(b, " (param $%s %s)", p.Name, p.Type)
+		}
+		for _, r := range fn.Result {
+			fmt.Fprintf(b, " (result %s)", r)
+		}
+		fmt.Fprintln(b)
+		for _, l := range fn.Locals {
+			fmt.Fprintf(b, "    (local $%s %s)\n", l.Name, l.Type)
+		}
+		depth := 2
+		for _, in := range fn.Body {
+			if in.Op == OpEnd || in.Op == OpElse {
+				depth--
+			}
+			fmt.Fprintf(b, "%s%s\n", strings.Repeat("  ", depth), text(in))
+			switch in.Op {
+			case OpBlock, OpLoop, OpIf, OpElse:
+				depth++
+			}
+		}
+		fmt.Fprintln(b, "  )")
+	}
+	fmt.Fprintln(b, ")")
+	return b.Flush()
+}
+
+func signature(params, results []ValType) string {
+	var b strings.Builder
+	for _, p := range params {
+		fmt.Fprintf(&b, " (param %s)", p)
+	}
+	for _, r := range results {
+		fmt.Fprintf(&b, " (result %s)", r)
+	}
+	return b.String()
+}
+
+func text(in Instr) string {
+	switch in.Op.imm {
+	case immIndex:
+		if in.Name != "" {
+			return fmt.Sprintf("%s $%s", in.Op.Name, in.Name)
+		}
+		return fmt.Sprintf("%s %d", in.Op.Name, in.Imm)
+	case immI32, immI64:
+		return fmt.Sprintf("%s %d", in.Op.Name, in.Imm)
+	case immBlock:
+		if in.Block != 0 {
+			return fmt.Sprintf("%s (result %s)", in.Op.Name, in.Block)
+		}
+	case immMem:
+		if in.Imm != 0 {
+			return fmt.Sprintf("%s offset=%d", in.Op.Name, in.Imm)
+		}
+	case immCallIndirect:
+		return fmt.Sprintf("%s (type $t%d)", in.Op.Name, in.Imm)
+	}
+	return in.Op.Name
+}
+
+// escape writes data as the contents of a text format string.
+func escape(data []byte) string {
+	var b strings.Builder
+	for _, c := range data {
+		if c >= ' ' && c <= '~' && c != '"' && c != '\\' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "\\%02x", c)
+		}
+	}
+	return b.String()
+}
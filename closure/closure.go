@@ -0,0 +1,125 @@
+// Package closure finds the variables each function of a program captures
+// and converts programs into an explicit closure converted form, which
+// backends lower instead of resolving variables on their own.
+package closure
+
+import "github.com/ghhernandes/rinha-compiler-go/ast"
+
+// Captures holds the free variables of the functions of a program,
+// identified by location, in the order they are first used. Functions
+// sharing a location, like synthesized ones, get the free variables of all
+// of them, which are always safe to capture.
+type Captures map[ast.Location][]string
+
+// Of returns the free variables of fn.
+func (c Captures) Of(fn ast.Function) []string {
+	return c[fn.Location]
+}
+
+type env struct {
+	parent *env
+	name   string
+}
+
+func (e *env) bound(name string) bool {
+	for ; e != nil; e = e.parent {
+		if e.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// free collects the variables of one function body that are not bound in
+// it, without duplicates.
+type free struct {
+	names []string
+	seen  map[string]bool
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *free) add(name string) {
+	if !f.seen[name] {
+		f.seen[name] = true
+		f.names = append(f.names, name)
+	}
+}
+
+// Analyze returns the free variables of every function of term: the
+// variables its body uses that are not its parameters nor bound by a let
+// inside it. A function that is the value of a let sees the name of the
+// binding, so a recursive function lists itself.
+func Analyze(term ast.Term) Captures {
+	c := make(Captures)
+	c.walk(nil, &free{seen: make(map[string]bool)}, term)
+	return c
+}
+
+func (c Captures) walk(e *env, f *free, term ast.Term) {
+	switch n := term.(type) {
+	case ast.Var:
+		if !e.bound(n.Text) {
+			f.add(n.Text)
+		}
+	case ast.Let:
+		if _, ok := n.Value.(ast.Function); ok {
+			c.walk(&env{parent: e, name: n.Name.Text}, f, n.Value)
+		} else {
+			c.walk(e, f, n.Value)
+		}
+		if n.Next != nil {
+			c.walk(&env{parent: e, name: n.Name.Text}, f, n.Next)
+		}
+	case ast.Function:
+		var inner *env
+		for _, param := range n.Parameters {
+			inner = &env{parent: inner, name: param.Text}
+		}
+		body := &free{seen: make(map[string]bool)}
+		c.walk(inner, body, n.Value)
+		names, ok := c[n.Location]
+		if !ok {
+			names = body.names
+		}
+		for _, name := range body.names {
+			if !contains(names, name) {
+				names = append(names, name)
+			}
+		}
+		c[n.Location] = names
+		for _, name := range body.names {
+			if !e.bound(name) {
+				f.add(name)
+			}
+		}
+	case ast.If:
+		c.walk(e, f, n.Condition)
+		c.walk(e, f, n.Then)
+		c.walk(e, f, n.Otherwise)
+	case ast.Binary:
+		c.walk(e, f, n.Lhs)
+		c.walk(e, f, n.Rhs)
+	case ast.Call:
+		c.walk(e, f, n.Callee)
+		for _, arg := range n.Arguments {
+			c.walk(e, f, arg)
+		}
+	case ast.Tuple:
+		c.walk(e, f, n.First)
+		c.walk(e, f, n.Second)
+	case ast.Print:
+		c.walk(e, f, n.Value)
+	case ast.First:
+		c.walk(e, f, n.Value)
+	case ast.Second:
+		c.walk(e, f, n.Value)
+	}
+}
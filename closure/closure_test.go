@@ -0,0 +1,161 @@
+package closure_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/closure"
+	"github.com/ghhernandes/rinha-compiler-go/parser"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		src  string
+		free map[int][]string // free variables by start offset of the function
+	}{
+		{`fn (x) => { x }`, map[int][]string{0: nil}},
+		{`let a = 1; let b = 2; fn (x) => { b + x + a + b }`, map[int][]string{22: {"b", "a"}}},
+		// Lets inside the body bind their names after their value.
+		{`fn () => { let y = y; y }`, map[int][]string{0: {"y"}}},
+		// A function bound by a let sees itself.
+		{`let f = fn (n) => { f(n) }; f(1)`, map[int][]string{8: {"f"}}},
+		// Nested functions pass on what their parent does not bind.
+		{`let x = 1; fn (y) => { fn (z) => { x + y + z } }`, map[int][]string{11: {"x"}, 23: {"x", "y"}}},
+		// Parameters shadow the variables of enclosing functions.
+		{`let x = 1; fn (x) => { fn () => { x } }`, map[int][]string{11: nil, 23: {"x"}}},
+		{`let g = fn () => { let f = fn () => { f() }; f }; g`, map[int][]string{8: nil, 27: {"f"}}},
+	}
+
+	for _, tt := range tests {
+		file, err := parser.ParseString("test.rinha", tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		free := make(map[int][]string)
+		for loc, names := range closure.Analyze(file.Expression) {
+			free[loc.Start] = names
+		}
+		if !reflect.DeepEqual(free, tt.free) {
+			t.Errorf("%q: got %v, want %v", tt.src, free, tt.free)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	src := `let x = 10; let f = fn (y) => { fn (z) => { x + y + z + f(z) } }; f(1)(2)`
+	file, err := parser.ParseString("test.rinha", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	program, err := closure.Convert(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(program.Functions) != 3 {
+		t.Fatalf("got %d functions, want 3", len(program.Functions))
+	}
+	main, f, inner := program.Main(), program.Functions[1], program.Functions[2]
+
+	if main.Locals != 2 || len(main.Captures) != 0 {
+		t.Errorf("main: got %d locals and captures %v", main.Locals, main.Captures)
+	}
+	if f.Name != "f" || !reflect.DeepEqual(f.Params, []string{"y"}) || f.Locals != 1 {
+		t.Errorf("f: got name %q, params %v and %d locals", f.Name, f.Params, f.Locals)
+	}
+	// f captures x for its inner function, and itself through Self.
+	if !reflect.DeepEqual(f.Captures, []string{"x"}) {
+		t.Errorf("f: got captures %v, want [x]", f.Captures)
+	}
+	if !reflect.DeepEqual(inner.Captures, []string{"x", "y", "f"}) {
+		t.Errorf("inner: got captures %v, want [x y f]", inner.Captures)
+	}
+
+	create, ok := f.Body.(closure.Closure)
+	if !ok || create.Function != inner {
+		t.Fatalf("f: got body %#v, want the closure of the inner function", f.Body)
+	}
+	want := []closure.Expr{
+		closure.Capture{Index: 0, Name: "x"},
+		closure.Local{Slot: 0, Name: "y"},
+		closure.Self{},
+	}
+	if !reflect.DeepEqual(create.Captures, want) {
+		t.Errorf("f: got captured values %#v, want %#v", create.Captures, want)
+	}
+}
+
+func TestConvertUndefined(t *testing.T) {
+	file, err := parser.ParseString("test.rinha", `let f = fn () => { g() }; f()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	program, err := closure.Convert(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := program.Functions[1]
+	if len(f.Captures) != 0 {
+		t.Errorf("f: got captures %v, want none", f.Captures)
+	}
+	call, ok := f.Body.(closure.Call)
+	if !ok {
+		t.Fatalf("f: got body %#v, want a call", f.Body)
+	}
+	want := closure.Undefined{Name: "g", Location: ast.Location{Start: 19, End: 20, Filename: "test.rinha"}}
+	if call.Callee != want {
+		t.Errorf("got callee %#v, want %#v", call.Callee, want)
+	}
+}
+
+func TestConvertTailCalls(t *testing.T) {
+	src := `let f = fn (n) => { if (n == 0) { g(n) } else { let m = n - 1; f(m) + f(m) } }; f(1)`
+	file, err := parser.ParseString("test.rinha", "let g = fn (n) => { n }; "+src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := closure.Convert(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []bool
+	var walk func(e closure.Expr)
+	walk = func(e closure.Expr) {
+		switch n := e.(type) {
+		case closure.Call:
+			calls = append(calls, n.Tail)
+		case closure.If:
+			walk(n.Then)
+			walk(n.Otherwise)
+		case closure.Let:
+			walk(n.Next)
+		case closure.Binary:
+			walk(n.Lhs)
+			walk(n.Rhs)
+		}
+	}
+	walk(program.Functions[2].Body)
+	if want := []bool{true, false, false}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("got tail calls %v, want %v", calls, want)
+	}
+	// The calls of main return to no function.
+	if call := program.Main().Body.(closure.Let).Next.(closure.Let).Next.(closure.Call); call.Tail {
+		t.Error("main ends with a tail call")
+	}
+}
+
+func TestAnalyzeSharedLocation(t *testing.T) {
+	// Synthesized functions may share a location, here the zero one.
+	fn := func(name string) ast.Function {
+		return ast.Function{Kind: ast.FUNCTION, Value: ast.Var{Kind: ast.VAR, Text: name}}
+	}
+	term := ast.Tuple{Kind: ast.TUPLE, First: fn("x"), Second: fn("y")}
+
+	if got := closure.Analyze(term).Of(fn("x")); !reflect.DeepEqual(got, []string{"x", "y"}) {
+		t.Errorf("got %v, want [x y]", got)
+	}
+}
@@ -0,0 +1,342 @@
+package closure
+
+import "github.com/ghhernandes/rinha-compiler-go/ast"
+
+// Program is a closure converted program: every function is lifted out of
+// the term creating it and reads the variables of enclosing functions from
+// its closure.
+type Program struct {
+	Functions []*Function
+}
+
+// Main returns the function running the program, which takes no parameters
+// and captures nothing.
+func (p *Program) Main() *Function {
+	return p.Functions[0]
+}
+
+type Function struct {
+	Index int
+	// Name is the let binding the function is the value of, which its body
+	// reads with Self, or "" for anonymous functions and main.
+	Name   string
+	Params []string
+	// Captures names the variables held by the closures of the function,
+	// read with Capture.
+	Captures []string
+	// Locals is the number of local slots. Parameters take the first ones.
+	Locals int
+	Body   Expr
+	// Source is the function literal, or the zero Function for main.
+	Source ast.Function
+}
+
+// Expr is a term of a closure converted function.
+type Expr interface {
+	expr()
+}
+
+type (
+	Int struct {
+		Value int32
+	}
+
+	Str struct {
+		Value string
+	}
+
+	Bool struct {
+		Value bool
+	}
+
+	// Local reads a parameter or a let binding of the current function.
+	Local struct {
+		Slot int
+		Name string
+	}
+
+	// Capture reads a variable from the closure of the current function.
+	Capture struct {
+		Index int
+		Name  string
+	}
+
+	// Self is the closure of the current function.
+	Self struct{}
+
+	// Undefined reads a variable bound nowhere, which fails with an
+	// undefined variable error when it is evaluated, as in the interpreter.
+	Undefined struct {
+		Name     string
+		Location ast.Location
+	}
+
+	// Let stores Value in a local slot and evaluates Next, or is the value
+	// itself when Next is nil.
+	Let struct {
+		Slot  int
+		Name  string
+		Value Expr
+		Next  Expr
+	}
+
+	// Closure creates a closure of Function, holding the values of
+	// Captures in the order of Function.Captures.
+	Closure struct {
+		Function *Function
+		Captures []Expr
+	}
+
+	If struct {
+		Condition Expr
+		Then      Expr
+		Otherwise Expr
+		Location  ast.Location
+	}
+
+	Binary struct {
+		Op       ast.BinaryOp
+		Lhs      Expr
+		Rhs      Expr
+		Location ast.Location
+	}
+
+	// Call calls Callee. Name is the variable the callee was read from, or
+	// "<anonymous>", for error messages. Tail is set when the result of the
+	// call is the result of the function making it, so backends can run
+	// chains of such calls without growing the stack.
+	Call struct {
+		Callee   Expr
+		Name     string
+		Args     []Expr
+		Location ast.Location
+		Tail     bool
+	}
+
+	Tuple struct {
+		First  Expr
+		Second Expr
+	}
+
+	Print struct {
+		Value Expr
+	}
+
+	First struct {
+		Value    Expr
+		Location ast.Location
+	}
+
+	Second struct {
+		Value    Expr
+		Location ast.Location
+	}
+)
+
+func (Int) expr()       {}
+func (Str) expr()       {}
+func (Bool) expr()      {}
+func (Local) expr()     {}
+func (Capture) expr()   {}
+func (Self) expr()      {}
+func (Undefined) expr() {}
+func (Let) expr()       {}
+func (Closure) expr()   {}
+func (If) expr()        {}
+func (Binary) expr()    {}
+func (Call) expr()      {}
+func (Tuple) expr()     {}
+func (Print) expr()     {}
+func (First) expr()     {}
+func (Second) expr()    {}
+
+type scope struct {
+	parent *scope
+	name   string
+	slot   int
+}
+
+// function is a function being converted.
+type function struct {
+	parent  *function
+	ir      *Function
+	scope   *scope
+	indices map[string]int
+}
+
+type converter struct {
+	fn      *function
+	program *Program
+}
+
+// Convert closure converts the program f. Variables are resolved
+// lexically; one that is not in scope is read as Undefined.
+func Convert(f *ast.File) (p *Program, err error) {
+	c := &converter{program: &Program{}}
+
+	defer func() {
+		if r := recover(); r != nil {
+			cerr, ok := r.(*ast.Error)
+			if !ok {
+				panic(r)
+			}
+			err = cerr
+		}
+	}()
+
+	main := c.enter("", ast.Function{})
+	main.ir.Body = c.expr(f.Expression)
+	c.leave()
+	return c.program, nil
+}
+
+func (c *converter) errorf(loc ast.Location, format string, args ...any) {
+	panic(ast.Errorf(loc, format, args...))
+}
+
+func (c *converter) enter(name string, source ast.Function) *function {
+	fn := &function{
+		parent:  c.fn,
+		ir:      &Function{Index: len(c.program.Functions), Name: name, Source: source},
+		indices: make(map[string]int),
+	}
+	c.program.Functions = append(c.program.Functions, fn.ir)
+	c.fn = fn
+	return fn
+}
+
+func (c *converter) leave() {
+	c.fn = c.fn.parent
+}
+
+func (c *converter) declare(name string) int {
+	slot := c.fn.ir.Locals
+	c.fn.ir.Locals++
+	c.fn.scope = &scope{parent: c.fn.scope, name: name, slot: slot}
+	return slot
+}
+
+// resolve returns the expression reading name in fn, capturing it from the
+// enclosing functions when it is not local.
+func (c *converter) resolve(fn *function, name string) (Expr, bool) {
+	for s := fn.scope; s != nil; s = s.parent {
+		if s.name == name {
+			return Local{Slot: s.slot, Name: name}, true
+		}
+	}
+	if fn.ir.Name == name {
+		return Self{}, true
+	}
+	if index, ok := fn.indices[name]; ok {
+		return Capture{Index: index, Name: name}, true
+	}
+	if fn.parent == nil {
+		return nil, false
+	}
+	if _, ok := c.resolve(fn.parent, name); !ok {
+		return nil, false
+	}
+	index := len(fn.ir.Captures)
+	fn.ir.Captures = append(fn.ir.Captures, name)
+	fn.indices[name] = index
+	return Capture{Index: index, Name: name}, true
+}
+
+func (c *converter) expr(term ast.Term) Expr {
+	switch n := term.(type) {
+	case ast.Int:
+		return Int{Value: n.Value}
+	case ast.Str:
+		return Str{Value: n.Value}
+	case ast.Bool:
+		return Bool{Value: n.Value}
+	case ast.Var:
+		e, ok := c.resolve(c.fn, n.Text)
+		if !ok {
+			return Undefined{Name: n.Text, Location: n.Location}
+		}
+		return e
+	case ast.Let:
+		outer := c.fn.scope
+		var value Expr
+		if fn, ok := n.Value.(ast.Function); ok {
+			value = c.closure(fn, n.Name.Text)
+		} else {
+			value = c.expr(n.Value)
+		}
+		let := Let{Slot: c.declare(n.Name.Text), Name: n.Name.Text, Value: value}
+		if n.Next != nil {
+			let.Next = c.expr(n.Next)
+		}
+		c.fn.scope = outer
+		return let
+	case ast.Function:
+		return c.closure(n, "")
+	case ast.If:
+		return If{
+			Condition: c.expr(n.Condition),
+			Then:      c.expr(n.Then),
+			Otherwise: c.expr(n.Otherwise),
+			Location:  n.Location,
+		}
+	case ast.Binary:
+		return Binary{Op: n.Op, Lhs: c.expr(n.Lhs), Rhs: c.expr(n.Rhs), Location: n.Location}
+	case ast.Call:
+		name := "<anonymous>"
+		if v, ok := n.Callee.(ast.Var); ok {
+			name = v.Text
+		}
+		call := Call{Callee: c.expr(n.Callee), Name: name, Args: make([]Expr, len(n.Arguments)), Location: n.Location}
+		for i, arg := range n.Arguments {
+			call.Args[i] = c.expr(arg)
+		}
+		return call
+	case ast.Tuple:
+		return Tuple{First: c.expr(n.First), Second: c.expr(n.Second)}
+	case ast.Print:
+		return Print{Value: c.expr(n.Value)}
+	case ast.First:
+		return First{Value: c.expr(n.Value), Location: n.Location}
+	case ast.Second:
+		return Second{Value: c.expr(n.Value), Location: n.Location}
+	default:
+		c.errorf(ast.LocationOf(term), "unsupported term %T", term)
+		return nil
+	}
+}
+
+// closure lifts fn out and returns the expression creating its closure. name
+// is the let binding fn is the value of, so the function can call itself.
+func (c *converter) closure(fn ast.Function, name string) Closure {
+	inner := c.enter(name, fn)
+	for _, param := range fn.Parameters {
+		inner.ir.Params = append(inner.ir.Params, param.Text)
+		c.declare(param.Text)
+	}
+	inner.ir.Body = tail(c.expr(fn.Value))
+	c.leave()
+
+	captures := make([]Expr, len(inner.ir.Captures))
+	for i, name := range inner.ir.Captures {
+		captures[i], _ = c.resolve(c.fn, name)
+	}
+	return Closure{Function: inner.ir, Captures: captures}
+}
+
+// tail marks the calls whose result is the result of e.
+func tail(e Expr) Expr {
+	switch n := e.(type) {
+	case Call:
+		n.Tail = true
+		return n
+	case If:
+		n.Then, n.Otherwise = tail(n.Then), tail(n.Otherwise)
+		return n
+	case Let:
+		if n.Next != nil {
+			n.Next = tail(n.Next)
+		}
+		return n
+	}
+	return e
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/backend/c"
+	"github.com/ghhernandes/rinha-compiler-go/backend/golang"
+	"github.com/ghhernandes/rinha-compiler-go/backend/js"
+	"github.com/ghhernandes/rinha-compiler-go/backend/llvm"
+	"github.com/ghhernandes/rinha-compiler-go/backend/wasm"
+	"github.com/ghhernandes/rinha-compiler-go/diag"
+)
+
+// target is a code generation backend. compile is nil for targets whose
+// output cannot be turned into an executable. Native targets are compiled
+// whenever their toolchain is available, keeping the generated source next
+// to the executable.
+type target struct {
+	generate  func(w io.Writer, f *ast.File, sources *diag.SourceMap) error
+	compile   func(f *ast.File, sources *diag.SourceMap, output string) error
+	native    bool
+	available func() bool
+	ext       string
+}
+
+var targets = map[string]target{
+	"go": {generate: golang.Generate, compile: golang.Build},
+	"c": {
+		generate:  c.Generate,
+		compile:   c.Build,
+		native:    true,
+		available: func() bool { return c.Compiler() != "" },
+		ext:       ".c",
+	},
+	"llvm": {
+		generate:  llvm.Generate,
+		compile:   llvm.Build,
+		native:    true,
+		available: llvm.Available,
+		ext:       ".ll",
+	},
+	"js":   {generate: js.Generate},
+	"wasm": {generate: wasm.Generate, compile: wasm.Build},
+	"wat":  {generate: wasm.GenerateText},
+}
+
+// build translates a program for another target. The generated source goes
+// to -o, or stdout; with -compile, the executable goes to -o, or a file named
+// after the program. Native targets write both the source and, when they
+// can, the executable.
+func build(args []string) {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	name := fs.String("target", "go", "target language: go, c, llvm, js, wasm or wat")
+	output := fs.String("o", "", "output file")
+	compile := fs.Bool("compile", false, "compile the generated code into an executable")
+	fs.Parse(args)
+
+	file, sources := load(fs.Args())
+
+	t, ok := targets[*name]
+	if !ok {
+		exit(sources, fmt.Errorf("unknown target %q", *name))
+	}
+
+	base := strings.TrimSuffix(filepath.Base(file.Name), filepath.Ext(file.Name))
+	if t.native {
+		if *output == "" {
+			*output = base
+		}
+		*output = strings.TrimSuffix(*output, t.ext)
+		if *compile || t.available() {
+			if err := t.compile(file, sources, *output); err != nil {
+				exit(sources, err)
+			}
+			return
+		}
+		*output += t.ext
+		fmt.Fprintf(os.Stderr, "no %s toolchain found, only writing %s\n", *name, *output)
+	}
+
+	if *compile {
+		if t.compile == nil {
+			exit(sources, fmt.Errorf("target %q cannot be compiled", *name))
+		}
+		if *output == "" {
+			*output = base
+		}
+		if err := t.compile(file, sources, *output); err != nil {
+			exit(sources, err)
+		}
+		return
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			exit(sources, err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := t.generate(w, file, sources); err != nil {
+		exit(sources, err)
+	}
+}
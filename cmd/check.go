@@ -0,0 +1,22 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/ghhernandes/rinha-compiler-go/types"
+)
+
+// check type checks a program without running it and prints its type.
+func check(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	fs.Parse(args)
+
+	file, sources := load(fs.Args())
+
+	t, err := types.NewChecker().Infer(file.Expression)
+	if err != nil {
+		exit(sources, err)
+	}
+	fmt.Println(types.String(t))
+}
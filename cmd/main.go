@@ -3,32 +3,78 @@ package main
 import (
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/ghhernandes/rinha-compiler-go"
-	"github.com/ghhernandes/rinha-compiler-go/interpreter"
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/diag"
 )
 
+var commands = map[string]func(args []string){
+	"run":   run,
+	"check": check,
+	"repl":  startRepl,
+	"build": build,
+}
+
+// main dispatches to a subcommand. Without one, the arguments are handed to
+// run, so `rinha file.json` keeps working.
 func main() {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			cmd(args[1:])
+			return
+		}
+	}
+	run(args)
+}
+
+// load parses the program named by the first argument, or stdin when there
+// is none, and returns it with a source map for diagnostics.
+func load(args []string) (*ast.File, *diag.SourceMap) {
 	var (
-		f   io.Reader
-		err error
+		f       io.Reader
+		name    = "stdin"
+		sources = diag.NewSourceMap()
+		err     error
 	)
 
-	if len(os.Args) > 1 {
-		f, err = os.Open(os.Args[1])
+	if len(args) > 0 {
+		name = args[0]
+		sources.Dirs = []string{filepath.Dir(name)}
+		f, err = os.Open(name)
 		if err != nil {
-			panic(err)
+			exit(sources, err)
 		}
 	} else {
 		f = os.Stdin
 	}
 
-	ast, err := compiler.Parse(f)
+	file, err := parse(sources, name, f)
 	if err != nil {
-		panic(err)
+		exit(sources, err)
 	}
+	return file, sources
+}
 
-	if err := interpreter.New(os.Stdout, ast).Execute(); err != nil {
-		panic(err)
+// parse reads .rinha files with the native parser and anything else as the
+// JSON AST. Native sources are kept in sources for diagnostics.
+func parse(sources *diag.SourceMap, name string, r io.Reader) (*ast.File, error) {
+	if !strings.HasSuffix(name, ".rinha") {
+		return compiler.Parse(r)
+	}
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
 	}
+	sources.Add(name, string(src))
+	return compiler.ParseSource(name, strings.NewReader(string(src)))
+}
+
+// exit reports err and terminates with a non-zero status.
+func exit(sources *diag.SourceMap, err error) {
+	sources.Report(os.Stderr, err)
+	os.Exit(1)
 }
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/ghhernandes/rinha-compiler-go/diag"
+	"github.com/ghhernandes/rinha-compiler-go/repl"
+)
+
+// startRepl runs an interactive session on stdin.
+func startRepl(args []string) {
+	fs := flag.NewFlagSet("repl", flag.ExitOnError)
+	fs.Parse(args)
+
+	if err := repl.New(os.Stdout).Run(os.Stdin); err != nil {
+		exit(diag.NewSourceMap(), err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ghhernandes/rinha-compiler-go/interpreter"
+	"github.com/ghhernandes/rinha-compiler-go/memo"
+	"github.com/ghhernandes/rinha-compiler-go/optimize"
+	"github.com/ghhernandes/rinha-compiler-go/types"
+	"github.com/ghhernandes/rinha-compiler-go/vm"
+)
+
+func run(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	useVM := fs.Bool("vm", false, "run on the bytecode VM instead of the tree-walking interpreter")
+	typecheck := fs.Bool("typecheck", false, "refuse to run programs that fail the static type check")
+	noMemo := fs.Bool("no-memo", false, "disable memoization of pure function calls")
+	maxDepth := fs.Int("max-depth", interpreter.DEFAULT_MAX_DEPTH, "maximum depth of nested calls, or 0 for no limit")
+	timeout := fs.Duration("timeout", 0, "stop the program after this long, or 0 for no limit")
+	fuel := fs.Int("fuel", 0, "stop the program after this many evaluation steps, or 0 for no limit")
+	stats := fs.Bool("stats", false, "print memoization cache and optimizer statistics to stderr")
+	maxEntries := fs.Int("memo-entries", memo.DEFAULT_MAX_ENTRIES, "maximum number of memoized calls, or -1 for no limit")
+	maxBytes := fs.Int("memo-bytes", 0, "maximum estimated size in bytes of memoized calls, or 0 for no limit")
+	policy := fs.String("memo-policy", "lru", "memoization cache eviction policy: lru or lfu")
+	optimized := fs.Bool("optimize", false, "fold constant expressions, inline functions called once and drop unused lets before running the program")
+	dump := fs.Bool("dump-optimized", false, "print the optimized program as a JSON AST instead of running it")
+	fs.Parse(args)
+
+	file, sources := load(fs.Args())
+	if *optimized || *dump {
+		var report optimize.Stats
+		file, report = optimize.Optimize(file)
+		if *stats {
+			fmt.Fprintln(os.Stderr, report)
+		}
+	}
+	if *dump {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file); err != nil {
+			exit(sources, err)
+		}
+		return
+	}
+
+	p, err := memo.ParsePolicy(*policy)
+	if err != nil {
+		exit(sources, err)
+	}
+	cache := memo.New(memo.Config{MaxEntries: *maxEntries, MaxBytes: *maxBytes, Policy: p})
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	if *useVM {
+		// The VM does not memoize calls, so it has no cache to configure
+		// or report on.
+		set := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		for _, name := range []string{"no-memo", "memo-entries", "memo-bytes", "memo-policy"} {
+			if set[name] {
+				exit(sources, fmt.Errorf("-%s cannot be used with -vm, which does not memoize calls", name))
+			}
+		}
+		if *stats && !*optimized {
+			exit(sources, errors.New("-stats with -vm reports optimizer statistics only, so it needs -optimize"))
+		}
+		if *typecheck {
+			if err := types.Check(file); err != nil {
+				exit(sources, err)
+			}
+		}
+		opts := []vm.Option{vm.WithMaxDepth(*maxDepth)}
+		if *fuel > 0 {
+			opts = append(opts, vm.WithFuel(*fuel))
+		}
+		err = vm.Run(ctx, os.Stdout, file, opts...)
+	} else {
+		opts := []interpreter.Option{interpreter.WithCache(cache), interpreter.WithMaxDepth(*maxDepth)}
+		if *typecheck {
+			opts = append(opts, interpreter.WithTypeCheck())
+		}
+		if *fuel > 0 {
+			opts = append(opts, interpreter.WithFuel(*fuel))
+		}
+		if *noMemo {
+			opts = append(opts, interpreter.WithoutMemoization())
+		}
+		err = interpreter.New(os.Stdout, file, opts...).Execute(ctx)
+		if *stats {
+			fmt.Fprintln(os.Stderr, cache.Stats())
+		}
+	}
+	if err != nil {
+		exit(sources, err)
+	}
+}
@@ -1,19 +1,45 @@
 package compiler_test
 
 import (
-	"github.com/ghhernandes/rinha-compiler-go"
+	"context"
+	"github.com/ghhernandes/rinha-compiler-go/ast"
 	"github.com/ghhernandes/rinha-compiler-go/interpreter"
-	"os"
+	"github.com/ghhernandes/rinha-compiler-go/parser"
+	"github.com/ghhernandes/rinha-compiler-go/vm"
+	"io"
 	"testing"
 )
 
-func BenchmarkCompiler(t *testing.B) {
-	f, err := os.Open("files/fib.json")
+// fib is large enough for the cost of calls to outweigh the setup of an
+// execution, so the benchmarks compare the interpreter with the VM.
+const fib = `let fib = fn (n) => { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; print(fib(27))`
+
+func parseFib(t *testing.B) *ast.File {
+	file, err := parser.ParseString("fib.rinha", fib)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
+	return file
+}
+
+// BenchmarkCompiler runs the interpreter without memoization, which the VM
+// does not have and would otherwise make fib linear.
+func BenchmarkCompiler(t *testing.B) {
+	file := parseFib(t)
+
+	t.ResetTimer()
+
+	for i := 0; i < t.N; i++ {
+		if err := interpreter.New(io.Discard, file, interpreter.WithoutMemoization()).Execute(context.Background()); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func BenchmarkVM(t *testing.B) {
+	file := parseFib(t)
 
-	ast, err := compiler.Parse(f)
+	prog, err := vm.Compile(file)
 	if err != nil {
 		panic(err)
 	}
@@ -21,7 +47,7 @@ func BenchmarkCompiler(t *testing.B) {
 	t.ResetTimer()
 
 	for i := 0; i < t.N; i++ {
-		if err := interpreter.New(nil, ast).Execute(); err != nil {
+		if err := vm.New(io.Discard, prog).Execute(context.Background()); err != nil {
 			panic(err)
 		}
 	}
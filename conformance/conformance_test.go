@@ -0,0 +1,84 @@
+package conformance_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/interpreter"
+	"github.com/ghhernandes/rinha-compiler-go/parser"
+	"github.com/ghhernandes/rinha-compiler-go/runtime"
+	"github.com/ghhernandes/rinha-compiler-go/vm"
+)
+
+// implementations run a program, writing what it prints to w.
+var implementations = map[string]func(w io.Writer, f *ast.File) error{
+	"interpreter": func(w io.Writer, f *ast.File) error {
+		return interpreter.New(w, f).Execute(context.Background())
+	},
+	"interpreter without memoization": func(w io.Writer, f *ast.File) error {
+		return interpreter.New(w, f, interpreter.WithoutMemoization()).Execute(context.Background())
+	},
+	"vm": func(w io.Writer, f *ast.File) error {
+		return vm.Run(context.Background(), w, f)
+	},
+}
+
+// message returns the message err would be reported with, without its
+// location.
+func message(err error) string {
+	var (
+		rerr *runtime.RuntimeError
+		cerr *ast.Error
+	)
+	switch {
+	case errors.As(err, &rerr):
+		return rerr.Message
+	case errors.As(err, &cerr):
+		return cerr.Message
+	}
+	return err.Error()
+}
+
+func TestConformance(t *testing.T) {
+	programs, err := filepath.Glob("testdata/*.rinha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(programs) == 0 {
+		t.Fatal("no programs found")
+	}
+
+	for _, program := range programs {
+		src, err := os.ReadFile(program)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := os.ReadFile(strings.TrimSuffix(program, ".rinha") + ".out")
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := parser.ParseString(filepath.Base(program), string(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for name, run := range implementations {
+			t.Run(filepath.Base(program)+"/"+name, func(t *testing.T) {
+				var out bytes.Buffer
+				if err := run(&out, file); err != nil {
+					out.WriteString("error: " + message(err) + "\n")
+				}
+				if out.String() != string(want) {
+					t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,6 @@
+// Package conformance holds programs pinning down the semantics of Rinha that
+// every implementation must agree on, starting with lexical scoping.
+//
+// Each testdata/<name>.rinha program comes with testdata/<name>.out, holding
+// what it prints followed, when it fails, by a line "error: <message>".
+package conformance
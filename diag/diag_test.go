@@ -0,0 +1,118 @@
+package diag_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/diag"
+)
+
+func TestPosition(t *testing.T) {
+	src := diag.NewSource("test.rinha", "let x = 1;\n\tprint(\"é\" + x)\n")
+	tests := []struct {
+		offset int
+		want   diag.Position
+	}{
+		{0, diag.Position{Line: 1, Column: 1}},
+		{4, diag.Position{Line: 1, Column: 5}},
+		{10, diag.Position{Line: 1, Column: 11}},
+		{11, diag.Position{Line: 2, Column: 1}},
+		{12, diag.Position{Line: 2, Column: 2}},
+		{23, diag.Position{Line: 2, Column: 12}},
+		{100, diag.Position{Line: 3, Column: 1}},
+	}
+
+	for _, tt := range tests {
+		if got := src.Position(tt.offset); got != tt.want {
+			t.Errorf("offset %d: got %+v, want %+v", tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	sm := diag.NewSourceMap()
+	sm.Add("test.rinha", "let f = fn (n) => {\n\t1 / n\n};\nf(0)")
+
+	var b strings.Builder
+	sm.Render(&b, diag.Diagnostic{
+		Location: ast.Location{Start: 21, End: 26, Filename: "test.rinha"},
+		Message:  "division by zero",
+		Notes:    []string{"at f"},
+	})
+
+	want := "error: division by zero\n" +
+		" --> test.rinha:2:2\n" +
+		"  |\n" +
+		"2 | \t1 / n\n" +
+		"  | \t^^^^^\n" +
+		"  = at f\n"
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestRenderMissingSource(t *testing.T) {
+	var b strings.Builder
+	diag.NewSourceMap().Render(&b, diag.Diagnostic{
+		Severity: diag.Warning,
+		Location: ast.Location{Start: 1, End: 2, Filename: "missing.rinha"},
+		Message:  "unused",
+	})
+
+	want := "warning: unused\n --> missing.rinha@1..2\n"
+	if b.String() != want {
+		t.Errorf("got %q, want %q", b.String(), want)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	sm := diag.NewSourceMap()
+	sm.Add("test.rinha", "let x = 1;\nprint(x)")
+
+	tests := []struct {
+		loc  ast.Location
+		want string
+	}{
+		{ast.Location{Start: 17, End: 18, Filename: "test.rinha"}, "test.rinha:2:7"},
+		{ast.Location{Start: 6, End: 11, Filename: "missing.rinha"}, "missing.rinha@6..11"},
+	}
+
+	for _, tt := range tests {
+		if got := sm.Format(tt.loc); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestLoadFromDirs(t *testing.T) {
+	sm := diag.NewSourceMap("../files")
+	src, err := sm.Load("print.rinha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := src.Line(1); got != `print ("Hello world")` {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestReport(t *testing.T) {
+	sm := diag.NewSourceMap()
+	sm.Add("test.rinha", "print(x)")
+
+	var b strings.Builder
+	sm.Report(&b, fmt.Errorf("check: %w", ast.Errorf(ast.Location{Start: 6, End: 7, Filename: "test.rinha"}, "undefined variable %s", "x")))
+	sm.Report(&b, errors.New("no such file"))
+
+	want := "error: undefined variable x\n" +
+		" --> test.rinha:1:7\n" +
+		"  |\n" +
+		"1 | print(x)\n" +
+		"  |       ^\n" +
+		"error: no such file\n"
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
@@ -0,0 +1,148 @@
+package diag
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+func (s Severity) String() string {
+	if s == Warning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic is a message attached to a source location, produced by the
+// parser, static checks or the runtime. Notes are printed after the snippet.
+type Diagnostic struct {
+	Severity Severity
+	Location ast.Location
+	Message  string
+	Notes    []string
+}
+
+// Diagnoser is implemented by errors that can be reported as a Diagnostic.
+type Diagnoser interface {
+	Diagnostic() Diagnostic
+}
+
+// Render writes d in a human readable form:
+//
+//	error: division by zero
+//	 --> files/div.rinha:1:21
+//	  |
+//	1 | let f = fn (n) => { 1 / n }; f(0)
+//	  |                     ^^^^^
+//	  = at f
+//
+// When the source file cannot be found only the byte offsets are printed, as
+// files/div.rinha@20..25, so they are not mistaken for a line and column.
+func (m *SourceMap) Render(w io.Writer, d Diagnostic) {
+	fmt.Fprintf(w, "%s: %s\n", d.Severity, d.Message)
+
+	loc := d.Location
+	src, err := m.Load(loc.Filename)
+	if err != nil {
+		fmt.Fprintf(w, " --> %s\n", offsets(loc))
+		for _, note := range d.Notes {
+			fmt.Fprintf(w, "  = %s\n", note)
+		}
+		return
+	}
+
+	start := src.Position(loc.Start)
+	end := src.Position(loc.End)
+	line := src.Line(start.Line)
+	number := strconv.Itoa(start.Line)
+	gutter := strings.Repeat(" ", len(number))
+
+	// Spans crossing lines are underlined up to the end of the first one.
+	width := end.Column - start.Column
+	if end.Line != start.Line {
+		width = utf8.RuneCountInString(line) - start.Column + 1
+	}
+	if width < 1 {
+		width = 1
+	}
+
+	fmt.Fprintf(w, "%s--> %s:%d:%d\n", gutter, loc.Filename, start.Line, start.Column)
+	fmt.Fprintf(w, "%s |\n", gutter)
+	fmt.Fprintf(w, "%s | %s\n", number, line)
+	fmt.Fprintf(w, "%s | %s%s\n", gutter, indent(line, start.Column-1), strings.Repeat("^", width))
+	for _, note := range d.Notes {
+		fmt.Fprintf(w, "%s = %s\n", gutter, note)
+	}
+}
+
+// Report renders err as diagnostics when it, or any of the errors it joins,
+// is an *ast.Error or implements Diagnoser, and prints it as a plain error
+// otherwise.
+func (m *SourceMap) Report(w io.Writer, err error) {
+	if errs, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range errs.Unwrap() {
+			m.Report(w, err)
+		}
+		return
+	}
+	var (
+		d    Diagnoser
+		aerr *ast.Error
+	)
+	switch {
+	case errors.As(err, &d):
+		m.Render(w, d.Diagnostic())
+		return
+	case errors.As(err, &aerr):
+		m.Render(w, Diagnostic{Severity: Error, Location: aerr.Location, Message: aerr.Message})
+		return
+	}
+	fmt.Fprintf(w, "error: %s\n", err)
+}
+
+// Format converts offsets into file:line:column, falling back to the raw
+// offsets, as file@start..end, when the source cannot be loaded.
+func (m *SourceMap) Format(loc ast.Location) string {
+	src, err := m.Load(loc.Filename)
+	if err != nil {
+		return offsets(loc)
+	}
+	pos := src.Position(loc.Start)
+	return fmt.Sprintf("%s:%d:%d", loc.Filename, pos.Line, pos.Column)
+}
+
+// offsets formats the byte offsets of loc in a form that cannot be read as
+// file:line:column.
+func offsets(loc ast.Location) string {
+	return fmt.Sprintf("%s@%d..%d", loc.Filename, loc.Start, loc.End)
+}
+
+// indent returns the whitespace that aligns a caret under the given column,
+// keeping tabs so the underline matches the rendered line.
+func indent(line string, columns int) string {
+	var b strings.Builder
+	for _, r := range line {
+		if columns == 0 {
+			break
+		}
+		if r == '\t' {
+			b.WriteRune('\t')
+		} else {
+			b.WriteRune(' ')
+		}
+		columns--
+	}
+	return b.String()
+}
@@ -0,0 +1,106 @@
+package diag
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Position is a 1-based line and column. Columns count characters, not bytes.
+type Position struct {
+	Line   int
+	Column int
+}
+
+type Source struct {
+	Filename string
+	Text     string
+	lines    []int
+}
+
+func NewSource(filename, text string) *Source {
+	lines := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	return &Source{Filename: filename, Text: text, lines: lines}
+}
+
+// Position converts a byte offset into a line and column. Offsets past the
+// end of the text are clamped to it.
+func (s *Source) Position(offset int) Position {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(s.Text) {
+		offset = len(s.Text)
+	}
+	line := sort.Search(len(s.lines), func(i int) bool { return s.lines[i] > offset }) - 1
+	column := utf8.RuneCountInString(s.Text[s.lines[line]:offset]) + 1
+	return Position{Line: line + 1, Column: column}
+}
+
+// Line returns the text of a 1-based line without its line terminator.
+func (s *Source) Line(n int) string {
+	if n < 1 || n > len(s.lines) {
+		return ""
+	}
+	start := s.lines[n-1]
+	end := len(s.Text)
+	if n < len(s.lines) {
+		end = s.lines[n] - 1
+	}
+	return strings.TrimSuffix(s.Text[start:end], "\r")
+}
+
+// SourceMap caches source files by the name used in ast.Location.Filename.
+// Files that were not added explicitly are loaded from disk on first use,
+// trying the name as given and then relative to each of Dirs.
+type SourceMap struct {
+	Dirs []string
+
+	mu      sync.Mutex
+	sources map[string]*Source
+}
+
+func NewSourceMap(dirs ...string) *SourceMap {
+	return &SourceMap{Dirs: dirs, sources: make(map[string]*Source)}
+}
+
+func (m *SourceMap) Add(filename, text string) *Source {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	src := NewSource(filename, text)
+	m.sources[filename] = src
+	return src
+}
+
+func (m *SourceMap) Load(filename string) (*Source, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if src, ok := m.sources[filename]; ok {
+		return src, nil
+	}
+
+	text, err := os.ReadFile(filename)
+	for _, dir := range m.Dirs {
+		if err == nil || filepath.IsAbs(filename) {
+			break
+		}
+		text, err = os.ReadFile(filepath.Join(dir, filename))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	src := NewSource(filename, string(text))
+	m.sources[filename] = src
+	return src, nil
+}
@@ -1,122 +1,147 @@
 package interpreter
 
 import (
-	"strconv"
 	"strings"
 
 	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/runtime"
+	"github.com/ghhernandes/rinha-compiler-go/value"
 )
 
-func (i interpreter) eq(l, r ast.Term) ast.Term {
-	switch n := l.(type) {
-	case ast.Int:
-		return ast.Bool{Kind: ast.BOOL, Value: n.Value == r.(ast.Int).Value}
-	case ast.Str:
-		return ast.Bool{Kind: ast.BOOL, Value: n.Value == r.(ast.Str).Value}
-	case ast.Bool:
-		return ast.Bool{Kind: ast.BOOL, Value: n.Value == r.(ast.Bool).Value}
-	default:
-		return nil
-	}
+func (i *interpreter) mismatch(b ast.Binary, l, r value.Value) {
+	runtime.Errorf(runtime.TypeMismatch, b.Location, "invalid operands for %s: %s and %s", b.Op, value.KindOf(l), value.KindOf(r))
 }
 
-func (i interpreter) neq(l, r ast.Term) ast.Term {
-	switch n := l.(type) {
-	case ast.Int:
-		return ast.Bool{Kind: ast.BOOL, Value: n.Value != r.(ast.Int).Value}
-	case ast.Str:
-		return ast.Bool{Kind: ast.BOOL, Value: n.Value != r.(ast.Str).Value}
-	case ast.Bool:
-		return ast.Bool{Kind: ast.BOOL, Value: n.Value != r.(ast.Bool).Value}
-	default:
-		return nil
+func (i *interpreter) ints(b ast.Binary, l, r value.Value) (value.Int, value.Int) {
+	left, lok := l.(value.Int)
+	right, rok := r.(value.Int)
+	if !lok || !rok {
+		i.mismatch(b, l, r)
 	}
+	return left, right
 }
 
-func (i interpreter) lt(l, r ast.Term) ast.Term {
-	switch n := l.(type) {
-	case ast.Int:
-		return ast.Bool{Kind: ast.BOOL, Value: n.Value < r.(ast.Int).Value}
-	case ast.Str:
-		return ast.Bool{Kind: ast.BOOL, Value: n.Value < r.(ast.Str).Value}
-	default:
-		return nil
+func (i *interpreter) bools(b ast.Binary, l, r value.Value) (value.Bool, value.Bool) {
+	left, lok := l.(value.Bool)
+	right, rok := r.(value.Bool)
+	if !lok || !rok {
+		i.mismatch(b, l, r)
 	}
+	return left, right
 }
 
-func (i interpreter) lte(l, r ast.Term) ast.Term {
+func (i *interpreter) eq(b ast.Binary, l, r value.Value) value.Value {
 	switch n := l.(type) {
-	case ast.Int:
-		return ast.Bool{Kind: ast.BOOL, Value: n.Value <= r.(ast.Int).Value}
-	case ast.Str:
-		return ast.Bool{Kind: ast.BOOL, Value: n.Value <= r.(ast.Str).Value}
-	default:
-		return nil
+	case value.Int:
+		if m, ok := r.(value.Int); ok {
+			return value.Bool(n == m)
+		}
+	case value.Str:
+		if m, ok := r.(value.Str); ok {
+			return value.Bool(n == m)
+		}
+	case value.Bool:
+		if m, ok := r.(value.Bool); ok {
+			return value.Bool(n == m)
+		}
 	}
+	i.mismatch(b, l, r)
+	return nil
 }
 
-func (i interpreter) gt(l, r ast.Term) ast.Term {
-	switch n := l.(type) {
-	case ast.Int:
-		return ast.Bool{Kind: ast.BOOL, Value: n.Value > r.(ast.Int).Value}
-	case ast.Str:
-		return ast.Bool{Kind: ast.BOOL, Value: n.Value > r.(ast.Str).Value}
-	default:
-		return nil
-	}
+func (i *interpreter) neq(b ast.Binary, l, r value.Value) value.Value {
+	return !i.eq(b, l, r).(value.Bool)
 }
 
-func (i interpreter) gte(l, r ast.Term) ast.Term {
+// compare returns -1, 0 or 1 comparing two Ints or two Strs.
+func (i *interpreter) compare(b ast.Binary, l, r value.Value) int {
 	switch n := l.(type) {
-	case ast.Int:
-		return ast.Bool{Kind: ast.BOOL, Value: n.Value >= r.(ast.Int).Value}
-	case ast.Str:
-		return ast.Bool{Kind: ast.BOOL, Value: n.Value >= r.(ast.Str).Value}
-	default:
-		return nil
+	case value.Int:
+		if m, ok := r.(value.Int); ok {
+			switch {
+			case n < m:
+				return -1
+			case n > m:
+				return 1
+			}
+			return 0
+		}
+	case value.Str:
+		if m, ok := r.(value.Str); ok {
+			return strings.Compare(string(n), string(m))
+		}
 	}
+	i.mismatch(b, l, r)
+	return 0
 }
 
-func (i interpreter) and(l, r ast.Term) ast.Term {
-	return ast.Bool{Kind: ast.BOOL, Value: l.(ast.Bool).Value && r.(ast.Bool).Value}
+func (i *interpreter) lt(b ast.Binary, l, r value.Value) value.Value {
+	return value.Bool(i.compare(b, l, r) < 0)
 }
 
-func (i interpreter) or(l, r ast.Term) ast.Term {
-	return ast.Bool{Kind: ast.BOOL, Value: l.(ast.Bool).Value || r.(ast.Bool).Value}
+func (i *interpreter) lte(b ast.Binary, l, r value.Value) value.Value {
+	return value.Bool(i.compare(b, l, r) <= 0)
 }
 
-func (i interpreter) add(l, r ast.Term) ast.Term {
+func (i *interpreter) gt(b ast.Binary, l, r value.Value) value.Value {
+	return value.Bool(i.compare(b, l, r) > 0)
+}
+
+func (i *interpreter) gte(b ast.Binary, l, r value.Value) value.Value {
+	return value.Bool(i.compare(b, l, r) >= 0)
+}
+
+func (i *interpreter) and(b ast.Binary, l, r value.Value) value.Value {
+	left, right := i.bools(b, l, r)
+	return left && right
+}
+
+func (i *interpreter) or(b ast.Binary, l, r value.Value) value.Value {
+	left, right := i.bools(b, l, r)
+	return left || right
+}
+
+func (i *interpreter) add(b ast.Binary, l, r value.Value) value.Value {
 	switch left := l.(type) {
-	case ast.Int:
+	case value.Int:
 		switch right := r.(type) {
-		case ast.Int:
-			return ast.Int{Kind: ast.INT, Value: left.Value + right.Value}
-		case ast.Str:
-			return ast.Str{Kind: ast.STR, Value: strings.Join([]string{strconv.Itoa(int(left.Value)), right.Value}, "")}
+		case value.Int:
+			return left + right
+		case value.Str:
+			return value.Str(left.String() + string(right))
 		}
-	case ast.Str:
-		switch right := r.(type) {
-		case ast.Int:
-			return ast.Str{Kind: ast.STR, Value: strings.Join([]string{left.Value, strconv.Itoa(int(right.Value))}, "")}
-		case ast.Str:
-			return ast.Str{Kind: ast.STR, Value: left.Value + right.Value}
+	case value.Str:
+		switch r.(type) {
+		case value.Int, value.Str:
+			return value.Str(string(left) + r.String())
 		}
 	}
+	i.mismatch(b, l, r)
 	return nil
 }
 
-func (i interpreter) sub(l, r ast.Term) ast.Term {
-	return ast.Int{Kind: ast.INT, Value: l.(ast.Int).Value - r.(ast.Int).Value}
+func (i *interpreter) sub(b ast.Binary, l, r value.Value) value.Value {
+	left, right := i.ints(b, l, r)
+	return left - right
 }
 
-func (i interpreter) mul(l, r ast.Term) ast.Term {
-	return ast.Int{Kind: ast.INT, Value: l.(ast.Int).Value * r.(ast.Int).Value}
+func (i *interpreter) mul(b ast.Binary, l, r value.Value) value.Value {
+	left, right := i.ints(b, l, r)
+	return left * right
 }
 
-func (i interpreter) div(l, r ast.Term) ast.Term {
-	return ast.Int{Kind: ast.INT, Value: l.(ast.Int).Value / r.(ast.Int).Value}
+func (i *interpreter) div(b ast.Binary, l, r value.Value) value.Value {
+	left, right := i.ints(b, l, r)
+	if right == 0 {
+		runtime.Error(runtime.DivisionByZero, b.Location, "division by zero")
+	}
+	return left / right
 }
 
-func (i interpreter) rem(l, r ast.Term) ast.Term {
-	return ast.Int{Kind: ast.INT, Value: l.(ast.Int).Value % r.(ast.Int).Value}
+func (i *interpreter) rem(b ast.Binary, l, r value.Value) value.Value {
+	left, right := i.ints(b, l, r)
+	if right == 0 {
+		runtime.Error(runtime.DivisionByZero, b.Location, "division by zero")
+	}
+	return left % right
 }
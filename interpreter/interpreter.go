@@ -2,232 +2,420 @@ package interpreter
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"strconv"
+	"sort"
 
 	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/memo"
+	"github.com/ghhernandes/rinha-compiler-go/purity"
+	"github.com/ghhernandes/rinha-compiler-go/resolver"
 	"github.com/ghhernandes/rinha-compiler-go/runtime"
+	"github.com/ghhernandes/rinha-compiler-go/types"
+	"github.com/ghhernandes/rinha-compiler-go/value"
 )
 
-const MEMOIZE_DELIMITER = ","
+// DEFAULT_MAX_DEPTH bounds nested calls well before they exhaust the Go
+// stack. Tail calls do not count.
+const DEFAULT_MAX_DEPTH = 100000
+
+// CANCEL_CHECK_INTERVAL is how many steps run between checks of the
+// context, which are too costly to make on every node.
+const CANCEL_CHECK_INTERVAL = 1024
 
 type interpreter struct {
-	w   io.Writer
-	f   *ast.File
-	mem map[string]ast.Term
+	w         io.Writer
+	f         *ast.File
+	cache     memo.Cache
+	pure      purity.Set
+	stack     []string
+	typecheck bool
+	memoize   bool
+	maxDepth  int
+	fuel      int
+	steps     int
+	ctx       context.Context
 }
 
-func New(w io.Writer, f *ast.File) *interpreter {
-	return &interpreter{w: w, f: f, mem: make(map[string]ast.Term, 32)}
+type Option func(*interpreter)
+
+// WithTypeCheck makes Execute run the static type checker first and refuse
+// to run programs that are not well typed.
+func WithTypeCheck() Option {
+	return func(i *interpreter) {
+		i.typecheck = true
+	}
 }
 
-func (i interpreter) Execute() error {
-	scope := make(ast.Scope, ast.SCOPE_DEFAULT_SIZE)
-	ast.Walk(i, scope, i.f.Expression)
-	return nil
+// WithoutMemoization disables caching the results of pure function calls.
+func WithoutMemoization() Option {
+	return func(i *interpreter) {
+		i.memoize = false
+	}
 }
 
-func (i interpreter) printTuple(b *bytes.Buffer, scope ast.Scope, t ast.Tuple) {
-	printValueFn := func(node ast.Term) {
-		switch n := node.(type) {
-		case ast.Int:
-			b.WriteString(strconv.FormatInt(int64(n.Value), 10))
-		case ast.Str:
-			b.WriteString(n.Value)
-		case ast.Bool:
-			b.WriteString(strconv.FormatBool(n.Value))
-		case ast.Function:
-			b.WriteString("<#closure>")
-		default:
-			b.WriteString("nil")
+// WithCache stores the results of pure function calls in c instead of the
+// default bounded cache.
+func WithCache(c memo.Cache) Option {
+	return func(i *interpreter) {
+		i.cache = c
+	}
+}
+
+// WithMaxDepth limits how deeply calls may nest before execution fails with
+// a stack overflow error. A limit of 0 or less removes the check, leaving
+// deep recursion to crash the process.
+func WithMaxDepth(n int) Option {
+	return func(i *interpreter) {
+		i.maxDepth = n
+	}
+}
+
+// WithFuel limits every execution to n evaluation steps, one per evaluated
+// node. Running out fails with a runtime.OutOfFuel error.
+func WithFuel(n int) Option {
+	return func(i *interpreter) {
+		i.fuel = n
+	}
+}
+
+func New(w io.Writer, f *ast.File, opts ...Option) *interpreter {
+	i := &interpreter{
+		w:        w,
+		f:        f,
+		cache:    memo.New(memo.Config{}),
+		memoize:  true,
+		maxDepth: DEFAULT_MAX_DEPTH,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// Execute runs the program with an empty cache until it ends or ctx is done.
+// Runtime failures are returned as a *runtime.RuntimeError, and type errors
+// as types.Errors when the type check is enabled.
+func (i *interpreter) Execute(ctx context.Context) (err error) {
+	if i.typecheck {
+		if err := types.Check(i.f); err != nil {
+			return err
 		}
 	}
 
-	first := i.eval(scope, t.First)
-	second := i.eval(scope, t.Second)
+	i.cache.Reset()
+	_, err = i.Eval(ctx, make(ast.Scope, ast.SCOPE_DEFAULT_SIZE), i.f.Expression)
+	return err
+}
+
+// Eval evaluates a single term in scope. It is used by Execute and by
+// interactive sessions that keep their own top-level scope. The term is
+// resolved first, with the variables of scope in the outermost frame, and
+// scope itself is never modified. The fuel budget applies to each call.
+func (i *interpreter) Eval(ctx context.Context, scope ast.Scope, term ast.Term) (v value.Value, err error) {
+	globals := make([]string, 0, len(scope))
+	for name := range scope {
+		globals = append(globals, name)
+	}
+	sort.Strings(globals)
+	term, names := resolver.Resolve(term, globals)
+	env := ast.NewFrame(nil, len(names))
+	for index, name := range globals {
+		env.Slots[index] = scope[name]
+	}
+
+	// Closures record whether they are pure when they are created, so the
+	// functions of earlier terms need not be remembered.
+	i.pure = nil
+	if i.memoize {
+		i.pure = purity.Analyze(term)
+	}
+	i.stack = i.stack[:0]
+	i.steps, i.ctx = 0, ctx
+	defer runtime.Recover(&err, func() []string { return i.stack })
+
+	return i.eval(env, term), nil
+}
+
+// Reset drops every memoized call result.
+func (i *interpreter) Reset() {
+	i.cache.Reset()
+}
 
-	b.WriteString("(")
-	printValueFn(first)
-	b.WriteString(", ")
-	printValueFn(second)
-	b.WriteString(")")
+// Stats returns the counters of the memoization cache.
+func (i *interpreter) Stats() memo.Stats {
+	return i.cache.Stats()
 }
 
-func (i interpreter) eval(scope ast.Scope, expr ast.Term) ast.Term {
-	return ast.Walk(i, scope, expr)
+// eval evaluates expr and returns the resulting value.Value.
+func (i *interpreter) eval(env *ast.Frame, expr ast.Term) value.Value {
+	i.step(expr)
+	v, _ := ast.Walk(i, env, expr).(value.Value)
+	return v
 }
 
-func (i interpreter) Bool(scope ast.Scope, b ast.Bool) ast.Term {
-	return b
+// step accounts for evaluating expr, stopping the execution when it is out
+// of fuel or its context is done.
+func (i *interpreter) step(expr ast.Term) {
+	i.steps++
+	if i.fuel > 0 && i.steps > i.fuel {
+		runtime.Fail(runtime.OutOfFuel, ast.LocationOf(expr), fmt.Errorf("%w after %d steps", runtime.ErrOutOfFuel, i.fuel))
+	}
+	if i.steps%CANCEL_CHECK_INTERVAL == 0 {
+		select {
+		case <-i.ctx.Done():
+			runtime.Fail(runtime.Canceled, ast.LocationOf(expr), fmt.Errorf("execution stopped: %w", i.ctx.Err()))
+		default:
+		}
+	}
+}
+
+func (i *interpreter) Bool(env *ast.Frame, b ast.Bool) ast.Term {
+	return value.Bool(b.Value)
 }
 
-func (i interpreter) Int(scope ast.Scope, n ast.Int) ast.Term {
-	return n
+func (i *interpreter) Int(env *ast.Frame, n ast.Int) ast.Term {
+	return value.Int(n.Value)
 }
 
-func (i interpreter) Str(scope ast.Scope, s ast.Str) ast.Term {
-	return s
+func (i *interpreter) Str(env *ast.Frame, s ast.Str) ast.Term {
+	return value.Str(s.Value)
 }
 
-func (i interpreter) Binary(scope ast.Scope, binary ast.Binary) ast.Term {
-	left := i.eval(scope, binary.Lhs)
-	right := i.eval(scope, binary.Rhs)
+func (i *interpreter) Binary(env *ast.Frame, binary ast.Binary) ast.Term {
+	left := i.eval(env, binary.Lhs)
+	right := i.eval(env, binary.Rhs)
 	switch binary.Op {
 	case ast.Eq:
-		return i.eq(left, right)
+		return i.eq(binary, left, right)
 	case ast.Neq:
-		return i.neq(left, right)
+		return i.neq(binary, left, right)
 	case ast.Lt:
-		return i.lt(left, right)
+		return i.lt(binary, left, right)
 	case ast.Lte:
-		return i.lte(left, right)
+		return i.lte(binary, left, right)
 	case ast.Gt:
-		return i.gt(left, right)
+		return i.gt(binary, left, right)
 	case ast.Gte:
-		return i.gte(left, right)
+		return i.gte(binary, left, right)
 	case ast.And:
-		return i.and(left, right)
+		return i.and(binary, left, right)
 	case ast.Or:
-		return i.or(left, right)
+		return i.or(binary, left, right)
 	case ast.Add:
-		return i.add(left, right)
+		return i.add(binary, left, right)
 	case ast.Sub:
-		return i.sub(left, right)
+		return i.sub(binary, left, right)
 	case ast.Mul:
-		return i.mul(left, right)
+		return i.mul(binary, left, right)
 	case ast.Div:
-		return i.div(left, right)
+		return i.div(binary, left, right)
 	case ast.Rem:
-		return i.rem(left, right)
+		return i.rem(binary, left, right)
 	default:
+		runtime.Errorf(runtime.TypeMismatch, binary.Location, "unknown binary operator %s", binary.Op)
 		return nil
 	}
 }
 
-func (i interpreter) Let(scope ast.Scope, l ast.Let) ast.Term {
-	scope[l.Name.Text] = i.eval(scope, l.Value)
-	return i.eval(scope, l.Next)
+// Let stores the value in the slot of its binding. Every binding has a slot
+// of its own, so rebinding a name never changes what closures created
+// before see, and the binding is gone once its scope ends.
+func (i *interpreter) Let(env *ast.Frame, l ast.Let) ast.Term {
+	i.bind(env, l)
+	return i.eval(env, l.Next)
 }
 
-func (i interpreter) Function(scope ast.Scope, f ast.Function) ast.Term {
-	return ast.Function{
-		Kind:       f.Kind,
-		Parameters: f.Parameters,
-		Value:      f.Value,
-		Location:   f.Location,
-		Scope:      scope.Clone(),
+// bind stores the value of l in the slot of its binding. A function bound
+// by a let captures itself before the slot is set, so its own entry is
+// filled in afterwards.
+func (i *interpreter) bind(env *ast.Frame, l ast.Let) {
+	v := i.eval(env, l.Value)
+	env.Slots[l.Index] = v
+	if closure, ok := v.(*value.Closure); ok {
+		if _, ok := l.Value.(ast.Function); ok {
+			for index, free := range closure.Function.Free {
+				if free.Depth == 0 && free.Index == l.Index {
+					closure.Env.Slots[index] = closure
+				}
+			}
+		}
 	}
 }
 
-func (i interpreter) If(scope ast.Scope, cond ast.If) ast.Term {
-	condition := i.eval(scope, cond.Condition)
-	if condition.(ast.Bool).Value {
-		return i.eval(scope, cond.Then)
+// Function creates a closure holding the values of the free variables of
+// f, so it keeps alive only what it uses.
+func (i *interpreter) Function(env *ast.Frame, f ast.Function) ast.Term {
+	captured := ast.NewFrame(nil, len(f.Free))
+	for index, free := range f.Free {
+		captured.Slots[index] = env.Lookup(free.Depth, free.Index)
 	}
-	return i.eval(scope, cond.Otherwise)
+	return &value.Closure{Function: f, Env: captured, Pure: i.pure.Pure(f)}
+}
+
+func (i *interpreter) If(env *ast.Frame, cond ast.If) ast.Term {
+	return i.eval(env, i.branch(env, cond))
 }
 
-func (i interpreter) Var(scope ast.Scope, v ast.Var) ast.Term {
-	var (
-		r  ast.Term
-		ok bool
-	)
-	if r, ok = scope[v.Text]; !ok {
-		runtime.Error(v.Location, fmt.Sprintf("undefined variable %s", v.Text))
+// branch evaluates the condition of cond and returns the term to evaluate
+// next.
+func (i *interpreter) branch(env *ast.Frame, cond ast.If) ast.Term {
+	condition, ok := i.eval(env, cond.Condition).(value.Bool)
+	if !ok {
+		runtime.Error(runtime.TypeMismatch, cond.Location, "condition must be a Bool")
 	}
-	return r
+	if condition {
+		return cond.Then
+	}
+	return cond.Otherwise
 }
 
-func (i interpreter) Print(scope ast.Scope, p ast.Print) ast.Term {
+func (i *interpreter) Var(env *ast.Frame, v ast.Var) ast.Term {
+	if v.Depth < 0 {
+		runtime.Errorf(runtime.UndefinedVariable, v.Location, "undefined variable %s", v.Text)
+	}
+	return env.Lookup(v.Depth, v.Index)
+}
+
+func (i *interpreter) Print(env *ast.Frame, p ast.Print) ast.Term {
+	v := i.eval(env, p.Value)
 	if i.w == nil {
-		return nil
+		return v
 	}
 	var b bytes.Buffer
-	node := i.eval(scope, p.Value)
-	switch n := node.(type) {
-	case ast.Int:
-		b.WriteString(strconv.FormatInt(int64(n.Value), 10))
-	case ast.Str:
-		b.WriteString(n.Value)
-	case ast.Bool:
-		b.WriteString(strconv.FormatBool(n.Value))
-	case ast.Tuple:
-		i.printTuple(&b, scope, n)
-	case ast.Function:
-		b.WriteString("<#closure>")
-	default:
-		b.WriteString("nil")
-	}
+	b.WriteString(v.String())
 	b.WriteString("\n")
 	i.w.Write(b.Bytes())
-	return node
+	return v
+}
+
+// tailCall is a call in tail position, returned by tail so that apply runs
+// it in its own loop instead of a nested one.
+type tailCall struct {
+	fn   *value.Closure
+	args []value.Value
+	name string
+	loc  ast.Location
+}
+
+func (i *interpreter) Call(env *ast.Frame, c ast.Call) ast.Term {
+	return i.apply(i.prepare(env, c))
 }
 
-func (i interpreter) Call(scope ast.Scope, c ast.Call) ast.Term {
-	callee := i.eval(scope, c.Callee)
-	switch fn := callee.(type) {
-	case ast.Function:
-		if len(fn.Parameters) != len(c.Arguments) {
-			runtime.Error(c.Location, "wrong number of arguments")
+// prepare evaluates the callee and arguments of c.
+func (i *interpreter) prepare(env *ast.Frame, c ast.Call) *tailCall {
+	callee := i.eval(env, c.Callee)
+	fn, ok := callee.(*value.Closure)
+	if !ok {
+		runtime.Errorf(runtime.NotCallable, c.Location, "cannot call a %s", value.KindOf(callee))
+	}
+
+	name := "<anonymous>"
+	if v, ok := c.Callee.(ast.Var); ok {
+		name = v.Text
+	}
+	params := fn.Function.Parameters
+	if len(params) != len(c.Arguments) {
+		runtime.Errorf(runtime.WrongArity, c.Location, "wrong number of arguments: %s expects %d, got %d", name, len(params), len(c.Arguments))
+	}
+
+	args := make([]value.Value, len(params))
+	for index := range params {
+		args[index] = i.eval(env, c.Arguments[index])
+	}
+	return &tailCall{fn: fn, args: args, name: name, loc: c.Location}
+}
+
+// apply runs call and every call it makes in tail position in a single
+// loop, replacing its stack frame, so tail recursion runs in constant Go
+// stack.
+func (i *interpreter) apply(call *tailCall) value.Value {
+	// Only calls to pure functions are memoized, since a cached result
+	// would skip the side effects of running the body again.
+	memoize := i.memoize && call.fn.Pure
+	if memoize {
+		if memoized, ok := i.cache.Get(call.fn, call.args); ok {
+			return memoized
 		}
+	}
 
-		var b bytes.Buffer
+	if i.maxDepth > 0 && len(i.stack) >= i.maxDepth {
+		runtime.Errorf(runtime.StackOverflow, call.loc, "stack overflow: calls to %s nested more than %d deep", call.name, i.maxDepth)
+	}
+	i.stack = append(i.stack, call.name)
+	result := i.loop(call)
+	i.stack = i.stack[:len(i.stack)-1]
 
-		newScope := scope.Zip(fn.Scope)
+	if memoize {
+		i.cache.Put(call.fn, call.args, result)
+	}
+	return result
+}
 
-		if v, ok := c.Callee.(ast.Var); ok {
-			b.WriteString(v.Text)
-		} else {
-			b.WriteString(strconv.FormatInt(int64(fn.Location.Start), 10))
-			b.WriteString(MEMOIZE_DELIMITER)
-			b.WriteString(strconv.FormatInt(int64(fn.Location.End), 10))
+// loop runs the body of call until it ends in something other than a tail
+// call. Every call of the chain has the same result, so the chain stops at
+// the first one already memoized, but only the call that started it is
+// stored.
+func (i *interpreter) loop(call *tailCall) value.Value {
+	for {
+		env := ast.NewFrame(call.fn.Env, call.fn.Function.Slots)
+		for index, arg := range call.args {
+			env.Slots[index] = arg
 		}
-		b.WriteString(MEMOIZE_DELIMITER)
-
-		for index := 0; index < len(fn.Parameters); index++ {
-			value := i.eval(scope, c.Arguments[index])
-			newScope[fn.Parameters[index].Text] = value
-			switch v := value.(type) {
-			case ast.Int:
-				b.WriteString(strconv.FormatInt(int64(v.Value), 10))
-			case ast.Str:
-				b.WriteString(v.Value)
-			case ast.Bool:
-				b.WriteString(strconv.FormatBool(v.Value))
+
+		switch next := i.tail(env, call.fn.Function.Value).(type) {
+		case *tailCall:
+			if i.memoize && next.fn.Pure {
+				if memoized, ok := i.cache.Get(next.fn, next.args); ok {
+					return memoized
+				}
 			}
-			b.WriteString(MEMOIZE_DELIMITER)
+			call = next
+			i.stack[len(i.stack)-1] = call.name
+		default:
+			v, _ := next.(value.Value)
+			return v
 		}
+	}
+}
 
-		if memoized, ok := i.mem[b.String()]; ok {
-			return memoized
+// tail evaluates expr in tail position. Instead of running a call found
+// there, it returns it as a *tailCall for apply; any other term is
+// evaluated to a value.Value.
+func (i *interpreter) tail(env *ast.Frame, expr ast.Term) ast.Term {
+	for {
+		i.step(expr)
+		switch n := expr.(type) {
+		case ast.If:
+			expr = i.branch(env, n)
+		case ast.Let:
+			i.bind(env, n)
+			expr = n.Next
+		case ast.Call:
+			return i.prepare(env, n)
+		default:
+			return ast.Walk(i, env, expr)
 		}
-		evaluated := i.eval(newScope, fn.Value)
-		i.mem[b.String()] = evaluated
-		return evaluated
-	default:
-		return nil
 	}
 }
 
-func (i interpreter) Tuple(scope ast.Scope, t ast.Tuple) ast.Term {
-	return t
+func (i *interpreter) Tuple(env *ast.Frame, t ast.Tuple) ast.Term {
+	return &value.Tuple{First: i.eval(env, t.First), Second: i.eval(env, t.Second)}
 }
 
-func (i interpreter) First(scope ast.Scope, f ast.First) ast.Term {
-	node := i.eval(scope, f.Value)
-	if tuple, ok := node.(ast.Tuple); ok {
-		return i.eval(scope, tuple.First)
+func (i *interpreter) First(env *ast.Frame, f ast.First) ast.Term {
+	if tuple, ok := i.eval(env, f.Value).(*value.Tuple); ok {
+		return tuple.First
 	}
-	runtime.Error(f.Location, "not a tuple")
+	runtime.Error(runtime.NotATuple, f.Location, "not a tuple")
 	return nil
 }
 
-func (i interpreter) Second(scope ast.Scope, s ast.Second) ast.Term {
-	node := i.eval(scope, s.Value)
-	if tuple, ok := node.(ast.Tuple); ok {
-		return i.eval(scope, tuple.Second)
+func (i *interpreter) Second(env *ast.Frame, s ast.Second) ast.Term {
+	if tuple, ok := i.eval(env, s.Value).(*value.Tuple); ok {
+		return tuple.Second
 	}
-	runtime.Error(s.Location, "not a tuple")
+	runtime.Error(runtime.NotATuple, s.Location, "not a tuple")
 	return nil
 }
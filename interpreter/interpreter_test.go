@@ -1,10 +1,25 @@
 package interpreter_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"github.com/ghhernandes/rinha-compiler-go"
+	"github.com/ghhernandes/rinha-compiler-go/ast"
 	"github.com/ghhernandes/rinha-compiler-go/interpreter"
+	"github.com/ghhernandes/rinha-compiler-go/memo"
+	"github.com/ghhernandes/rinha-compiler-go/parser"
+	"github.com/ghhernandes/rinha-compiler-go/runtime"
+	"github.com/ghhernandes/rinha-compiler-go/types"
+	"github.com/ghhernandes/rinha-compiler-go/value"
+	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
 	"testing"
+	"time"
 )
 
 func TestInterpreter(t *testing.T) {
@@ -19,7 +34,7 @@ func TestInterpreter(t *testing.T) {
 	}
 
 	interpret := interpreter.New(nil, ast)
-	if err := interpret.Execute(); err != nil {
+	if err := interpret.Execute(context.Background()); err != nil {
 		t.Fail()
 	}
 }
@@ -37,6 +52,393 @@ func BenchmarkInterpreter(t *testing.B) {
 
 	interpret := interpreter.New(nil, ast)
 	for i := 0; i < t.N; i++ {
-		interpret.Execute()
+		interpret.Execute(context.Background())
+	}
+}
+
+// BenchmarkPrograms runs every program in files, with and without
+// memoization.
+func BenchmarkPrograms(b *testing.B) {
+	names, err := filepath.Glob("../files/*.rinha")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, name := range names {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		file, err := parser.ParseString(name, string(src))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, memo := range []bool{true, false} {
+			opts := []interpreter.Option{}
+			label := filepath.Base(name)
+			if !memo {
+				opts = append(opts, interpreter.WithoutMemoization())
+				label += "/no-memo"
+			}
+			b.Run(label, func(b *testing.B) {
+				interpret := interpreter.New(nil, file, opts...)
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if err := interpret.Execute(context.Background()); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkVariables runs a program dominated by variable lookups and calls,
+// with memoization off so every call is evaluated.
+func BenchmarkVariables(b *testing.B) {
+	file, err := parser.ParseString("bench.rinha", `
+		let a = 1;
+		let b = 2;
+		let c = 3;
+		let sum = fn (n, acc) => {
+			if (n == 0) { acc } else { sum(n - 1, acc + a + b + c + n) }
+		};
+		let fib = fn (n) => { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+		(sum(10000, 0), fib(18))`)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	interpret := interpreter.New(nil, file, interpreter.WithoutMemoization())
+	for i := 0; i < b.N; i++ {
+		if err := interpret.Execute(context.Background()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkListBuilding builds a list of tuples by recursion, so every call
+// takes a longer list than the one before it.
+func BenchmarkListBuilding(b *testing.B) {
+	file, err := parser.ParseString("bench.rinha", `
+		let build = fn (n, acc) => { if (n == 0) { acc } else { build(n - 1, (n, acc)) } };
+		first(build(20000, 0))`)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, memo := range []bool{true, false} {
+		opts := []interpreter.Option{}
+		label := "memo"
+		if !memo {
+			opts = append(opts, interpreter.WithoutMemoization())
+			label = "no-memo"
+		}
+		b.Run(label, func(b *testing.B) {
+			interpret := interpreter.New(nil, file, opts...)
+			for i := 0; i < b.N; i++ {
+				if err := interpret.Execute(context.Background()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		src   string
+		kind  runtime.ErrorKind
+		msg   string
+		stack []string
+	}{
+		{`print(x)`, runtime.UndefinedVariable, "test.rinha:6:7: undefined variable x", []string{}},
+		{`print("a" - 1)`, runtime.TypeMismatch, "test.rinha:6:13: invalid operands for Sub: Str and Int", []string{}},
+		{`if (1) { 1 } else { 2 }`, runtime.TypeMismatch, "test.rinha:0:23: condition must be a Bool", []string{}},
+		{`let f = fn (a) => { a }; f(1, 2)`, runtime.WrongArity, "test.rinha:25:32: wrong number of arguments: f expects 1, got 2", []string{}},
+		{`let x = 1; x(1)`, runtime.NotCallable, "test.rinha:11:15: cannot call a Int", []string{}},
+		{`second(1)`, runtime.NotATuple, "test.rinha:0:9: not a tuple", []string{}},
+		{
+			`let f = fn (n) => { if (n == 0) { 1 / n } else { 1 + f(n - 1) } }; f(2)`,
+			runtime.DivisionByZero, "test.rinha:34:39: division by zero", []string{"f", "f", "f"},
+		},
+		// Tail calls replace the frame of their caller.
+		{
+			`let f = fn (n) => { if (n == 0) { 1 / n } else { f(n - 1) } }; let g = fn () => { f(2) }; 1 + g()`,
+			runtime.DivisionByZero, "test.rinha:34:39: division by zero", []string{"f"},
+		},
+	}
+
+	for _, tt := range tests {
+		file, err := parser.ParseString("test.rinha", tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var rerr *runtime.RuntimeError
+		if err := interpreter.New(nil, file).Execute(context.Background()); !errors.As(err, &rerr) {
+			t.Errorf("%q: expected a runtime error, got %v", tt.src, err)
+			continue
+		}
+		if rerr.Kind != tt.kind || rerr.Error() != tt.msg || !reflect.DeepEqual(rerr.Stack, tt.stack) {
+			t.Errorf("%q: got %s %q %v, want %s %q %v", tt.src, rerr.Kind, rerr.Error(), rerr.Stack, tt.kind, tt.msg, tt.stack)
+		}
+	}
+}
+
+func TestTypeCheckOption(t *testing.T) {
+	file, err := parser.ParseString("test.rinha", `let _ = print("before"); 1 + true`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err = interpreter.New(&out, file, interpreter.WithTypeCheck()).Execute(context.Background())
+	if _, ok := err.(types.Errors); !ok {
+		t.Fatalf("expected type errors, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("program ran despite type errors: %q", out.String())
+	}
+}
+
+func TestTupleValues(t *testing.T) {
+	tests := []struct {
+		src string
+		out string
+	}{
+		{`let x = 1; let t = (x, 2); let f = fn (x) => { first(t) }; print(f(5))`, "1\n"},
+		{`print((1, ("a", (true, fn () => { 1 }))))`, "(1, (a, (true, <#closure>)))\n"},
+		{`let t = (print("once"), 2); second(t) + second(t)`, "once\n"},
+	}
+
+	for _, tt := range tests {
+		file, err := parser.ParseString("test.rinha", tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+		if err := interpreter.New(&out, file).Execute(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.out {
+			t.Errorf("%q: got %q, want %q", tt.src, out.String(), tt.out)
+		}
+	}
+}
+
+func TestClosureCaptures(t *testing.T) {
+	file, err := parser.ParseString("test.rinha", `let a = 1; let b = (2, 3); let c = "c"; fn (x) => { a + x + c }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := interpreter.New(nil, file).Eval(context.Background(), make(ast.Scope), file.Expression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closure, ok := v.(*value.Closure)
+	if !ok {
+		t.Fatalf("got %v, want a closure", v)
+	}
+	var free []string
+	for index, v := range closure.Function.Free {
+		free = append(free, fmt.Sprintf("%s = %v", v.Text, closure.Env.Slots[index]))
+	}
+	if want := []string{"a = 1", "c = c"}; !reflect.DeepEqual(free, want) {
+		t.Errorf("got free variables %q, want %q", free, want)
+	}
+	// b is not used, so the closure must not keep it, or the frame that
+	// holds it, alive.
+	if len(closure.Env.Slots) != 2 || closure.Env.Parent != nil {
+		t.Errorf("closure holds %d slots and a parent %v, want only its 2 free variables", len(closure.Env.Slots), closure.Env.Parent)
+	}
+}
+
+func TestMemoization(t *testing.T) {
+	tests := []struct {
+		src string
+		out string
+	}{
+		{`let log = fn (x) => { print(x) }; let _ = log(1); log(1)`, "1\n1\n"},
+		{`let log = fn (x) => { print(x) }; let f = fn (x) => { log(x) + 1 }; let _ = f(1); f(1)`, "1\n1\n"},
+		{`let fib = fn (n) => { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; print(fib(60))`, "1820529360\n"},
+		// Tuple arguments are part of the key.
+		{`let f = fn (t) => { first(t) + second(t) }; let _ = print(f((1, 2))); print(f((3, 4)))`, "3\n7\n"},
+		// Closures with the same name but different environments do not share results.
+		{`let mk = fn (n) => { fn (x) => { x + n } }; let a = mk(1); let b = mk(2); let _ = print(a(10)); print(b(10))`, "11\n12\n"},
+		{`let apply = fn (g, x) => { g(x) }; let _ = print(apply(fn (x) => { x + 1 }, 1)); print(apply(fn (x) => { x * 10 }, 1))`, "2\n10\n"},
+	}
+
+	for _, tt := range tests {
+		file, err := parser.ParseString("test.rinha", tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+		if err := interpreter.New(&out, file).Execute(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.out {
+			t.Errorf("%q: got %q, want %q", tt.src, out.String(), tt.out)
+		}
+	}
+}
+
+func TestWithoutMemoization(t *testing.T) {
+	file, err := parser.ParseString("test.rinha", `let f = fn (n) => { if (n < 2) { n } else { f(n - 1) + f(n - 2) } }; print(f(20))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := interpreter.New(&out, file, interpreter.WithoutMemoization()).Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "6765\n" {
+		t.Errorf("got %q", out.String())
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	file, err := parser.ParseString("test.rinha", `let f = fn (n) => { if (n < 2) { n } else { f(n - 1) + f(n - 2) } }; print(f(10))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	interpret := interpreter.New(io.Discard, file, interpreter.WithCache(memo.New(memo.Config{MaxEntries: 4})))
+	for run := 0; run < 2; run++ {
+		if err := interpret.Execute(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		// Every run starts from an empty cache.
+		stats := interpret.Stats()
+		if stats.Misses != 11 || stats.Hits != 8 || stats.Entries != 4 || stats.Evictions != 7 {
+			t.Errorf("run %d: got %+v", run, stats)
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	// A million nested calls would need far more than this, so the loops
+	// below only pass if tail calls do not grow the Go stack.
+	defer debug.SetMaxStack(debug.SetMaxStack(16 << 20))
+
+	tests := []struct {
+		src string
+		out string
+	}{
+		{`let loop = fn (n, acc) => { if (n == 0) { acc } else { loop(n - 1, acc + 1) } }; print(loop(1000000, 0))`, "1000000\n"},
+		// Tail position reaches through lets and both branches of an if.
+		{`let odd = fn (n, even) => { if (n == 0) { false } else { even(n - 1) } }; let even = fn (n) => { if (n == 0) { true } else { let m = n - 1; odd(m, even) } }; print(even(1000001))`, "false\n"},
+		// Impure tail calls run every print.
+		{`let count = fn (n) => { if (n == 0) { 0 } else { let _ = print(n); count(n - 1) } }; count(3)`, "3\n2\n1\n"},
+	}
+
+	for _, tt := range tests {
+		file, err := parser.ParseString("test.rinha", tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, opts := range [][]interpreter.Option{nil, {interpreter.WithoutMemoization()}} {
+			var out bytes.Buffer
+			if err := interpreter.New(&out, file, opts...).Execute(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.out {
+				t.Errorf("%q: got %q, want %q", tt.src, out.String(), tt.out)
+			}
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	const src = `let sum = fn (n) => { if (n == 0) { 0 } else { n + sum(n - 1) } }; print(sum(1000000))`
+	file, err := parser.ParseString("test.rinha", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		opts  []interpreter.Option
+		depth int
+	}{
+		{nil, interpreter.DEFAULT_MAX_DEPTH},
+		{[]interpreter.Option{interpreter.WithMaxDepth(50)}, 50},
+	}
+
+	for _, tt := range tests {
+		var rerr *runtime.RuntimeError
+		if err := interpreter.New(io.Discard, file, tt.opts...).Execute(context.Background()); !errors.As(err, &rerr) {
+			t.Fatalf("expected a runtime error, got %v", err)
+		}
+		want := fmt.Sprintf("test.rinha:51:61: stack overflow: calls to sum nested more than %d deep", tt.depth)
+		if rerr.Kind != runtime.StackOverflow || rerr.Error() != want {
+			t.Errorf("got %s %q, want %q", rerr.Kind, rerr.Error(), want)
+		}
+		if len(rerr.Stack) != tt.depth {
+			t.Errorf("got %d frames, want %d", len(rerr.Stack), tt.depth)
+		}
+	}
+
+	// Tail calls do not nest.
+	file, err = parser.ParseString("test.rinha", `let loop = fn (n) => { if (n == 0) { 0 } else { loop(n - 1) } }; loop(100)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := interpreter.New(nil, file, interpreter.WithMaxDepth(2)).Execute(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFuel(t *testing.T) {
+	file, err := parser.ParseString("test.rinha", `let loop = fn (n) => { loop(n + 1) }; loop(0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rerr *runtime.RuntimeError
+	err = interpreter.New(nil, file, interpreter.WithFuel(1000)).Execute(context.Background())
+	if !errors.As(err, &rerr) || rerr.Kind != runtime.OutOfFuel || !errors.Is(err, runtime.ErrOutOfFuel) {
+		t.Fatalf("expected an out of fuel error, got %v", err)
+	}
+	if rerr.Message != "out of fuel after 1000 steps" || rerr.Location.Start < 23 || rerr.Location.End > 36 {
+		t.Errorf("got %q at %v, want it inside the loop body", rerr.Message, rerr.Location)
+	}
+
+	// The budget is per execution.
+	file, err = parser.ParseString("test.rinha", `let f = fn (n) => { n + 1 }; f(1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interpret := interpreter.New(nil, file, interpreter.WithFuel(20))
+	for run := 0; run < 3; run++ {
+		if err := interpret.Execute(context.Background()); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	file, err := parser.ParseString("test.rinha", `let loop = fn (n) => { loop(n + 1) }; loop(0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var rerr *runtime.RuntimeError
+	err = interpreter.New(nil, file, interpreter.WithoutMemoization()).Execute(ctx)
+	if !errors.As(err, &rerr) || rerr.Kind != runtime.Canceled || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+	if rerr.Message != "execution stopped: context deadline exceeded" || rerr.Location.Filename != "test.rinha" {
+		t.Errorf("got %q at %v", rerr.Message, rerr.Location)
+	}
+	if errors.Is(err, runtime.ErrOutOfFuel) {
+		t.Error("a timeout is reported as out of fuel")
 	}
 }
@@ -0,0 +1,253 @@
+// Package memo holds the results of pure function calls made by the
+// interpreter, within configurable bounds.
+package memo
+
+import (
+	"container/heap"
+	"container/list"
+	"fmt"
+
+	"github.com/ghhernandes/rinha-compiler-go/value"
+)
+
+// DEFAULT_MAX_ENTRIES bounds caches built with a zero Config.
+const DEFAULT_MAX_ENTRIES = 1 << 16
+
+// Cache stores call results keyed on the closure called and its arguments.
+type Cache interface {
+	Get(fn *value.Closure, args []value.Value) (value.Value, bool)
+	Put(fn *value.Closure, args []value.Value, result value.Value)
+	// Reset drops every entry and zeroes the statistics.
+	Reset()
+	Stats() Stats
+}
+
+type Policy int
+
+const (
+	// LRU evicts the entry used least recently.
+	LRU Policy = iota
+	// LFU evicts the entry used least often, the oldest one on ties.
+	LFU
+)
+
+// ParsePolicy returns the policy named "lru" or "lfu".
+func ParsePolicy(name string) (Policy, error) {
+	switch name {
+	case "lru":
+		return LRU, nil
+	case "lfu":
+		return LFU, nil
+	}
+	return 0, fmt.Errorf("unknown eviction policy %q", name)
+}
+
+// Config bounds a cache. A zero MaxEntries means DEFAULT_MAX_ENTRIES, a
+// negative one no limit; a zero MaxBytes means no limit on the estimated
+// size.
+type Config struct {
+	MaxEntries int
+	MaxBytes   int
+	Policy     Policy
+}
+
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+	Bytes     int
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("memo: %d hits, %d misses, %d evictions, %d entries, %d bytes", s.Hits, s.Misses, s.Evictions, s.Entries, s.Bytes)
+}
+
+type key struct {
+	fn   *value.Closure
+	args uint64
+}
+
+type entry struct {
+	key    key
+	args   []value.Value
+	result value.Value
+	size   int
+
+	// Bookkeeping for the eviction policies.
+	elem  *list.Element
+	uses  uint64
+	tick  uint64
+	index int
+}
+
+// cache keeps its entries in an index for lookups and in a policy specific
+// order for eviction. Entries whose argument hashes collide share a slot of
+// the index and are told apart by comparing arguments.
+type cache struct {
+	config Config
+	index  map[key][]*entry
+	stats  Stats
+	order  order
+}
+
+// order tracks entries in eviction order.
+type order interface {
+	add(e *entry)
+	touch(e *entry)
+	remove(e *entry)
+	// victim returns the next entry to evict.
+	victim() *entry
+	reset()
+}
+
+func New(config Config) Cache {
+	if config.MaxEntries == 0 {
+		config.MaxEntries = DEFAULT_MAX_ENTRIES
+	}
+	c := &cache{config: config, index: make(map[key][]*entry, 32)}
+	switch config.Policy {
+	case LFU:
+		c.order = &lfu{}
+	default:
+		c.order = &lru{list: list.New()}
+	}
+	return c
+}
+
+func (c *cache) Get(fn *value.Closure, args []value.Value) (value.Value, bool) {
+	for _, e := range c.index[key{fn: fn, args: value.HashAll(args)}] {
+		if value.EqualAll(e.args, args) {
+			c.stats.Hits++
+			c.order.touch(e)
+			return e.result, true
+		}
+	}
+	c.stats.Misses++
+	return nil, false
+}
+
+func (c *cache) Put(fn *value.Closure, args []value.Value, result value.Value) {
+	e := &entry{key: key{fn: fn, args: value.HashAll(args)}, args: args, result: result}
+	e.size = entrySize(e)
+	if c.config.MaxBytes > 0 && e.size > c.config.MaxBytes {
+		return
+	}
+
+	// Room is made before adding the entry, so a new entry is never the
+	// victim of its own insertion.
+	for c.stats.Entries > 0 && !c.fits(e) {
+		c.evict(c.order.victim())
+	}
+
+	c.index[e.key] = append(c.index[e.key], e)
+	c.order.add(e)
+	c.stats.Entries++
+	c.stats.Bytes += e.size
+}
+
+func (c *cache) fits(e *entry) bool {
+	return (c.config.MaxEntries < 0 || c.stats.Entries < c.config.MaxEntries) &&
+		(c.config.MaxBytes <= 0 || c.stats.Bytes+e.size <= c.config.MaxBytes)
+}
+
+func (c *cache) evict(e *entry) {
+	slot := c.index[e.key]
+	for i, other := range slot {
+		if other == e {
+			slot = append(slot[:i], slot[i+1:]...)
+			break
+		}
+	}
+	if len(slot) == 0 {
+		delete(c.index, e.key)
+	} else {
+		c.index[e.key] = slot
+	}
+	c.order.remove(e)
+	c.stats.Entries--
+	c.stats.Bytes -= e.size
+	c.stats.Evictions++
+}
+
+func (c *cache) Reset() {
+	c.index = make(map[key][]*entry, 32)
+	c.order.reset()
+	c.stats = Stats{}
+}
+
+func (c *cache) Stats() Stats {
+	return c.stats
+}
+
+type lru struct {
+	list *list.List
+}
+
+func (l *lru) add(e *entry)    { e.elem = l.list.PushFront(e) }
+func (l *lru) touch(e *entry)  { l.list.MoveToFront(e.elem) }
+func (l *lru) remove(e *entry) { l.list.Remove(e.elem) }
+func (l *lru) victim() *entry  { return l.list.Back().Value.(*entry) }
+func (l *lru) reset()          { l.list.Init() }
+
+// lfu is a min-heap of entries ordered by use count, then by last use.
+type lfu struct {
+	entries []*entry
+	tick    uint64
+}
+
+func (l *lfu) Len() int { return len(l.entries) }
+
+func (l *lfu) Less(i, j int) bool {
+	a, b := l.entries[i], l.entries[j]
+	if a.uses != b.uses {
+		return a.uses < b.uses
+	}
+	return a.tick < b.tick
+}
+
+func (l *lfu) Swap(i, j int) {
+	l.entries[i], l.entries[j] = l.entries[j], l.entries[i]
+	l.entries[i].index = i
+	l.entries[j].index = j
+}
+
+func (l *lfu) Push(x any) {
+	e := x.(*entry)
+	e.index = len(l.entries)
+	l.entries = append(l.entries, e)
+}
+
+func (l *lfu) Pop() any {
+	last := len(l.entries) - 1
+	e := l.entries[last]
+	l.entries[last] = nil
+	l.entries = l.entries[:last]
+	return e
+}
+
+func (l *lfu) add(e *entry) {
+	l.tick++
+	e.uses, e.tick = 1, l.tick
+	heap.Push(l, e)
+}
+
+func (l *lfu) touch(e *entry) {
+	l.tick++
+	e.uses++
+	e.tick = l.tick
+	heap.Fix(l, e.index)
+}
+
+func (l *lfu) remove(e *entry) { heap.Remove(l, e.index) }
+func (l *lfu) victim() *entry  { return l.entries[0] }
+func (l *lfu) reset()          { l.entries, l.tick = nil, 0 }
+
+// entrySize estimates the memory held by an entry.
+func entrySize(e *entry) int {
+	size := 64
+	for _, arg := range e.args {
+		size += value.Size(arg)
+	}
+	return size + value.Size(e.result)
+}
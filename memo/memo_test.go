@@ -0,0 +1,133 @@
+package memo_test
+
+import (
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go/memo"
+	"github.com/ghhernandes/rinha-compiler-go/value"
+)
+
+func args(n int) []value.Value {
+	return []value.Value{value.Int(n)}
+}
+
+func cached(c memo.Cache, fn *value.Closure, ns ...int) []int {
+	var found []int
+	for _, n := range ns {
+		if _, ok := c.Get(fn, args(n)); ok {
+			found = append(found, n)
+		}
+	}
+	return found
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGetPut(t *testing.T) {
+	c := memo.New(memo.Config{})
+	f, g := &value.Closure{}, &value.Closure{}
+
+	c.Put(f, args(1), value.Int(10))
+	if v, ok := c.Get(f, args(1)); !ok || v != value.Int(10) {
+		t.Errorf("got %v, %v", v, ok)
+	}
+	if _, ok := c.Get(g, args(1)); ok {
+		t.Error("another closure shares the entry")
+	}
+	if _, ok := c.Get(f, args(2)); ok {
+		t.Error("other arguments share the entry")
+	}
+
+	tuple := []value.Value{&value.Tuple{First: value.Int(1), Second: value.Str("a")}}
+	c.Put(f, tuple, value.Int(20))
+	if v, ok := c.Get(f, []value.Value{&value.Tuple{First: value.Int(1), Second: value.Str("a")}}); !ok || v != value.Int(20) {
+		t.Errorf("equal tuple: got %v, %v", v, ok)
+	}
+
+	want := memo.Stats{Hits: 2, Misses: 2, Entries: 2, Bytes: c.Stats().Bytes}
+	if got := c.Stats(); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	c.Reset()
+	if got := c.Stats(); got != (memo.Stats{}) {
+		t.Errorf("stats after reset: %+v", got)
+	}
+	if _, ok := c.Get(f, args(1)); ok {
+		t.Error("entry survived reset")
+	}
+}
+
+func TestLRU(t *testing.T) {
+	c := memo.New(memo.Config{MaxEntries: 2, Policy: memo.LRU})
+	f := &value.Closure{}
+
+	c.Put(f, args(1), value.Int(1))
+	c.Put(f, args(2), value.Int(2))
+	c.Get(f, args(1))
+	c.Put(f, args(3), value.Int(3))
+
+	if got := cached(c, f, 1, 2, 3); !equal(got, []int{1, 3}) {
+		t.Errorf("cached %v, want [1 3]", got)
+	}
+	if got := c.Stats().Evictions; got != 1 {
+		t.Errorf("got %d evictions, want 1", got)
+	}
+}
+
+func TestLFU(t *testing.T) {
+	c := memo.New(memo.Config{MaxEntries: 2, Policy: memo.LFU})
+	f := &value.Closure{}
+
+	c.Put(f, args(1), value.Int(1))
+	c.Put(f, args(2), value.Int(2))
+	c.Get(f, args(1))
+	c.Get(f, args(1))
+	c.Get(f, args(2))
+	// 2 was used last, but less often than 1.
+	c.Put(f, args(3), value.Int(3))
+
+	if got := cached(c, f, 1, 2, 3); !equal(got, []int{1, 3}) {
+		t.Errorf("cached %v, want [1 3]", got)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	c := memo.New(memo.Config{MaxEntries: -1, MaxBytes: 300})
+	f := &value.Closure{}
+
+	for n := 0; n < 100; n++ {
+		c.Put(f, args(n), value.Int(n))
+	}
+	stats := c.Stats()
+	if stats.Bytes > 300 || stats.Entries == 0 {
+		t.Errorf("got %+v", stats)
+	}
+	if int(stats.Evictions)+stats.Entries != 100 {
+		t.Errorf("entries and evictions do not add up: %+v", stats)
+	}
+
+	c.Put(f, []value.Value{value.Str(string(make([]byte, 1000)))}, value.Int(0))
+	if c.Stats().Bytes > 300 {
+		t.Error("stored an entry larger than the cache")
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	if p, err := memo.ParsePolicy("lfu"); err != nil || p != memo.LFU {
+		t.Errorf("got %v, %v", p, err)
+	}
+	if _, err := memo.ParsePolicy("fifo"); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,335 @@
+package optimize
+
+import (
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/closure"
+)
+
+// scope lists the names bound around a term.
+type scope struct {
+	parent *scope
+	name   string
+}
+
+func (s *scope) bound(name string) bool {
+	for ; s != nil; s = s.parent {
+		if s.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *scope) bind(name string) *scope {
+	return &scope{parent: s, name: name}
+}
+
+// uses counts the variables of term reading name, leaving out those inside
+// bindings that shadow it.
+func uses(name string, term ast.Term) int {
+	switch n := term.(type) {
+	case ast.Var:
+		if n.Text == name {
+			return 1
+		}
+	case ast.Let:
+		count := 0
+		if _, ok := n.Value.(ast.Function); !ok || n.Name.Text != name {
+			count += uses(name, n.Value)
+		}
+		if n.Next != nil && n.Name.Text != name {
+			count += uses(name, n.Next)
+		}
+		return count
+	case ast.Function:
+		for _, param := range n.Parameters {
+			if param.Text == name {
+				return 0
+			}
+		}
+		return uses(name, n.Value)
+	case ast.If:
+		return uses(name, n.Condition) + uses(name, n.Then) + uses(name, n.Otherwise)
+	case ast.Binary:
+		return uses(name, n.Lhs) + uses(name, n.Rhs)
+	case ast.Call:
+		count := uses(name, n.Callee)
+		for _, arg := range n.Arguments {
+			count += uses(name, arg)
+		}
+		return count
+	case ast.Tuple:
+		return uses(name, n.First) + uses(name, n.Second)
+	case ast.Print:
+		return uses(name, n.Value)
+	case ast.First:
+		return uses(name, n.Value)
+	case ast.Second:
+		return uses(name, n.Value)
+	}
+	return 0
+}
+
+// Inline replaces calls to functions bound by a let and called exactly
+// once, in the rest of the let, with their body. The arguments are bound to
+// the parameters by lets, so they are still evaluated once and in order.
+// Recursive functions are left alone, and so are calls where a variable the
+// function uses would be shadowed. The lets of inlined functions are left
+// in place for RemoveDeadLets. It returns the number of calls inlined.
+func Inline(term ast.Term) (ast.Term, int) {
+	in := &inliner{captures: closure.Analyze(term)}
+	return in.walk(term), in.inlined
+}
+
+type inliner struct {
+	captures closure.Captures
+	inlined  int
+}
+
+func (in *inliner) walk(term ast.Term) ast.Term {
+	switch n := term.(type) {
+	case ast.Let:
+		if fn, ok := n.Value.(ast.Function); ok && n.Next != nil && uses(n.Name.Text, fn.Value) == 0 && uses(n.Name.Text, n.Next) == 1 {
+			if next, ok := in.replace(n.Name.Text, fn, n.Next, nil); ok {
+				n.Next = next
+				in.inlined++
+			}
+		}
+		n.Value = in.walk(n.Value)
+		if n.Next != nil {
+			n.Next = in.walk(n.Next)
+		}
+		return n
+	case ast.Function:
+		n.Value = in.walk(n.Value)
+		return n
+	case ast.If:
+		n.Condition = in.walk(n.Condition)
+		n.Then = in.walk(n.Then)
+		n.Otherwise = in.walk(n.Otherwise)
+		return n
+	case ast.Binary:
+		n.Lhs = in.walk(n.Lhs)
+		n.Rhs = in.walk(n.Rhs)
+		return n
+	case ast.Call:
+		n.Callee = in.walk(n.Callee)
+		args := make([]ast.Term, len(n.Arguments))
+		for i, arg := range n.Arguments {
+			args[i] = in.walk(arg)
+		}
+		n.Arguments = args
+		return n
+	case ast.Tuple:
+		n.First = in.walk(n.First)
+		n.Second = in.walk(n.Second)
+		return n
+	case ast.Print:
+		n.Value = in.walk(n.Value)
+		return n
+	case ast.First:
+		n.Value = in.walk(n.Value)
+		return n
+	case ast.Second:
+		n.Value = in.walk(n.Value)
+		return n
+	}
+	return term
+}
+
+// replace finds the only use of name in term, which must be a call, and
+// replaces it with the body of fn. bound holds the names bound between the
+// let of name and term.
+func (in *inliner) replace(name string, fn ast.Function, term ast.Term, bound *scope) (ast.Term, bool) {
+	var ok bool
+	switch n := term.(type) {
+	case ast.Let:
+		if _, isFn := n.Value.(ast.Function); isFn && n.Name.Text == name {
+			return term, false
+		}
+		if uses(name, n.Value) > 0 {
+			inner := bound
+			if _, isFn := n.Value.(ast.Function); isFn {
+				inner = bound.bind(n.Name.Text)
+			}
+			n.Value, ok = in.replace(name, fn, n.Value, inner)
+		} else if n.Next != nil && n.Name.Text != name {
+			n.Next, ok = in.replace(name, fn, n.Next, bound.bind(n.Name.Text))
+		}
+		return n, ok
+	case ast.Function:
+		inner := bound
+		for _, param := range n.Parameters {
+			if param.Text == name {
+				return term, false
+			}
+			inner = inner.bind(param.Text)
+		}
+		n.Value, ok = in.replace(name, fn, n.Value, inner)
+		return n, ok
+	case ast.If:
+		switch {
+		case uses(name, n.Condition) > 0:
+			n.Condition, ok = in.replace(name, fn, n.Condition, bound)
+		case uses(name, n.Then) > 0:
+			n.Then, ok = in.replace(name, fn, n.Then, bound)
+		default:
+			n.Otherwise, ok = in.replace(name, fn, n.Otherwise, bound)
+		}
+		return n, ok
+	case ast.Binary:
+		if uses(name, n.Lhs) > 0 {
+			n.Lhs, ok = in.replace(name, fn, n.Lhs, bound)
+		} else {
+			n.Rhs, ok = in.replace(name, fn, n.Rhs, bound)
+		}
+		return n, ok
+	case ast.Call:
+		if callee, isVar := n.Callee.(ast.Var); isVar && callee.Text == name {
+			return in.expand(fn, n, bound)
+		}
+		if uses(name, n.Callee) > 0 {
+			n.Callee, ok = in.replace(name, fn, n.Callee, bound)
+			return n, ok
+		}
+		args := make([]ast.Term, len(n.Arguments))
+		copy(args, n.Arguments)
+		for i, arg := range args {
+			if uses(name, arg) > 0 {
+				args[i], ok = in.replace(name, fn, arg, bound)
+				break
+			}
+		}
+		n.Arguments = args
+		return n, ok
+	case ast.Tuple:
+		if uses(name, n.First) > 0 {
+			n.First, ok = in.replace(name, fn, n.First, bound)
+		} else {
+			n.Second, ok = in.replace(name, fn, n.Second, bound)
+		}
+		return n, ok
+	case ast.Print:
+		n.Value, ok = in.replace(name, fn, n.Value, bound)
+		return n, ok
+	case ast.First:
+		n.Value, ok = in.replace(name, fn, n.Value, bound)
+		return n, ok
+	case ast.Second:
+		n.Value, ok = in.replace(name, fn, n.Value, bound)
+		return n, ok
+	}
+	return term, false
+}
+
+// expand returns the body of fn with the arguments of call bound to its
+// parameters, when that keeps every variable pointing at the same binding.
+func (in *inliner) expand(fn ast.Function, call ast.Call, bound *scope) (ast.Term, bool) {
+	if len(call.Arguments) != len(fn.Parameters) {
+		return call, false
+	}
+	for _, name := range in.captures.Of(fn) {
+		if bound.bound(name) {
+			return call, false
+		}
+	}
+	// An argument must not read a parameter bound before it.
+	for i, param := range fn.Parameters {
+		for _, arg := range call.Arguments[i+1:] {
+			if uses(param.Text, arg) > 0 {
+				return call, false
+			}
+		}
+	}
+
+	body := fn.Value
+	for i := len(fn.Parameters) - 1; i >= 0; i-- {
+		param := fn.Parameters[i]
+		body = ast.Let{
+			Kind:     ast.LET,
+			Name:     param,
+			Value:    call.Arguments[i],
+			Next:     body,
+			Location: call.Location,
+		}
+	}
+	return body, true
+}
+
+// RemoveDeadLets removes the lets whose binding is never used and whose
+// value can be dropped: literals, functions, tuples of those and variables
+// that are in scope. It returns the number of lets removed.
+func RemoveDeadLets(term ast.Term) (ast.Term, int) {
+	removed := 0
+	return removeDeadLets(term, nil, &removed), removed
+}
+
+func removeDeadLets(term ast.Term, bound *scope, removed *int) ast.Term {
+	switch n := term.(type) {
+	case ast.Let:
+		if n.Next != nil && uses(n.Name.Text, n.Next) == 0 && droppable(n.Value, bound) {
+			*removed++
+			return removeDeadLets(n.Next, bound, removed)
+		}
+		inner := bound.bind(n.Name.Text)
+		if _, ok := n.Value.(ast.Function); ok {
+			n.Value = removeDeadLets(n.Value, inner, removed)
+		} else {
+			n.Value = removeDeadLets(n.Value, bound, removed)
+		}
+		if n.Next != nil {
+			n.Next = removeDeadLets(n.Next, inner, removed)
+		}
+		return n
+	case ast.Function:
+		inner := bound
+		for _, param := range n.Parameters {
+			inner = inner.bind(param.Text)
+		}
+		n.Value = removeDeadLets(n.Value, inner, removed)
+		return n
+	case ast.If:
+		n.Condition = removeDeadLets(n.Condition, bound, removed)
+		n.Then = removeDeadLets(n.Then, bound, removed)
+		n.Otherwise = removeDeadLets(n.Otherwise, bound, removed)
+		return n
+	case ast.Binary:
+		n.Lhs = removeDeadLets(n.Lhs, bound, removed)
+		n.Rhs = removeDeadLets(n.Rhs, bound, removed)
+		return n
+	case ast.Call:
+		n.Callee = removeDeadLets(n.Callee, bound, removed)
+		args := make([]ast.Term, len(n.Arguments))
+		for i, arg := range n.Arguments {
+			args[i] = removeDeadLets(arg, bound, removed)
+		}
+		n.Arguments = args
+		return n
+	case ast.Tuple:
+		n.First = removeDeadLets(n.First, bound, removed)
+		n.Second = removeDeadLets(n.Second, bound, removed)
+		return n
+	case ast.Print:
+		n.Value = removeDeadLets(n.Value, bound, removed)
+		return n
+	case ast.First:
+		n.Value = removeDeadLets(n.Value, bound, removed)
+		return n
+	case ast.Second:
+		n.Value = removeDeadLets(n.Value, bound, removed)
+		return n
+	}
+	return term
+}
+
+// droppable reports whether term can be left unevaluated without changing
+// what the program does.
+func droppable(term ast.Term, bound *scope) bool {
+	switch n := term.(type) {
+	case ast.Var:
+		return bound.bound(n.Text)
+	case ast.Tuple:
+		return droppable(n.First, bound) && droppable(n.Second, bound)
+	}
+	return isValue(term)
+}
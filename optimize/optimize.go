@@ -0,0 +1,241 @@
+// Package optimize rewrites programs into simpler ones that behave the same:
+// they print the same output and fail with the same runtime errors.
+package optimize
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+)
+
+// Stats describes what Optimize did to a program.
+type Stats struct {
+	Inlined  int // calls replaced by the body of the function
+	DeadLets int // lets removed because their binding was never used
+	Removed  int // nodes the program lost
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("optimize: %d calls inlined, %d dead lets, %d nodes removed", s.Inlined, s.DeadLets, s.Removed)
+}
+
+// Optimize returns a copy of f with every optimization applied, repeated
+// until none of them changes the program anymore. f is left untouched.
+func Optimize(f *ast.File) (*ast.File, Stats) {
+	var stats Stats
+	term := Fold(f.Expression)
+	for {
+		var inlined, dead int
+		term, inlined = Inline(term)
+		term, dead = RemoveDeadLets(term)
+		if inlined == 0 && dead == 0 {
+			break
+		}
+		term = Fold(term)
+		stats.Inlined += inlined
+		stats.DeadLets += dead
+	}
+	stats.Removed = Size(f.Expression) - Size(term)
+
+	optimized := *f
+	optimized.Expression = term
+	return &optimized, stats
+}
+
+// Size returns the number of nodes of term.
+func Size(term ast.Term) int {
+	switch n := term.(type) {
+	case ast.Let:
+		size := 1 + Size(n.Value)
+		if n.Next != nil {
+			size += Size(n.Next)
+		}
+		return size
+	case ast.Function:
+		return 1 + Size(n.Value)
+	case ast.If:
+		return 1 + Size(n.Condition) + Size(n.Then) + Size(n.Otherwise)
+	case ast.Binary:
+		return 1 + Size(n.Lhs) + Size(n.Rhs)
+	case ast.Call:
+		size := 1 + Size(n.Callee)
+		for _, arg := range n.Arguments {
+			size += Size(arg)
+		}
+		return size
+	case ast.Tuple:
+		return 1 + Size(n.First) + Size(n.Second)
+	case ast.Print:
+		return 1 + Size(n.Value)
+	case ast.First:
+		return 1 + Size(n.Value)
+	case ast.Second:
+		return 1 + Size(n.Value)
+	}
+	return 1
+}
+
+// Fold returns term with its constant parts evaluated: binary operations on
+// literals, ifs on literal conditions and first or second of literal
+// tuples. Operations that would fail at runtime, like a division by zero,
+// are left for the runtime to report.
+func Fold(term ast.Term) ast.Term {
+	switch n := term.(type) {
+	case ast.Let:
+		n.Value = Fold(n.Value)
+		if n.Next != nil {
+			n.Next = Fold(n.Next)
+		}
+		return n
+	case ast.Function:
+		n.Value = Fold(n.Value)
+		return n
+	case ast.If:
+		n.Condition = Fold(n.Condition)
+		n.Then = Fold(n.Then)
+		n.Otherwise = Fold(n.Otherwise)
+		if condition, ok := n.Condition.(ast.Bool); ok {
+			if condition.Value {
+				return n.Then
+			}
+			return n.Otherwise
+		}
+		return n
+	case ast.Binary:
+		n.Lhs = Fold(n.Lhs)
+		n.Rhs = Fold(n.Rhs)
+		if folded, ok := binary(n); ok {
+			return folded
+		}
+		return n
+	case ast.Call:
+		n.Callee = Fold(n.Callee)
+		args := make([]ast.Term, len(n.Arguments))
+		for i, arg := range n.Arguments {
+			args[i] = Fold(arg)
+		}
+		n.Arguments = args
+		return n
+	case ast.Tuple:
+		n.First = Fold(n.First)
+		n.Second = Fold(n.Second)
+		return n
+	case ast.Print:
+		n.Value = Fold(n.Value)
+		return n
+	case ast.First:
+		n.Value = Fold(n.Value)
+		if tuple, ok := n.Value.(ast.Tuple); ok && isValue(tuple.Second) {
+			return tuple.First
+		}
+		return n
+	case ast.Second:
+		n.Value = Fold(n.Value)
+		if tuple, ok := n.Value.(ast.Tuple); ok && isValue(tuple.First) {
+			return tuple.Second
+		}
+		return n
+	}
+	return term
+}
+
+// isValue reports whether evaluating term can neither fail nor have side
+// effects, so it can be dropped.
+func isValue(term ast.Term) bool {
+	switch n := term.(type) {
+	case ast.Int, ast.Str, ast.Bool, ast.Function:
+		return true
+	case ast.Tuple:
+		return isValue(n.First) && isValue(n.Second)
+	}
+	return false
+}
+
+// binary evaluates b when both of its operands are literals, following the
+// rules of the interpreter. It reports false when they are not, or when the
+// operation fails.
+func binary(b ast.Binary) (ast.Term, bool) {
+	loc := b.Location
+	integer := func(v int32) ast.Term { return ast.Int{Kind: ast.INT, Value: v, Location: loc} }
+	boolean := func(v bool) ast.Term { return ast.Bool{Kind: ast.BOOL, Value: v, Location: loc} }
+	str := func(v string) ast.Term { return ast.Str{Kind: ast.STR, Value: v, Location: loc} }
+
+	switch l := b.Lhs.(type) {
+	case ast.Int:
+		switch r := b.Rhs.(type) {
+		case ast.Int:
+			switch b.Op {
+			case ast.Add:
+				return integer(l.Value + r.Value), true
+			case ast.Sub:
+				return integer(l.Value - r.Value), true
+			case ast.Mul:
+				return integer(l.Value * r.Value), true
+			case ast.Div:
+				if r.Value != 0 {
+					return integer(l.Value / r.Value), true
+				}
+			case ast.Rem:
+				if r.Value != 0 {
+					return integer(l.Value % r.Value), true
+				}
+			case ast.Eq:
+				return boolean(l.Value == r.Value), true
+			case ast.Neq:
+				return boolean(l.Value != r.Value), true
+			case ast.Lt:
+				return boolean(l.Value < r.Value), true
+			case ast.Lte:
+				return boolean(l.Value <= r.Value), true
+			case ast.Gt:
+				return boolean(l.Value > r.Value), true
+			case ast.Gte:
+				return boolean(l.Value >= r.Value), true
+			}
+		case ast.Str:
+			if b.Op == ast.Add {
+				return str(strconv.Itoa(int(l.Value)) + r.Value), true
+			}
+		}
+	case ast.Str:
+		switch r := b.Rhs.(type) {
+		case ast.Int:
+			if b.Op == ast.Add {
+				return str(l.Value + strconv.Itoa(int(r.Value))), true
+			}
+		case ast.Str:
+			switch b.Op {
+			case ast.Add:
+				return str(l.Value + r.Value), true
+			case ast.Eq:
+				return boolean(l.Value == r.Value), true
+			case ast.Neq:
+				return boolean(l.Value != r.Value), true
+			case ast.Lt:
+				return boolean(strings.Compare(l.Value, r.Value) < 0), true
+			case ast.Lte:
+				return boolean(strings.Compare(l.Value, r.Value) <= 0), true
+			case ast.Gt:
+				return boolean(strings.Compare(l.Value, r.Value) > 0), true
+			case ast.Gte:
+				return boolean(strings.Compare(l.Value, r.Value) >= 0), true
+			}
+		}
+	case ast.Bool:
+		if r, ok := b.Rhs.(ast.Bool); ok {
+			switch b.Op {
+			case ast.Eq:
+				return boolean(l.Value == r.Value), true
+			case ast.Neq:
+				return boolean(l.Value != r.Value), true
+			case ast.And:
+				return boolean(l.Value && r.Value), true
+			case ast.Or:
+				return boolean(l.Value || r.Value), true
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,235 @@
+package optimize_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/interpreter"
+	"github.com/ghhernandes/rinha-compiler-go/optimize"
+	"github.com/ghhernandes/rinha-compiler-go/parser"
+	"github.com/ghhernandes/rinha-compiler-go/runtime"
+)
+
+// show renders term as source code, fully parenthesized, so trees can be
+// compared without their locations.
+func show(term ast.Term) string {
+	switch n := term.(type) {
+	case ast.Int:
+		return strconv.Itoa(int(n.Value))
+	case ast.Str:
+		return strconv.Quote(n.Value)
+	case ast.Bool:
+		return strconv.FormatBool(n.Value)
+	case ast.Var:
+		return n.Text
+	case ast.Let:
+		if n.Next == nil {
+			return fmt.Sprintf("let %s = %s;", n.Name.Text, show(n.Value))
+		}
+		return fmt.Sprintf("let %s = %s; %s", n.Name.Text, show(n.Value), show(n.Next))
+	case ast.Function:
+		params := make([]string, len(n.Parameters))
+		for i, param := range n.Parameters {
+			params[i] = param.Text
+		}
+		return fmt.Sprintf("fn (%s) => { %s }", strings.Join(params, ", "), show(n.Value))
+	case ast.If:
+		return fmt.Sprintf("if (%s) { %s } else { %s }", show(n.Condition), show(n.Then), show(n.Otherwise))
+	case ast.Binary:
+		return fmt.Sprintf("(%s %s %s)", show(n.Lhs), n.Op, show(n.Rhs))
+	case ast.Call:
+		args := make([]string, len(n.Arguments))
+		for i, arg := range n.Arguments {
+			args[i] = show(arg)
+		}
+		return fmt.Sprintf("%s(%s)", show(n.Callee), strings.Join(args, ", "))
+	case ast.Tuple:
+		return fmt.Sprintf("(%s, %s)", show(n.First), show(n.Second))
+	case ast.Print:
+		return fmt.Sprintf("print(%s)", show(n.Value))
+	case ast.First:
+		return fmt.Sprintf("first(%s)", show(n.Value))
+	case ast.Second:
+		return fmt.Sprintf("second(%s)", show(n.Value))
+	}
+	return fmt.Sprintf("<%T>", term)
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`1 + 2 * 3`, `7`},
+		{`2147483647 + 1`, `-2147483648`},
+		{`-7 / 2`, `-3`},
+		{`-7 % 2`, `-1`},
+		{`"a" + 1 + (2 + 3)`, `"a15"`},
+		{`1 + "a"`, `"1a"`},
+		{`"a" < "b"`, `true`},
+		{`(1 == 1) && (true != false)`, `true`},
+		{`if (1 < 2) { print(1) } else { print(2) }`, `print(1)`},
+		{`first((print(1), 2))`, `print(1)`},
+		{`second((fn () => { 1 }, (1 + 1, "a")))`, `(2, "a")`},
+		{`fn (x) => { x + (2 * 2) }`, `fn (x) => { (x Add 4) }`},
+		{`let x = 1 + 1; x * 2`, `let x = 2; (x Mul 2)`},
+		// What would fail or print at runtime is kept.
+		{`1 / 0`, `(1 Div 0)`},
+		{`1 % (1 - 1)`, `(1 Rem 0)`},
+		{`1 - "a"`, `(1 Sub "a")`},
+		{`1 == "1"`, `(1 Eq "1")`},
+		{`true + 1`, `(true Add 1)`},
+		{`if (1) { 2 } else { 3 }`, `if (1) { 2 } else { 3 }`},
+		{`first((1, print(2)))`, `first((1, print(2)))`},
+		{`second((x, 1))`, `second((x, 1))`},
+		{`first(1)`, `first(1)`},
+	}
+
+	for _, tt := range tests {
+		file, err := parser.ParseString("test.rinha", tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := show(optimize.Fold(file.Expression)); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		src   string
+		want  string
+		stats optimize.Stats
+	}{
+		{
+			`let f = fn (x) => { x * 2 }; print(f(3))`,
+			`print(let x = 3; (x Mul 2))`,
+			optimize.Stats{Inlined: 1, DeadLets: 1, Removed: 3},
+		},
+		{
+			`let a = 1; let b = (2, "b"); let f = fn () => { 1 }; print(a)`,
+			`let a = 1; print(a)`,
+			optimize.Stats{DeadLets: 2, Removed: 7},
+		},
+		{
+			`let f = fn (x) => { x + 1 }; let g = fn (y) => { f(y) * 2 }; g(1)`,
+			`let y = 1; (let x = y; (x Add 1) Mul 2)`,
+			optimize.Stats{Inlined: 2, DeadLets: 2, Removed: 6},
+		},
+		// Recursive functions, functions used more than once and calls
+		// whose variables would be captured by another binding are kept.
+		{
+			`let f = fn (n) => { if (n < 1) { 0 } else { f(n - 1) } }; f(3)`,
+			`let f = fn (n) => { if ((n Lt 1)) { 0 } else { f((n Sub 1)) } }; f(3)`,
+			optimize.Stats{},
+		},
+		{
+			`let f = fn (x) => { x }; f(1) + f(2)`,
+			`let f = fn (x) => { x }; (f(1) Add f(2))`,
+			optimize.Stats{},
+		},
+		{
+			`let f = fn (x) => { x }; print(f)`,
+			`let f = fn (x) => { x }; print(f)`,
+			optimize.Stats{},
+		},
+		{
+			`let f = fn (x) => { x }; f(1, 2)`,
+			`let f = fn (x) => { x }; f(1, 2)`,
+			optimize.Stats{},
+		},
+		{
+			`let x = 1; let f = fn () => { x }; let x = 2; f() + x`,
+			`let x = 1; let f = fn () => { x }; let x = 2; (f() Add x)`,
+			optimize.Stats{},
+		},
+		{
+			`let f = fn (a, b) => { a + b }; let a = 1; f(2, a)`,
+			`let f = fn (a, b) => { (a Add b) }; let a = 1; f(2, a)`,
+			optimize.Stats{},
+		},
+		// Lets whose value could fail or print are kept.
+		{
+			`let a = print(1); let b = x; let c = 1 / 0; 2`,
+			`let a = print(1); let b = x; let c = (1 Div 0); 2`,
+			optimize.Stats{},
+		},
+	}
+
+	for _, tt := range tests {
+		file, err := parser.ParseString("test.rinha", tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		optimized, stats := optimize.Optimize(file)
+		if got := show(optimized.Expression); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.src, got, tt.want)
+		}
+		if stats != tt.stats {
+			t.Errorf("%s: got %+v, want %+v", tt.src, stats, tt.stats)
+		}
+	}
+}
+
+// run interprets file, returning its output and the runtime error it failed
+// with, if any, location included.
+func run(t *testing.T, file *ast.File) (string, string) {
+	var out bytes.Buffer
+	err := interpreter.New(&out, file).Execute(context.Background())
+	var rerr *runtime.RuntimeError
+	if errors.As(err, &rerr) {
+		return out.String(), rerr.Error()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out.String(), ""
+}
+
+func TestOptimizedProgramsBehaveTheSame(t *testing.T) {
+	tests := []string{
+		`let x = 1 + 2 * 3; if (x == 7) { print(("a" + x, x / 2)) } else { print(1 / 0) }`,
+		`let f = fn (n) => { if (n < 1 + 1) { n } else { f(n - 1) + f(n - 2) } }; print(f(10 * 2))`,
+		`let _ = print(first((1 + 1, 2))); print(10 % (5 - 5))`,
+		`let _ = print(second((print("kept"), "a" + "b"))); if ("a" == 1) { 1 } else { 2 }`,
+		`let f = fn (a, b) => { print(a) + b }; print(f(print(1), print(2)))`,
+		`let f = fn (n) => { n / 0 }; let g = fn (x) => { f(x) + 1 }; print(g(1))`,
+		`let f = fn (x) => { print(x) }; f(1, 2)`,
+		`let x = 1; let f = fn () => { x }; let g = fn (x) => { f() + x }; print(g(2))`,
+		`let y = 1; let f = fn (x, y) => { x + y }; let y = 10; print(f(y, 2))`,
+	}
+	files, err := filepath.Glob("../files/*.rinha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests = append(tests, string(src))
+	}
+
+	for _, src := range tests {
+		file, err := parser.ParseString("test.rinha", src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		optimized, _ := optimize.Optimize(file)
+
+		out, rerr := run(t, file)
+		gotOut, gotErr := run(t, optimized)
+		if gotOut != out || gotErr != rerr {
+			t.Errorf("%s: optimized program printed %q and failed with %q, want %q and %q", src, gotOut, gotErr, out, rerr)
+		}
+	}
+}
@@ -1,15 +1,17 @@
 package compiler
 
 import (
-	"encoding/json"
 	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/parser"
 	"io"
 )
 
 func Parse(r io.Reader) (*ast.File, error) {
-	var f ast.File
-	if err := json.NewDecoder(r).Decode(&f); err != nil {
-		return nil, err
-	}
-	return &f, nil
+	return ast.Decode(r)
+}
+
+// ParseSource parses .rinha source code directly, without going through the
+// JSON AST produced by the reference parser.
+func ParseSource(filename string, r io.Reader) (*ast.File, error) {
+	return parser.Parse(filename, r)
 }
@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"strings"
+)
+
+type lexer struct {
+	filename string
+	src      string
+	pos      int
+}
+
+func newLexer(filename, src string) *lexer {
+	return &lexer{filename: filename, src: src}
+}
+
+func (l *lexer) Next() (Token, error) {
+	if err := l.skip(); err != nil {
+		return Token{}, err
+	}
+	if l.pos >= len(l.src) {
+		return Token{Kind: EOF, Start: l.pos, End: l.pos}, nil
+	}
+
+	start := l.pos
+	c := l.src[l.pos]
+
+	switch {
+	case isLetter(c):
+		for l.pos < len(l.src) && (isLetter(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		text := l.src[start:l.pos]
+		if kind, ok := keywords[text]; ok {
+			return Token{Kind: kind, Text: text, Start: start, End: l.pos}, nil
+		}
+		return Token{Kind: IDENT, Text: text, Start: start, End: l.pos}, nil
+	case isDigit(c):
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.pos++
+		}
+		return Token{Kind: INT, Text: l.src[start:l.pos], Start: start, End: l.pos}, nil
+	case c == '"':
+		return l.string()
+	}
+
+	if kind, ok := l.operator(); ok {
+		return Token{Kind: kind, Text: l.src[start:l.pos], Start: start, End: l.pos}, nil
+	}
+	return Token{}, l.errorf(start, start+1, "unexpected character %q", c)
+}
+
+func (l *lexer) skip() error {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "//"):
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				return l.incomplete(l.pos, len(l.src), "unterminated comment")
+			}
+			l.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (l *lexer) string() (Token, error) {
+	var b strings.Builder
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			return Token{Kind: STR, Text: b.String(), Start: start, End: l.pos}, nil
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				return Token{}, l.incomplete(start, len(l.src), "unterminated string")
+			}
+			switch e := l.src[l.pos+1]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '0':
+				b.WriteByte(0)
+			case '"', '\\':
+				b.WriteByte(e)
+			default:
+				return Token{}, l.errorf(l.pos, l.pos+2, "invalid escape sequence \\%c", e)
+			}
+			l.pos += 2
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+	return Token{}, l.incomplete(start, len(l.src), "unterminated string")
+}
+
+func (l *lexer) operator() (TokenKind, bool) {
+	if l.pos+2 <= len(l.src) {
+		if kind, ok := doubleOperators[l.src[l.pos:l.pos+2]]; ok {
+			l.pos += 2
+			return kind, true
+		}
+	}
+	if kind, ok := singleOperators[l.src[l.pos]]; ok {
+		l.pos++
+		return kind, true
+	}
+	return EOF, false
+}
+
+func (l *lexer) errorf(start, end int, format string, args ...any) error {
+	return newError(l.filename, start, end, format, args...)
+}
+
+func (l *lexer) incomplete(start, end int, msg string) error {
+	return &incompleteError{newError(l.filename, start, end, "%s", msg)}
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,515 @@
+package parser
+
+import (
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+)
+
+func newError(filename string, start, end int, format string, args ...any) *ast.Error {
+	return ast.Errorf(ast.Location{Start: start, End: end, Filename: filename}, format, args...)
+}
+
+// incompleteError is the error of input that ended before the term did, so
+// more input could make it valid.
+type incompleteError struct {
+	err *ast.Error
+}
+
+func (e *incompleteError) Error() string { return e.err.Error() }
+func (e *incompleteError) Unwrap() error { return e.err }
+
+type binaryOp struct {
+	op   ast.BinaryOp
+	prec int
+}
+
+var binaryOps = map[TokenKind]binaryOp{
+	OR:  {ast.Or, 1},
+	AND: {ast.And, 2},
+	EQ:  {ast.Eq, 3},
+	NEQ: {ast.Neq, 3},
+	LT:  {ast.Lt, 4},
+	GT:  {ast.Gt, 4},
+	LTE: {ast.Lte, 4},
+	GTE: {ast.Gte, 4},
+	ADD: {ast.Add, 5},
+	SUB: {ast.Sub, 5},
+	MUL: {ast.Mul, 6},
+	DIV: {ast.Div, 6},
+	REM: {ast.Rem, 6},
+}
+
+type parser struct {
+	filename string
+	lex      *lexer
+	tok      Token
+	// openLet allows the input to end right after a let value, leaving
+	// Let.Next nil. Used for interactive input.
+	openLet bool
+}
+
+// Parse reads a .rinha source file and builds the same ast.File that the
+// reference parser emits as JSON, including Location offsets.
+func Parse(filename string, r io.Reader) (*ast.File, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParseString(filename, string(src))
+}
+
+func ParseString(filename, src string) (*ast.File, error) {
+	p := &parser{filename: filename, lex: newLexer(filename, src)}
+	term, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	loc := ast.LocationOf(term)
+	return &ast.File{
+		Name:       filename,
+		Expression: term,
+		Location:   p.location(loc.Start, loc.End),
+	}, nil
+}
+
+// ParseInput parses a single interactive input. Besides regular terms it
+// accepts declarations such as `let x = 1` or `let x = 1;`, returned as an
+// ast.Let with a nil Next.
+func ParseInput(filename, src string) (ast.Term, error) {
+	p := &parser{filename: filename, lex: newLexer(filename, src), openLet: true}
+	return p.parse()
+}
+
+// IsIncomplete reports whether err was caused by input that ended too early.
+func IsIncomplete(err error) bool {
+	var ierr *incompleteError
+	return errors.As(err, &ierr)
+}
+
+func (p *parser) parse() (ast.Term, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	term, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(EOF); err != nil {
+		return nil, err
+	}
+	return term, nil
+}
+
+func (p *parser) next() error {
+	tok, err := p.lex.Next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) expect(kind TokenKind) error {
+	if p.tok.Kind != kind {
+		return p.unexpected(kind.String())
+	}
+	if kind == EOF {
+		return nil
+	}
+	return p.next()
+}
+
+func (p *parser) unexpected(expected string) error {
+	if p.tok.Kind == EOF {
+		return &incompleteError{newError(p.filename, p.tok.Start, p.tok.End, "unexpected end of file, expected %s", expected)}
+	}
+	return newError(p.filename, p.tok.Start, p.tok.End, "unexpected %q, expected %s", p.tok.Text, expected)
+}
+
+func (p *parser) location(start, end int) ast.Location {
+	return ast.Location{Start: start, End: end, Filename: p.filename}
+}
+
+func (p *parser) term() (ast.Term, error) {
+	if p.tok.Kind == LET {
+		return p.let()
+	}
+	return p.binary(1)
+}
+
+func (p *parser) let() (ast.Term, error) {
+	start := p.tok.Start
+	if err := p.expect(LET); err != nil {
+		return nil, err
+	}
+
+	if p.tok.Kind != IDENT {
+		return nil, p.unexpected("identifier")
+	}
+	name := ast.Parameter{Text: p.tok.Text, Location: p.location(p.tok.Start, p.tok.End)}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	if err := p.expect(ASSIGN); err != nil {
+		return nil, err
+	}
+	value, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	end := ast.LocationOf(value).End
+	if p.tok.Kind == SEMICOLON {
+		end = p.tok.End
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if p.openLet && p.tok.Kind == EOF {
+		return ast.Let{
+			Kind:     ast.LET,
+			Name:     name,
+			Value:    value,
+			Location: p.location(start, end),
+		}, nil
+	}
+	next, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.Let{
+		Kind:     ast.LET,
+		Name:     name,
+		Value:    value,
+		Next:     next,
+		Location: p.location(start, ast.LocationOf(next).End),
+	}, nil
+}
+
+func (p *parser) binary(prec int) (ast.Term, error) {
+	lhs, err := p.call()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := binaryOps[p.tok.Kind]
+		if !ok || op.prec < prec {
+			return lhs, nil
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+
+		rhs, err := p.binary(op.prec + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		lhs = ast.Binary{
+			Kind:     ast.BINARY,
+			Lhs:      lhs,
+			Op:       op.op,
+			Rhs:      rhs,
+			Location: p.location(ast.LocationOf(lhs).Start, ast.LocationOf(rhs).End),
+		}
+	}
+}
+
+func (p *parser) call() (ast.Term, error) {
+	callee, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.tok.Kind == LPAREN {
+		args, end, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		callee = ast.Call{
+			Kind:      ast.CALL,
+			Callee:    callee,
+			Arguments: args,
+			Location:  p.location(ast.LocationOf(callee).Start, end),
+		}
+	}
+	return callee, nil
+}
+
+// arguments parses a parenthesized, comma separated list of terms and
+// returns the offset right after the closing parenthesis.
+func (p *parser) arguments() ([]ast.Term, int, error) {
+	if err := p.expect(LPAREN); err != nil {
+		return nil, 0, err
+	}
+
+	args := []ast.Term{}
+	for p.tok.Kind != RPAREN {
+		arg, err := p.term()
+		if err != nil {
+			return nil, 0, err
+		}
+		args = append(args, arg)
+
+		if p.tok.Kind != COMMA {
+			break
+		}
+		if err := p.next(); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	end := p.tok.End
+	if err := p.expect(RPAREN); err != nil {
+		return nil, 0, err
+	}
+	return args, end, nil
+}
+
+func (p *parser) primary() (ast.Term, error) {
+	tok := p.tok
+	switch tok.Kind {
+	case INT:
+		return p.integer(tok.Start, 1)
+	case SUB:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.Kind != INT {
+			return nil, p.unexpected("integer")
+		}
+		return p.integer(tok.Start, -1)
+	case STR:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return ast.Str{Kind: ast.STR, Value: tok.Text, Location: p.location(tok.Start, tok.End)}, nil
+	case TRUE, FALSE:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return ast.Bool{Kind: ast.BOOL, Value: tok.Kind == TRUE, Location: p.location(tok.Start, tok.End)}, nil
+	case IDENT:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		return ast.Var{Kind: ast.VAR, Text: tok.Text, Location: p.location(tok.Start, tok.End)}, nil
+	case FN:
+		return p.function()
+	case IF:
+		return p.ifElse()
+	case PRINT, FIRST, SECOND:
+		return p.builtin()
+	case LPAREN:
+		return p.parenthesized()
+	case LBRACE:
+		term, _, err := p.block()
+		return term, err
+	default:
+		return nil, p.unexpected("expression")
+	}
+}
+
+func (p *parser) integer(start int, sign int64) (ast.Term, error) {
+	tok := p.tok
+	value, err := strconv.ParseInt(tok.Text, 10, 64)
+	if err != nil || sign*value < -1<<31 || sign*value > 1<<31-1 {
+		return nil, newError(p.filename, start, tok.End, "integer literal %s out of range", tok.Text)
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	return ast.Int{Kind: ast.INT, Value: int32(sign * value), Location: p.location(start, tok.End)}, nil
+}
+
+func (p *parser) function() (ast.Term, error) {
+	start := p.tok.Start
+	if err := p.expect(FN); err != nil {
+		return nil, err
+	}
+	if err := p.expect(LPAREN); err != nil {
+		return nil, err
+	}
+
+	params := []ast.Parameter{}
+	for p.tok.Kind != RPAREN {
+		if p.tok.Kind != IDENT {
+			return nil, p.unexpected("parameter name")
+		}
+		params = append(params, ast.Parameter{Text: p.tok.Text, Location: p.location(p.tok.Start, p.tok.End)})
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+
+		if p.tok.Kind != COMMA {
+			break
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(RPAREN); err != nil {
+		return nil, err
+	}
+	if err := p.expect(ARROW); err != nil {
+		return nil, err
+	}
+
+	var (
+		body ast.Term
+		end  int
+		err  error
+	)
+	if p.tok.Kind == LBRACE {
+		body, end, err = p.block()
+	} else {
+		body, err = p.term()
+		if err == nil {
+			end = ast.LocationOf(body).End
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.Function{
+		Kind:       ast.FUNCTION,
+		Parameters: params,
+		Value:      body,
+		Location:   p.location(start, end),
+	}, nil
+}
+
+func (p *parser) ifElse() (ast.Term, error) {
+	start := p.tok.Start
+	if err := p.expect(IF); err != nil {
+		return nil, err
+	}
+	if err := p.expect(LPAREN); err != nil {
+		return nil, err
+	}
+	condition, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(RPAREN); err != nil {
+		return nil, err
+	}
+
+	then, _, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(ELSE); err != nil {
+		return nil, err
+	}
+
+	var (
+		otherwise ast.Term
+		end       int
+	)
+	if p.tok.Kind == IF {
+		otherwise, err = p.ifElse()
+		if err == nil {
+			end = ast.LocationOf(otherwise).End
+		}
+	} else {
+		otherwise, end, err = p.block()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ast.If{
+		Kind:      ast.IF,
+		Condition: condition,
+		Then:      then,
+		Otherwise: otherwise,
+		Location:  p.location(start, end),
+	}, nil
+}
+
+// block parses a term between braces and returns the offset right after the
+// closing brace. The braces themselves do not produce a node.
+func (p *parser) block() (ast.Term, int, error) {
+	if err := p.expect(LBRACE); err != nil {
+		return nil, 0, err
+	}
+	term, err := p.term()
+	if err != nil {
+		return nil, 0, err
+	}
+	end := p.tok.End
+	if err := p.expect(RBRACE); err != nil {
+		return nil, 0, err
+	}
+	return term, end, nil
+}
+
+func (p *parser) builtin() (ast.Term, error) {
+	tok := p.tok
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	args, end, err := p.arguments()
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != 1 {
+		return nil, newError(p.filename, tok.Start, end, "%s expects 1 argument, got %d", tok.Text, len(args))
+	}
+
+	loc := p.location(tok.Start, end)
+	switch tok.Kind {
+	case PRINT:
+		return ast.Print{Kind: ast.PRINT, Value: args[0], Location: loc}, nil
+	case FIRST:
+		return ast.First{Kind: ast.FIRST, Value: args[0], Location: loc}, nil
+	default:
+		return ast.Second{Kind: ast.SECOND, Value: args[0], Location: loc}, nil
+	}
+}
+
+func (p *parser) parenthesized() (ast.Term, error) {
+	start := p.tok.Start
+	if err := p.expect(LPAREN); err != nil {
+		return nil, err
+	}
+	first, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.tok.Kind != COMMA {
+		if err := p.expect(RPAREN); err != nil {
+			return nil, err
+		}
+		return first, nil
+	}
+
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	second, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	end := p.tok.End
+	if err := p.expect(RPAREN); err != nil {
+		return nil, err
+	}
+
+	return ast.Tuple{
+		Kind:     ast.TUPLE,
+		First:    first,
+		Second:   second,
+		Location: p.location(start, end),
+	}, nil
+}
@@ -0,0 +1,118 @@
+package parser_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go"
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/parser"
+)
+
+func TestParseMatchesReferenceJSON(t *testing.T) {
+	sources, err := filepath.Glob("../files/*.rinha")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range sources {
+		t.Run(filepath.Base(source), func(t *testing.T) {
+			f, err := os.Open(strings.TrimSuffix(source, ".rinha") + ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			want, err := compiler.Parse(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			src, err := os.ReadFile(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := parser.ParseString(want.Name, string(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ast mismatch\ngot:  %+v\nwant: %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		msg string
+	}{
+		{`let x = ;`, `test.rinha:8:9: unexpected ";", expected expression`},
+		{`print(1`, `test.rinha:7:7: unexpected end of file, expected )`},
+		{`"abc`, `test.rinha:0:4: unterminated string`},
+		{`if (true) { 1 }`, `test.rinha:15:15: unexpected end of file, expected else`},
+		{"1 /* open", `test.rinha:2:9: unterminated comment`},
+		{`1 @ 2`, `test.rinha:2:3: unexpected character '@'`},
+		{`99999999999`, `test.rinha:0:11: integer literal 99999999999 out of range`},
+	}
+
+	for _, tt := range tests {
+		_, err := parser.ParseString("test.rinha", tt.src)
+		if err == nil {
+			t.Errorf("%q: expected error", tt.src)
+			continue
+		}
+		if err.Error() != tt.msg {
+			t.Errorf("%q: got %q, want %q", tt.src, err.Error(), tt.msg)
+		}
+	}
+}
+
+func TestParseExpressions(t *testing.T) {
+	f, err := parser.ParseString("test.rinha", `let t = (1 + 2 * 3, -4 % 2); print(first(t) == 7 || second(t) < 0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	let := f.Expression.(ast.Let)
+	tuple := let.Value.(ast.Tuple)
+	add := tuple.First.(ast.Binary)
+	if add.Op != ast.Add || add.Rhs.(ast.Binary).Op != ast.Mul {
+		t.Errorf("wrong precedence: %+v", add)
+	}
+	if rem := tuple.Second.(ast.Binary); rem.Lhs.(ast.Int).Value != -4 {
+		t.Errorf("wrong negative literal: %+v", rem)
+	}
+	if or := let.Next.(ast.Print).Value.(ast.Binary); or.Op != ast.Or {
+		t.Errorf("wrong precedence: %+v", or)
+	}
+}
+
+func TestParseInput(t *testing.T) {
+	term, err := parser.ParseInput("repl", `let x = 1;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if let, ok := term.(ast.Let); !ok || let.Next != nil || let.Location.End != 10 {
+		t.Errorf("expected an open let, got %+v", term)
+	}
+
+	if _, err := parser.ParseString("test.rinha", `let x = 1;`); err == nil {
+		t.Error("expected an error for a let without a body in a file")
+	}
+
+	for _, src := range []string{`let f = fn (x) => {`, `if (true) { 1 }`, `"abc`, `(1, `} {
+		if _, err := parser.ParseInput("repl", src); !parser.IsIncomplete(err) {
+			t.Errorf("%q: expected incomplete input, got %v", src, err)
+		}
+	}
+	if _, err := parser.ParseInput("repl", `1 )`); err == nil || parser.IsIncomplete(err) {
+		t.Errorf("expected a complete syntax error, got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package parser
+
+type TokenKind int
+
+const (
+	EOF TokenKind = iota
+	IDENT
+	INT
+	STR
+
+	LET
+	FN
+	IF
+	ELSE
+	TRUE
+	FALSE
+	PRINT
+	FIRST
+	SECOND
+
+	LPAREN
+	RPAREN
+	LBRACE
+	RBRACE
+	COMMA
+	SEMICOLON
+	ASSIGN
+	ARROW
+
+	ADD
+	SUB
+	MUL
+	DIV
+	REM
+	EQ
+	NEQ
+	LT
+	GT
+	LTE
+	GTE
+	AND
+	OR
+)
+
+var tokenNames = map[TokenKind]string{
+	EOF:       "end of file",
+	IDENT:     "identifier",
+	INT:       "integer",
+	STR:       "string",
+	LET:       "let",
+	FN:        "fn",
+	IF:        "if",
+	ELSE:      "else",
+	TRUE:      "true",
+	FALSE:     "false",
+	PRINT:     "print",
+	FIRST:     "first",
+	SECOND:    "second",
+	LPAREN:    "(",
+	RPAREN:    ")",
+	LBRACE:    "{",
+	RBRACE:    "}",
+	COMMA:     ",",
+	SEMICOLON: ";",
+	ASSIGN:    "=",
+	ARROW:     "=>",
+	ADD:       "+",
+	SUB:       "-",
+	MUL:       "*",
+	DIV:       "/",
+	REM:       "%",
+	EQ:        "==",
+	NEQ:       "!=",
+	LT:        "<",
+	GT:        ">",
+	LTE:       "<=",
+	GTE:       ">=",
+	AND:       "&&",
+	OR:        "||",
+}
+
+var keywords = map[string]TokenKind{
+	"let":    LET,
+	"fn":     FN,
+	"if":     IF,
+	"else":   ELSE,
+	"true":   TRUE,
+	"false":  FALSE,
+	"print":  PRINT,
+	"first":  FIRST,
+	"second": SECOND,
+}
+
+var doubleOperators = map[string]TokenKind{
+	"=>": ARROW,
+	"==": EQ,
+	"!=": NEQ,
+	"<=": LTE,
+	">=": GTE,
+	"&&": AND,
+	"||": OR,
+}
+
+var singleOperators = map[byte]TokenKind{
+	'(': LPAREN,
+	')': RPAREN,
+	'{': LBRACE,
+	'}': RBRACE,
+	',': COMMA,
+	';': SEMICOLON,
+	'=': ASSIGN,
+	'+': ADD,
+	'-': SUB,
+	'*': MUL,
+	'/': DIV,
+	'%': REM,
+	'<': LT,
+	'>': GT,
+}
+
+func (k TokenKind) String() string {
+	if name, ok := tokenNames[k]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+type Token struct {
+	Kind  TokenKind
+	Text  string
+	Start int
+	End   int
+}
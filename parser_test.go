@@ -1,18 +1,53 @@
 package compiler_test
 
 import (
-	"github.com/ghhernandes/rinha-compiler-go"
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go"
+	"github.com/ghhernandes/rinha-compiler-go/parser"
 )
 
 func BenchmarkParse(t *testing.B) {
-	f, err := os.Open("files/fib.json")
+	data, err := os.ReadFile("files/fib.json")
+	if err != nil {
+		panic(err)
+	}
+
+	for i := 0; i < t.N; i++ {
+		if _, err := compiler.Parse(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkParseDeep parses a program of 1000 nested lets, where the cost
+// of decoding grows with the depth of the tree.
+func BenchmarkParseDeep(t *testing.B) {
+	var src strings.Builder
+	src.WriteString("let x0 = 0;\n")
+	for i := 1; i < 1000; i++ {
+		fmt.Fprintf(&src, "let x%d = x%d + %d;\n", i, i-1, i)
+	}
+	src.WriteString("print(x999)")
+	f, err := parser.ParseString("deep.rinha", src.String())
+	if err != nil {
+		panic(err)
+	}
+	data, err := json.Marshal(f)
 	if err != nil {
 		panic(err)
 	}
 
+	t.SetBytes(int64(len(data)))
+	t.ResetTimer()
 	for i := 0; i < t.N; i++ {
-		compiler.Parse(f)
+		if _, err := compiler.Parse(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
 	}
 }
@@ -0,0 +1,178 @@
+// Package purity finds the functions of a program that have no side effects,
+// so their calls can be safely memoized.
+package purity
+
+import "github.com/ghhernandes/rinha-compiler-go/ast"
+
+// Set holds the pure functions of a program, identified by location.
+// Functions sharing a location, like synthesized ones, are only in it when
+// all of them are pure.
+type Set map[ast.Location]bool
+
+// Pure reports whether fn was found to be pure.
+func (s Set) Pure(fn ast.Function) bool {
+	return s[fn.Location]
+}
+
+// function is what the analysis knows about one function literal.
+type function struct {
+	loc ast.Location
+	// prints is set when the body calls Print directly.
+	prints bool
+	// unknown is set when the body calls something that cannot be resolved
+	// to a function literal, like a parameter or the result of another call.
+	unknown bool
+	calls   []*function
+}
+
+func (f *function) impure() bool {
+	return f.prints || f.unknown
+}
+
+type env struct {
+	parent *env
+	name   string
+	// fn is the function bound to name, or nil for any other value.
+	fn *function
+}
+
+func (e *env) lookup(name string) (*function, bool) {
+	for ; e != nil; e = e.parent {
+		if e.name == name {
+			return e.fn, true
+		}
+	}
+	return nil, false
+}
+
+func (e *env) bind(name string, fn *function) *env {
+	return &env{parent: e, name: name, fn: fn}
+}
+
+type analyzer struct {
+	functions []*function
+}
+
+// Analyze returns the functions of term that never call Print, directly or
+// through the functions they call. Calls that cannot be resolved statically
+// are assumed to have side effects.
+func Analyze(term ast.Term) Set {
+	a := &analyzer{}
+	a.walk(nil, nil, term)
+
+	// Impurity spreads from callees to callers until nothing changes, so
+	// mutually recursive functions stay pure unless one of them prints.
+	for changed := true; changed; {
+		changed = false
+		for _, fn := range a.functions {
+			if fn.impure() {
+				continue
+			}
+			for _, callee := range fn.calls {
+				if callee.impure() {
+					fn.unknown = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	pure := make(Set, len(a.functions))
+	for _, fn := range a.functions {
+		if p, ok := pure[fn.loc]; !ok || p {
+			pure[fn.loc] = !fn.impure()
+		}
+	}
+	for loc, p := range pure {
+		if !p {
+			delete(pure, loc)
+		}
+	}
+	return pure
+}
+
+// walk visits term as part of the body of current, which is nil at the top
+// level of the program.
+func (a *analyzer) walk(e *env, current *function, term ast.Term) {
+	switch n := term.(type) {
+	case ast.Let:
+		var fn *function
+		if f, ok := n.Value.(ast.Function); ok {
+			fn = a.function(f)
+		}
+		// The name is visible in its own value, so recursive calls resolve.
+		inner := e.bind(n.Name.Text, fn)
+		if fn != nil {
+			a.body(inner, fn, n.Value.(ast.Function))
+		} else {
+			if v, ok := n.Value.(ast.Var); ok {
+				inner.fn, _ = e.lookup(v.Text)
+			}
+			a.walk(e, current, n.Value)
+		}
+		a.walk(inner, current, n.Next)
+	case ast.Function:
+		a.body(e, a.function(n), n)
+	case ast.Call:
+		a.call(e, current, n)
+	case ast.Print:
+		if current != nil {
+			current.prints = true
+		}
+		a.walk(e, current, n.Value)
+	case ast.If:
+		a.walk(e, current, n.Condition)
+		a.walk(e, current, n.Then)
+		a.walk(e, current, n.Otherwise)
+	case ast.Binary:
+		a.walk(e, current, n.Lhs)
+		a.walk(e, current, n.Rhs)
+	case ast.Tuple:
+		a.walk(e, current, n.First)
+		a.walk(e, current, n.Second)
+	case ast.First:
+		a.walk(e, current, n.Value)
+	case ast.Second:
+		a.walk(e, current, n.Value)
+	}
+}
+
+func (a *analyzer) function(f ast.Function) *function {
+	fn := &function{loc: f.Location}
+	a.functions = append(a.functions, fn)
+	return fn
+}
+
+func (a *analyzer) body(e *env, fn *function, f ast.Function) {
+	for _, p := range f.Parameters {
+		e = e.bind(p.Text, nil)
+	}
+	a.walk(e, fn, f.Value)
+}
+
+func (a *analyzer) call(e *env, current *function, c ast.Call) {
+	for _, arg := range c.Arguments {
+		a.walk(e, current, arg)
+	}
+
+	var callee *function
+	switch n := c.Callee.(type) {
+	case ast.Var:
+		callee, _ = e.lookup(n.Text)
+	case ast.Function:
+		callee = a.function(n)
+		a.body(e, callee, n)
+	default:
+		a.walk(e, current, c.Callee)
+	}
+
+	if current == nil {
+		return
+	}
+	if callee == nil {
+		current.unknown = true
+		return
+	}
+	current.calls = append(current.calls, callee)
+}
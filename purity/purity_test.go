@@ -0,0 +1,70 @@
+package purity_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/parser"
+	"github.com/ghhernandes/rinha-compiler-go/purity"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		src  string
+		pure []int // start offsets of the pure functions
+	}{
+		{`let f = fn (x) => { x + 1 }; f(1)`, []int{8}},
+		{`let f = fn (x) => { print(x) }; f(1)`, nil},
+		// Impurity is transitive through calls.
+		{`let p = fn (x) => { print(x) }; let f = fn (x) => { p(x) }; f(1)`, nil},
+		// Defining a printing function is not a side effect, calling it is.
+		{`let f = fn () => { fn () => { print(1) } }; f()`, []int{8}},
+		// Recursion alone does not make a function impure.
+		{`let f = fn (n) => { if (n == 0) { 0 } else { f(n - 1) } }; f(3)`, []int{8}},
+		{`let f = fn (n) => { if (n == 0) { print(0) } else { f(n - 1) } }; f(3)`, nil},
+		// Calls through parameters cannot be resolved.
+		{`let apply = fn (g, x) => { g(x) }; apply(fn (x) => { x }, 1)`, []int{41}},
+		// Aliases resolve to the function they name.
+		{`let f = fn (x) => { x }; let g = f; let h = fn (x) => { g(x) }; h(1)`, []int{8, 44}},
+		// Shadowing hides the outer binding.
+		{`let f = fn () => { 1 }; let g = fn (f) => { f() }; g(f)`, []int{8}},
+		// Names not bound in the program are unknown.
+		{`let f = fn () => { g() }; f()`, nil},
+	}
+
+	for _, tt := range tests {
+		file, err := parser.ParseString("test.rinha", tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var pure []int
+		for loc := range purity.Analyze(file.Expression) {
+			pure = append(pure, loc.Start)
+		}
+		sort.Ints(pure)
+
+		if len(pure) != len(tt.pure) {
+			t.Errorf("%q: got pure functions at %v, want %v", tt.src, pure, tt.pure)
+			continue
+		}
+		for i := range pure {
+			if pure[i] != tt.pure[i] {
+				t.Errorf("%q: got pure functions at %v, want %v", tt.src, pure, tt.pure)
+				break
+			}
+		}
+	}
+}
+
+func TestAnalyzeSharedLocation(t *testing.T) {
+	// Synthesized functions may share a location, here the zero one.
+	pure := ast.Function{Kind: ast.FUNCTION, Value: ast.Int{Kind: ast.INT, Value: 1}}
+	impure := ast.Function{Kind: ast.FUNCTION, Value: ast.Print{Kind: ast.PRINT, Value: ast.Int{Kind: ast.INT, Value: 1}}}
+	term := ast.Tuple{Kind: ast.TUPLE, First: pure, Second: impure}
+
+	if purity.Analyze(term).Pure(pure) {
+		t.Error("a function sharing its location with an impure one is pure")
+	}
+}
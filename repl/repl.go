@@ -0,0 +1,228 @@
+package repl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/diag"
+	"github.com/ghhernandes/rinha-compiler-go/interpreter"
+	"github.com/ghhernandes/rinha-compiler-go/parser"
+	"github.com/ghhernandes/rinha-compiler-go/types"
+	"github.com/ghhernandes/rinha-compiler-go/value"
+)
+
+const (
+	PROMPT              = "> "
+	CONTINUATION_PROMPT = "| "
+)
+
+const help = `Enter a Rinha expression, or a declaration such as "let x = 1;".
+Input continues on the next line until the expression is complete.
+
+  :type <expr>  show the inferred type of an expression
+  :ast <expr>   dump the syntax tree of an expression
+  :reset        forget every binding and memoized result
+  :help         show this message
+  :quit         leave the session
+`
+
+// evaluator is the part of the interpreter used by the REPL.
+type evaluator interface {
+	Eval(ctx context.Context, scope ast.Scope, term ast.Term) (value.Value, error)
+	Reset()
+}
+
+// REPL is an interactive session. Declarations are added to a top-level
+// scope that persists between inputs until :reset.
+type REPL struct {
+	out     io.Writer
+	interp  evaluator
+	scope   ast.Scope
+	checker *types.Checker
+	sources *diag.SourceMap
+	inputs  int
+}
+
+func New(out io.Writer) *REPL {
+	return &REPL{
+		out:     out,
+		interp:  interpreter.New(out, nil),
+		scope:   make(ast.Scope, ast.SCOPE_DEFAULT_SIZE),
+		checker: types.NewChecker(),
+		sources: diag.NewSourceMap(),
+	}
+}
+
+// Run reads inputs from in until it is exhausted or :quit is entered.
+func (r *REPL) Run(in io.Reader) error {
+	var (
+		scanner = bufio.NewScanner(in)
+		buf     strings.Builder
+		command string
+	)
+
+	fmt.Fprint(r.out, PROMPT)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if buf.Len() == 0 {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" {
+				fmt.Fprint(r.out, PROMPT)
+				continue
+			}
+			if strings.HasPrefix(trimmed, ":") {
+				name, rest, _ := strings.Cut(trimmed, " ")
+				switch name {
+				case ":quit":
+					return nil
+				case ":help":
+					fmt.Fprint(r.out, help)
+				case ":reset":
+					r.reset()
+					fmt.Fprintln(r.out, "scope cleared")
+				case ":type", ":ast":
+					command, line = name, rest
+				default:
+					fmt.Fprintf(r.out, "error: unknown command %s\n", name)
+				}
+				if command == "" {
+					fmt.Fprint(r.out, PROMPT)
+					continue
+				}
+			}
+		}
+
+		buf.WriteString(line)
+		buf.WriteString("\n")
+
+		r.inputs++
+		filename := fmt.Sprintf("<repl:%d>", r.inputs)
+		r.sources.Add(filename, buf.String())
+
+		term, err := parser.ParseInput(filename, buf.String())
+		if parser.IsIncomplete(err) {
+			r.inputs--
+			fmt.Fprint(r.out, CONTINUATION_PROMPT)
+			continue
+		}
+
+		if err != nil {
+			r.sources.Report(r.out, err)
+		} else {
+			r.handle(command, term)
+		}
+		buf.Reset()
+		command = ""
+		fmt.Fprint(r.out, PROMPT)
+	}
+	return scanner.Err()
+}
+
+func (r *REPL) reset() {
+	r.scope = make(ast.Scope, ast.SCOPE_DEFAULT_SIZE)
+	r.interp.Reset()
+	r.checker = types.NewChecker()
+}
+
+func (r *REPL) handle(command string, term ast.Term) {
+	switch command {
+	case ":type":
+		r.showType(term)
+	case ":ast":
+		enc := json.NewEncoder(r.out)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(term); err != nil {
+			r.sources.Report(r.out, err)
+		}
+	default:
+		r.eval(term)
+	}
+}
+
+// showType prints the type of an expression, or of the bound value for a
+// declaration, without evaluating or defining anything.
+func (r *REPL) showType(term ast.Term) {
+	if let, ok := term.(ast.Let); ok && isDeclaration(let) {
+		term = ast.Let{
+			Kind:     ast.LET,
+			Name:     let.Name,
+			Value:    let.Value,
+			Next:     ast.Var{Kind: ast.VAR, Text: let.Name.Text, Location: let.Name.Location},
+			Location: let.Location,
+		}
+	}
+	t, err := r.checker.Infer(term)
+	if err != nil {
+		r.sources.Report(r.out, err)
+		return
+	}
+	fmt.Fprintln(r.out, types.String(t))
+}
+
+func (r *REPL) eval(term ast.Term) {
+	if let, ok := term.(ast.Let); ok && isDeclaration(let) {
+		r.declare(let)
+		return
+	}
+
+	v, err := r.interp.Eval(context.Background(), r.scope, term)
+	if err != nil {
+		r.sources.Report(r.out, err)
+		return
+	}
+	fmt.Fprintln(r.out, v)
+}
+
+// declare binds every let of a declaration chain in the top-level scope,
+// stopping at the first one that fails to evaluate. Type checking is only
+// used to annotate the bindings, so values that do not type check are
+// still bound, without a type.
+func (r *REPL) declare(let ast.Let) {
+	for {
+		b, _ := r.checker.Bind(let.Name.Text, let.Value)
+		// The value is evaluated as the body of its own let, so functions
+		// can call themselves.
+		self := ast.Var{Kind: ast.VAR, Text: let.Name.Text, Location: let.Name.Location}
+		v, err := r.interp.Eval(context.Background(), r.scope, ast.Let{Kind: ast.LET, Name: let.Name, Value: let.Value, Next: self, Location: let.Location})
+		if err != nil {
+			r.sources.Report(r.out, err)
+			return
+		}
+		r.scope[let.Name.Text] = v
+		if b != nil {
+			r.checker.Define(b)
+			fmt.Fprintf(r.out, "%s : %s = %s\n", let.Name.Text, types.String(b.Type), v)
+		} else {
+			r.checker.Forget(let.Name.Text)
+			fmt.Fprintf(r.out, "%s = %s\n", let.Name.Text, v)
+		}
+
+		next, ok := let.Next.(ast.Let)
+		if !ok {
+			return
+		}
+		let = next
+	}
+}
+
+// isDeclaration reports whether let is a chain of lets ending without a
+// body, like `let x = 1; let y = 2;`.
+func isDeclaration(let ast.Let) bool {
+	for {
+		if let.Next == nil {
+			return true
+		}
+		next, ok := let.Next.(ast.Let)
+		if !ok {
+			return false
+		}
+		let = next
+	}
+}
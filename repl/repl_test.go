@@ -0,0 +1,92 @@
+package repl_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go/repl"
+)
+
+func run(t *testing.T, input string) string {
+	t.Helper()
+	var out strings.Builder
+	if err := repl.New(&out).Run(strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestBindingsPersist(t *testing.T) {
+	got := run(t, "let x = 20;\nlet y = x + 1; let z = y * 2\nz\n")
+	want := "> x : Int = 20\n> y : Int = 21\nz : Int = 42\n> 42\n> "
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestExpressionLetsDoNotLeak(t *testing.T) {
+	got := run(t, "let a = 1; a + 1\na\n")
+	if !strings.HasPrefix(got, "> 2\n> error: undefined variable a\n") {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestMultiLineInput(t *testing.T) {
+	got := run(t, "let fib = fn (n) => {\n  if (n < 2) { n }\n  else { fib(n - 1) + fib(n - 2) }\n};\nfib(15)\n")
+	want := "> | | | fib : fn(Int) -> Int = <#closure>\n> 610\n> "
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	got := run(t, ":type fn (x, y) => { (y, x) }\n:type let id = fn (x) => { x };\nid\n:ast true\n:quit\n1\n")
+	want := "> fn('a, 'b) -> ('b, 'a)\n" +
+		"> fn('a) -> 'a\n" +
+		"> error: undefined variable id\n" +
+		" --> <repl:3>:1:1\n  |\n1 | id\n  | ^^\n" +
+		"> {\n  \"kind\": \"Bool\",\n  \"value\": true,\n  \"location\": {\n    \"start\": 0,\n    \"end\": 4,\n    \"filename\": \"<repl:4>\"\n  }\n}\n" +
+		"> "
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestReset(t *testing.T) {
+	got := run(t, "let x = 1;\n:reset\nx\n")
+	if !strings.Contains(got, "scope cleared\n> error: undefined variable x") {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestErrorsKeepSession(t *testing.T) {
+	got := run(t, "let x = 1;\n1 / 0\n\"a\" - x\nx\n")
+	if !strings.Contains(got, "error: division by zero") || !strings.Contains(got, "error: invalid operands for Sub: Str and Int") {
+		t.Errorf("missing errors in %q", got)
+	}
+	if !strings.HasSuffix(got, "> 1\n> ") {
+		t.Errorf("session did not survive errors: %q", got)
+	}
+}
+
+func TestFailedDeclarationIsNotDefined(t *testing.T) {
+	got := run(t, "let x = 1 / 0;\n:type x\n")
+	if !strings.HasPrefix(got, "> error: division by zero") || !strings.Contains(got, "> error: undefined variable x\n") {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestTypeErrorsDoNotStopEvaluation(t *testing.T) {
+	got := run(t, "let f = fn (a, b) => { a + b };\nf(\"a\", 1)\nlet x = 1;\nlet x = f(\"a\", 1);\n:type x\nx + \"b\"\n")
+	want := "> f : fn(Int, Int) -> Int = <#closure>\n" +
+		"> a1\n" +
+		"> x : Int = 1\n" +
+		"> x = a1\n" +
+		"> error: unknown type of x, whose declaration does not type check\n" +
+		" --> <repl:5>:1:1\n  |\n1 | x\n  | ^\n" +
+		"> a1b\n" +
+		"> "
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,141 @@
+// Package resolver gives every variable of a program its lexical address, so
+// the interpreter can find it in a frame by position instead of by name.
+package resolver
+
+import (
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/closure"
+)
+
+type scope struct {
+	parent *scope
+	name   string
+	index  int
+}
+
+// frame is the layout of the frames of one function: its parameters and
+// every let in its body get a slot of their own. free lists the variables
+// its closures capture, which they hold in a frame of their own.
+type frame struct {
+	parent *frame
+	scope  *scope
+	names  []string
+	free   []string
+}
+
+type resolver struct {
+	captures closure.Captures
+	frame    *frame
+}
+
+// Resolve returns term with every Var annotated with its lexical address,
+// every Let with the slot of its binding and every Function with the layout
+// of its frames and its free variables. globals names the first slots of
+// the outermost frame; the lets of term follow them. The names of the slots
+// of the outermost frame are returned along with the term.
+//
+// A let whose value is a function is in scope in the function, so it can
+// call itself. Variables that are not bound anywhere get a Depth of -1.
+func Resolve(term ast.Term, globals []string) (ast.Term, []string) {
+	r := &resolver{captures: closure.Analyze(term), frame: &frame{}}
+	for _, name := range globals {
+		r.declare(name)
+	}
+	term = r.resolve(term)
+	return term, r.frame.names
+}
+
+func (r *resolver) declare(name string) int {
+	index := len(r.frame.names)
+	r.frame.names = append(r.frame.names, name)
+	r.frame.scope = &scope{parent: r.frame.scope, name: name, index: index}
+	return index
+}
+
+// lookup returns the address of name seen from the current frame: one of
+// its slots, at depth 0, or one of the variables captured by the closure
+// running it, at depth 1.
+func (r *resolver) lookup(name string) (depth, index int) {
+	for s := r.frame.scope; s != nil; s = s.parent {
+		if s.name == name {
+			return 0, s.index
+		}
+	}
+	for index, free := range r.frame.free {
+		if free == name {
+			return 1, index
+		}
+	}
+	return -1, 0
+}
+
+func (r *resolver) resolve(term ast.Term) ast.Term {
+	switch n := term.(type) {
+	case ast.Var:
+		n.Depth, n.Index = r.lookup(n.Text)
+		return n
+	case ast.Let:
+		outer := r.frame.scope
+		if _, ok := n.Value.(ast.Function); ok {
+			n.Index = r.declare(n.Name.Text)
+			n.Value = r.resolve(n.Value)
+		} else {
+			n.Value = r.resolve(n.Value)
+			n.Index = r.declare(n.Name.Text)
+		}
+		if n.Next != nil {
+			n.Next = r.resolve(n.Next)
+		}
+		r.frame.scope = outer
+		return n
+	case ast.Function:
+		names := r.captures.Of(n)
+		n.Free = make([]ast.Var, 0, len(names))
+		free := make([]string, 0, len(names))
+		for _, name := range names {
+			if depth, index := r.lookup(name); depth >= 0 {
+				n.Free = append(n.Free, ast.Var{Kind: ast.VAR, Text: name, Depth: depth, Index: index})
+				free = append(free, name)
+			}
+		}
+		r.frame = &frame{parent: r.frame, free: free}
+		for _, param := range n.Parameters {
+			r.declare(param.Text)
+		}
+		n.Value = r.resolve(n.Value)
+		n.Slots = len(r.frame.names)
+		r.frame = r.frame.parent
+		return n
+	case ast.If:
+		n.Condition = r.resolve(n.Condition)
+		n.Then = r.resolve(n.Then)
+		n.Otherwise = r.resolve(n.Otherwise)
+		return n
+	case ast.Binary:
+		n.Lhs = r.resolve(n.Lhs)
+		n.Rhs = r.resolve(n.Rhs)
+		return n
+	case ast.Call:
+		n.Callee = r.resolve(n.Callee)
+		args := make([]ast.Term, len(n.Arguments))
+		for i, arg := range n.Arguments {
+			args[i] = r.resolve(arg)
+		}
+		n.Arguments = args
+		return n
+	case ast.Tuple:
+		n.First = r.resolve(n.First)
+		n.Second = r.resolve(n.Second)
+		return n
+	case ast.Print:
+		n.Value = r.resolve(n.Value)
+		return n
+	case ast.First:
+		n.Value = r.resolve(n.Value)
+		return n
+	case ast.Second:
+		n.Value = r.resolve(n.Value)
+		return n
+	}
+	return term
+}
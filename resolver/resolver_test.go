@@ -0,0 +1,123 @@
+package resolver_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/parser"
+	"github.com/ghhernandes/rinha-compiler-go/resolver"
+)
+
+// addresses lists the variables of term as name@depth:index, the lets as
+// let name:index and the functions as fn[slots] with their free variables,
+// in the order they appear.
+func addresses(term ast.Term) []string {
+	var out []string
+	var walk func(ast.Term)
+	walk = func(term ast.Term) {
+		switch n := term.(type) {
+		case ast.Var:
+			out = append(out, fmt.Sprintf("%s@%d:%d", n.Text, n.Depth, n.Index))
+		case ast.Let:
+			out = append(out, fmt.Sprintf("let %s:%d", n.Name.Text, n.Index))
+			walk(n.Value)
+			if n.Next != nil {
+				walk(n.Next)
+			}
+		case ast.Function:
+			free := make([]string, len(n.Free))
+			for i, v := range n.Free {
+				free[i] = fmt.Sprintf("%s@%d:%d", v.Text, v.Depth, v.Index)
+			}
+			out = append(out, fmt.Sprintf("fn[%d] %v", n.Slots, free))
+			walk(n.Value)
+		case ast.If:
+			walk(n.Condition)
+			walk(n.Then)
+			walk(n.Otherwise)
+		case ast.Binary:
+			walk(n.Lhs)
+			walk(n.Rhs)
+		case ast.Call:
+			walk(n.Callee)
+			for _, arg := range n.Arguments {
+				walk(arg)
+			}
+		case ast.Tuple:
+			walk(n.First)
+			walk(n.Second)
+		case ast.Print:
+			walk(n.Value)
+		case ast.First:
+			walk(n.Value)
+		case ast.Second:
+			walk(n.Value)
+		}
+	}
+	walk(term)
+	return out
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		globals []string
+		want    []string
+		slots   []string
+	}{
+		{
+			name:  "lets and parameters",
+			src:   `let a = 1; let f = fn (x, y) => { let z = x; a + y + z }; f(a, 2)`,
+			want:  []string{"let a:0", "let f:1", "fn[3] [a@0:0]", "let z:2", "x@0:0", "a@1:0", "y@0:1", "z@0:2", "f@0:1", "a@0:0"},
+			slots: []string{"a", "f"},
+		},
+		{
+			name:  "captures of captures",
+			src:   `let a = 1; fn (x) => { fn () => { a + x } }`,
+			want:  []string{"let a:0", "fn[1] [a@0:0]", "fn[0] [a@1:0 x@0:0]", "a@1:0", "x@1:1"},
+			slots: []string{"a"},
+		},
+		{
+			name:  "shadowing",
+			src:   `let x = 1; let x = (x, 2); let f = fn (x) => { x }; fn () => { x }`,
+			want:  []string{"let x:0", "let x:1", "x@0:0", "let f:2", "fn[1] []", "x@0:0", "fn[0] [x@0:1]", "x@1:0"},
+			slots: []string{"x", "x", "f"},
+		},
+		{
+			name:  "recursion",
+			src:   `let f = fn (n) => { f(n) }; f`,
+			want:  []string{"let f:0", "fn[1] [f@0:0]", "f@1:0", "n@0:0", "f@0:0"},
+			slots: []string{"f"},
+		},
+		{
+			name:  "undefined",
+			src:   `let f = fn () => { y }; let y = 1; (f, z)`,
+			want:  []string{"let f:0", "fn[0] []", "y@-1:0", "let y:1", "f@0:0", "z@-1:0"},
+			slots: []string{"f", "y"},
+		},
+		{
+			name:    "globals",
+			src:     `let c = a; fn () => { b }`,
+			globals: []string{"a", "b"},
+			want:    []string{"let c:2", "a@0:0", "fn[0] [b@0:1]", "b@1:0"},
+			slots:   []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		file, err := parser.ParseString("test.rinha", tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		term, slots := resolver.Resolve(file.Expression, tt.globals)
+		if got := addresses(term); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		if !reflect.DeepEqual(slots, tt.slots) {
+			t.Errorf("%s: got slots %q, want %q", tt.name, slots, tt.slots)
+		}
+	}
+}
@@ -1,10 +1,124 @@
 package runtime
 
 import (
+	"errors"
 	"fmt"
 	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/diag"
 )
 
-func Error(loc ast.Location, msg string) {
-	panic(fmt.Errorf("%s:%d:%d: %s", loc.Filename, loc.Start, loc.End, msg))
+// ErrOutOfFuel is wrapped by the error of executions that used up their
+// step budget.
+var ErrOutOfFuel = errors.New("out of fuel")
+
+type ErrorKind int
+
+const (
+	UndefinedVariable ErrorKind = iota
+	TypeMismatch
+	WrongArity
+	NotCallable
+	NotATuple
+	DivisionByZero
+	StackOverflow
+	// Canceled is raised when the context of an execution is done.
+	Canceled
+	OutOfFuel
+)
+
+var errorKindNames = map[ErrorKind]string{
+	UndefinedVariable: "undefined variable",
+	TypeMismatch:      "type mismatch",
+	WrongArity:        "wrong arity",
+	NotCallable:       "not callable",
+	NotATuple:         "not a tuple",
+	DivisionByZero:    "division by zero",
+	StackOverflow:     "stack overflow",
+	Canceled:          "canceled",
+	OutOfFuel:         "out of fuel",
+}
+
+func (k ErrorKind) String() string {
+	if name, ok := errorKindNames[k]; ok {
+		return name
+	}
+	return "runtime error"
+}
+
+// RuntimeError is the error returned when a Rinha program fails while
+// executing. Stack holds the names of the active calls, innermost first.
+type RuntimeError struct {
+	Kind     ErrorKind
+	Message  string
+	Location ast.Location
+	Stack    []string
+	// Err is the cause of the error, if any, like the context error of a
+	// Canceled execution.
+	Err error
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.Location.Filename, e.Location.Start, e.Location.End, e.Message)
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RuntimeError) Diagnostic() diag.Diagnostic {
+	// Runs of the same function, as left by deep recursion, are folded
+	// into a single note.
+	var notes []string
+	for i := 0; i < len(e.Stack); {
+		j := i + 1
+		for j < len(e.Stack) && e.Stack[j] == e.Stack[i] {
+			j++
+		}
+		if j-i > 1 {
+			notes = append(notes, fmt.Sprintf("at %s (%d times)", e.Stack[i], j-i))
+		} else {
+			notes = append(notes, "at "+e.Stack[i])
+		}
+		i = j
+	}
+	return diag.Diagnostic{Severity: diag.Error, Location: e.Location, Message: e.Message, Notes: notes}
+}
+
+// Error aborts the evaluation with a *RuntimeError. Interpreters recover it
+// at the top level and return it from Execute.
+func Error(kind ErrorKind, loc ast.Location, msg string) {
+	panic(&RuntimeError{Kind: kind, Message: msg, Location: loc})
+}
+
+// Fail is like Error for failures caused by err, which the *RuntimeError
+// wraps.
+func Fail(kind ErrorKind, loc ast.Location, err error) {
+	panic(&RuntimeError{Kind: kind, Message: err.Error(), Location: loc, Err: err})
+}
+
+// Errorf is like Error but formats the message.
+func Errorf(kind ErrorKind, loc ast.Location, format string, args ...any) {
+	Error(kind, loc, fmt.Sprintf(format, args...))
+}
+
+// Recover turns a panic raised by Error into a returned error, attaching the
+// call stack (outermost first) reported by stack. Any other panic is
+// propagated. It must be called directly by defer.
+func Recover(err *error, stack func() []string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	rerr, ok := r.(*RuntimeError)
+	if !ok {
+		panic(r)
+	}
+	if rerr.Stack == nil {
+		stack := stack()
+		rerr.Stack = make([]string, len(stack))
+		for i, name := range stack {
+			rerr.Stack[len(stack)-1-i] = name
+		}
+	}
+	*err = rerr
 }
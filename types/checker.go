@@ -0,0 +1,513 @@
+package types
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+)
+
+// Errors holds every type error found in a program, ordered by location.
+type Errors []*ast.Error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+type env struct {
+	parent *env
+	name   string
+	scheme *Scheme
+}
+
+func (e *env) lookup(name string) (*Scheme, bool) {
+	for ; e != nil; e = e.parent {
+		if e.name == name {
+			return e.scheme, true
+		}
+	}
+	return nil, false
+}
+
+func (e *env) bind(name string, s *Scheme) *env {
+	return &env{parent: e, name: name, scheme: s}
+}
+
+type constraintKind int
+
+const (
+	// addable: Int + Int is Int, any mix of Int and Str is Str.
+	addable constraintKind = iota
+	// comparable: both sides are Int or both are Str.
+	comparable
+	// equatable: both sides are Int, Str or Bool.
+	equatable
+)
+
+// constraint is a check that cannot be expressed by unification alone, so it
+// waits until its operands are known.
+type constraint struct {
+	kind   constraintKind
+	op     ast.BinaryOp
+	loc    ast.Location
+	lhs    Type
+	rhs    Type
+	result Type
+}
+
+// Checker infers Hindley-Milner types for Rinha terms. Let bindings are
+// generalized, so a function like fn (x) => { x } can be used at different
+// types. Operators overloaded on Int and Str are resolved once their operands
+// are known and default to Int otherwise.
+type Checker struct {
+	env     *env
+	nextID  int
+	pending []*constraint
+	errors  Errors
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Check infers the type of a whole program and returns Errors when it is not
+// well typed.
+func Check(f *ast.File) error {
+	_, err := NewChecker().Infer(f.Expression)
+	return err
+}
+
+// Infer returns the type of term in the checker's environment.
+func (c *Checker) Infer(term ast.Term) (Type, error) {
+	c.errors = nil
+	t := c.infer(c.env, term)
+	c.solve(true)
+
+	if len(c.errors) > 0 {
+		return nil, c.sorted()
+	}
+	return Resolve(t), nil
+}
+
+func (c *Checker) sorted() Errors {
+	sort.SliceStable(c.errors, func(i, j int) bool {
+		return c.errors[i].Location.Start < c.errors[j].Location.Start
+	})
+	return c.errors
+}
+
+// Binding is a well-typed top-level binding, not yet in the environment of
+// the checker that inferred it.
+type Binding struct {
+	Type Type
+	env  *env
+}
+
+// Bind infers the type of a top-level binding in the checker's environment
+// without adding it there, so the caller can decide whether to keep it.
+func (c *Checker) Bind(name string, value ast.Term) (*Binding, error) {
+	c.errors = nil
+	e := c.let(c.env, name, value)
+	c.solve(true)
+
+	if len(c.errors) > 0 {
+		return nil, c.sorted()
+	}
+	return &Binding{Type: Resolve(e.scheme.Type), env: e}, nil
+}
+
+// Define adds a binding returned by Bind to the checker's environment, so
+// later calls to Infer and Bind can refer to it.
+func (c *Checker) Define(b *Binding) {
+	c.env = b.env
+}
+
+// Forget shadows name with a binding of no known type, for a value defined
+// although its declaration does not type check. Terms using it do not type
+// check either.
+func (c *Checker) Forget(name string) {
+	c.env = c.env.bind(name, nil)
+}
+
+func (c *Checker) errorf(loc ast.Location, format string, args ...any) {
+	c.errors = append(c.errors, ast.Errorf(loc, format, args...))
+}
+
+func (c *Checker) fresh() *Var {
+	c.nextID++
+	return &Var{ID: c.nextID}
+}
+
+func (c *Checker) infer(e *env, term ast.Term) Type {
+	switch n := term.(type) {
+	case ast.Int:
+		return Int
+	case ast.Str:
+		return Str
+	case ast.Bool:
+		return Bool
+	case ast.Var:
+		s, ok := e.lookup(n.Text)
+		if !ok {
+			c.errorf(n.Location, "undefined variable %s", n.Text)
+			return c.fresh()
+		}
+		if s == nil {
+			c.errorf(n.Location, "unknown type of %s, whose declaration does not type check", n.Text)
+			return c.fresh()
+		}
+		return c.instantiate(s)
+	case ast.Let:
+		return c.infer(c.let(e, n.Name.Text, n.Value), n.Next)
+	case ast.Function:
+		return c.function(e, n)
+	case ast.If:
+		c.expect(n.Condition, Bool, c.infer(e, n.Condition))
+		then := c.infer(e, n.Then)
+		c.expect(n.Otherwise, then, c.infer(e, n.Otherwise))
+		return then
+	case ast.Binary:
+		return c.binary(e, n)
+	case ast.Call:
+		return c.call(e, n)
+	case ast.Tuple:
+		return &Tuple{First: c.infer(e, n.First), Second: c.infer(e, n.Second)}
+	case ast.Print:
+		return c.infer(e, n.Value)
+	case ast.First:
+		return c.tuple(n.Location, c.infer(e, n.Value)).First
+	case ast.Second:
+		return c.tuple(n.Location, c.infer(e, n.Value)).Second
+	default:
+		c.errorf(ast.LocationOf(term), "unsupported term %T", term)
+		return c.fresh()
+	}
+}
+
+// let infers a binding and returns the environment extended with its
+// generalized type. Functions may refer to themselves, monomorphically.
+func (c *Checker) let(e *env, name string, value ast.Term) *env {
+	var t Type
+	if fn, ok := value.(ast.Function); ok {
+		self := c.fresh()
+		t = c.function(e.bind(name, &Scheme{Type: self}), fn)
+		c.expect(value, self, t)
+	} else {
+		t = c.infer(e, value)
+	}
+	c.solve(false)
+	return e.bind(name, c.generalize(e, t))
+}
+
+func (c *Checker) function(e *env, fn ast.Function) Type {
+	params := make([]Type, len(fn.Parameters))
+	for i, p := range fn.Parameters {
+		v := c.fresh()
+		params[i] = v
+		e = e.bind(p.Text, &Scheme{Type: v})
+	}
+	return &Func{Params: params, Result: c.infer(e, fn.Value)}
+}
+
+func (c *Checker) binary(e *env, b ast.Binary) Type {
+	lhs := c.infer(e, b.Lhs)
+	rhs := c.infer(e, b.Rhs)
+
+	switch b.Op {
+	case ast.Sub, ast.Mul, ast.Div, ast.Rem:
+		c.expect(b.Lhs, Int, lhs)
+		c.expect(b.Rhs, Int, rhs)
+		return Int
+	case ast.And, ast.Or:
+		c.expect(b.Lhs, Bool, lhs)
+		c.expect(b.Rhs, Bool, rhs)
+		return Bool
+	case ast.Lt, ast.Gt, ast.Lte, ast.Gte:
+		c.expect(b.Rhs, lhs, rhs)
+		c.pending = append(c.pending, &constraint{kind: comparable, op: b.Op, loc: b.Location, lhs: lhs, rhs: rhs})
+		return Bool
+	case ast.Eq, ast.Neq:
+		c.expect(b.Rhs, lhs, rhs)
+		c.pending = append(c.pending, &constraint{kind: equatable, op: b.Op, loc: b.Location, lhs: lhs, rhs: rhs})
+		return Bool
+	case ast.Add:
+		result := c.fresh()
+		c.pending = append(c.pending, &constraint{kind: addable, op: b.Op, loc: b.Location, lhs: lhs, rhs: rhs, result: result})
+		return result
+	default:
+		c.errorf(b.Location, "unknown binary operator %s", b.Op)
+		return c.fresh()
+	}
+}
+
+func (c *Checker) call(e *env, call ast.Call) Type {
+	callee := c.infer(e, call.Callee)
+	args := make([]Type, len(call.Arguments))
+	for i, arg := range call.Arguments {
+		args[i] = c.infer(e, arg)
+	}
+
+	switch fn := prune(callee).(type) {
+	case *Func:
+		if len(fn.Params) != len(args) {
+			c.errorf(call.Location, "wrong number of arguments: expected %d, got %d", len(fn.Params), len(args))
+			return fn.Result
+		}
+		for i, arg := range call.Arguments {
+			c.expect(arg, fn.Params[i], args[i])
+		}
+		return fn.Result
+	case *Var:
+		result := c.fresh()
+		c.unify(fn, &Func{Params: args, Result: result})
+		return result
+	default:
+		c.errorf(ast.LocationOf(call.Callee), "cannot call a value of type %s", String(callee))
+		return c.fresh()
+	}
+}
+
+func (c *Checker) tuple(loc ast.Location, t Type) *Tuple {
+	switch n := prune(t).(type) {
+	case *Tuple:
+		return n
+	case *Var:
+		tuple := &Tuple{First: c.fresh(), Second: c.fresh()}
+		c.unify(n, tuple)
+		return tuple
+	default:
+		c.errorf(loc, "expected a tuple, got %s", String(t))
+		return &Tuple{First: c.fresh(), Second: c.fresh()}
+	}
+}
+
+// expect unifies the type inferred for term with the expected one, reporting
+// a mismatch at the term's location.
+func (c *Checker) expect(term ast.Term, expected, actual Type) {
+	want, got := String(expected), String(actual)
+	if !c.unify(expected, actual) {
+		c.errorf(ast.LocationOf(term), "type mismatch: expected %s, got %s", want, got)
+	}
+}
+
+func (c *Checker) unify(a, b Type) bool {
+	a, b = prune(a), prune(b)
+
+	if v, ok := a.(*Var); ok {
+		if w, ok := b.(*Var); ok && v == w {
+			return true
+		}
+		if occurs(v, b) {
+			return false
+		}
+		v.Instance = b
+		return true
+	}
+	if _, ok := b.(*Var); ok {
+		return c.unify(b, a)
+	}
+
+	switch x := a.(type) {
+	case *Con:
+		y, ok := b.(*Con)
+		return ok && x.Name == y.Name
+	case *Tuple:
+		y, ok := b.(*Tuple)
+		return ok && c.unify(x.First, y.First) && c.unify(x.Second, y.Second)
+	case *Func:
+		y, ok := b.(*Func)
+		if !ok || len(x.Params) != len(y.Params) {
+			return false
+		}
+		for i := range x.Params {
+			if !c.unify(x.Params[i], y.Params[i]) {
+				return false
+			}
+		}
+		return c.unify(x.Result, y.Result)
+	}
+	return false
+}
+
+func occurs(v *Var, t Type) bool {
+	switch n := prune(t).(type) {
+	case *Var:
+		return n == v
+	case *Tuple:
+		return occurs(v, n.First) || occurs(v, n.Second)
+	case *Func:
+		for _, p := range n.Params {
+			if occurs(v, p) {
+				return true
+			}
+		}
+		return occurs(v, n.Result)
+	}
+	return false
+}
+
+func (c *Checker) instantiate(s *Scheme) Type {
+	if len(s.Vars) == 0 {
+		return s.Type
+	}
+	mapping := make(map[*Var]Type, len(s.Vars))
+	for _, v := range s.Vars {
+		mapping[v] = c.fresh()
+	}
+	return substitute(s.Type, mapping)
+}
+
+func substitute(t Type, mapping map[*Var]Type) Type {
+	switch n := prune(t).(type) {
+	case *Var:
+		if r, ok := mapping[n]; ok {
+			return r
+		}
+		return n
+	case *Tuple:
+		return &Tuple{First: substitute(n.First, mapping), Second: substitute(n.Second, mapping)}
+	case *Func:
+		params := make([]Type, len(n.Params))
+		for i, p := range n.Params {
+			params[i] = substitute(p, mapping)
+		}
+		return &Func{Params: params, Result: substitute(n.Result, mapping)}
+	default:
+		return n
+	}
+}
+
+// generalize quantifies the variables of t that are not free in the
+// environment. Variables still waiting on an operator constraint stay
+// monomorphic, since their type is decided by a later use.
+func (c *Checker) generalize(e *env, t Type) *Scheme {
+	fixed := make(map[*Var]bool)
+	for ; e != nil; e = e.parent {
+		bound := make(map[*Var]bool, len(e.scheme.Vars))
+		for _, v := range e.scheme.Vars {
+			bound[v] = true
+		}
+		for _, v := range freeVars(e.scheme.Type, nil) {
+			if !bound[v] {
+				fixed[v] = true
+			}
+		}
+	}
+	for _, k := range c.pending {
+		for _, t := range []Type{k.lhs, k.rhs, k.result} {
+			for _, v := range freeVars(t, nil) {
+				fixed[v] = true
+			}
+		}
+	}
+
+	s := &Scheme{Type: t}
+	seen := make(map[*Var]bool)
+	for _, v := range freeVars(t, nil) {
+		if !fixed[v] && !seen[v] {
+			seen[v] = true
+			s.Vars = append(s.Vars, v)
+		}
+	}
+	return s
+}
+
+func freeVars(t Type, acc []*Var) []*Var {
+	switch n := prune(t).(type) {
+	case *Var:
+		return append(acc, n)
+	case *Tuple:
+		return freeVars(n.Second, freeVars(n.First, acc))
+	case *Func:
+		for _, p := range n.Params {
+			acc = freeVars(p, acc)
+		}
+		return freeVars(n.Result, acc)
+	}
+	return acc
+}
+
+// solve resolves pending constraints until no more progress can be made.
+// When final is set, operands that are still unknown default to Int.
+func (c *Checker) solve(final bool) {
+	for progress := true; progress; {
+		progress = false
+		remaining := c.pending[:0]
+		for _, k := range c.pending {
+			if c.step(k, final) {
+				progress = true
+			} else {
+				remaining = append(remaining, k)
+			}
+		}
+		c.pending = remaining
+	}
+}
+
+// step tries to resolve a constraint, returning false when it must wait for
+// its operands to be known.
+func (c *Checker) step(k *constraint, final bool) bool {
+	lhs, rhs := prune(k.lhs), prune(k.rhs)
+	if final {
+		if v, ok := lhs.(*Var); ok {
+			v.Instance, lhs = Int, Int
+		}
+		if v, ok := rhs.(*Var); ok {
+			v.Instance, rhs = Int, Int
+		}
+	}
+
+	switch k.kind {
+	case addable:
+		if !addableType(lhs) || !addableType(rhs) {
+			c.errorf(k.loc, "invalid operands for %s: %s and %s", k.op, String(lhs), String(rhs))
+			return true
+		}
+		if lhs == Str || rhs == Str {
+			c.unify(k.result, Str)
+			return true
+		}
+		if lhs == Int && rhs == Int {
+			c.unify(k.result, Int)
+			return true
+		}
+		return false
+	case comparable:
+		if _, ok := lhs.(*Var); ok {
+			return false
+		}
+		if lhs != Int && lhs != Str {
+			c.errorf(k.loc, "invalid operands for %s: %s and %s", k.op, String(lhs), String(rhs))
+		}
+		return true
+	default:
+		if _, ok := lhs.(*Var); ok {
+			return false
+		}
+		if lhs != Int && lhs != Str && lhs != Bool {
+			c.errorf(k.loc, "invalid operands for %s: %s and %s", k.op, String(lhs), String(rhs))
+		}
+		return true
+	}
+}
+
+func addableType(t Type) bool {
+	switch t {
+	case Int, Str:
+		return true
+	}
+	_, ok := t.(*Var)
+	return ok
+}
@@ -0,0 +1,126 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Type interface {
+	isType()
+}
+
+type (
+	// Con is a concrete type without parameters: Int, Str or Bool.
+	Con struct {
+		Name string
+	}
+
+	Tuple struct {
+		First  Type
+		Second Type
+	}
+
+	Func struct {
+		Params []Type
+		Result Type
+	}
+
+	// Var is a type variable. Instance is set once the variable is unified
+	// with another type.
+	Var struct {
+		ID       int
+		Instance Type
+	}
+)
+
+func (*Con) isType()   {}
+func (*Tuple) isType() {}
+func (*Func) isType()  {}
+func (*Var) isType()   {}
+
+var (
+	Int  = &Con{Name: "Int"}
+	Str  = &Con{Name: "Str"}
+	Bool = &Con{Name: "Bool"}
+)
+
+// Scheme is a polymorphic type: Type quantified over Vars.
+type Scheme struct {
+	Vars []*Var
+	Type Type
+}
+
+// prune follows instantiated variables until it reaches a concrete type or an
+// unbound variable.
+func prune(t Type) Type {
+	for {
+		v, ok := t.(*Var)
+		if !ok || v.Instance == nil {
+			return t
+		}
+		t = v.Instance
+	}
+}
+
+// Resolve returns t with every bound type variable replaced by its instance.
+func Resolve(t Type) Type {
+	switch n := prune(t).(type) {
+	case *Tuple:
+		return &Tuple{First: Resolve(n.First), Second: Resolve(n.Second)}
+	case *Func:
+		params := make([]Type, len(n.Params))
+		for i, p := range n.Params {
+			params[i] = Resolve(p)
+		}
+		return &Func{Params: params, Result: Resolve(n.Result)}
+	default:
+		return n
+	}
+}
+
+// String renders t naming unbound variables 'a, 'b, ... in order of
+// appearance, so equal types always print the same way.
+func String(t Type) string {
+	names := make(map[*Var]string)
+	var b strings.Builder
+	write(&b, t, names)
+	return b.String()
+}
+
+func write(b *strings.Builder, t Type, names map[*Var]string) {
+	switch n := prune(t).(type) {
+	case *Con:
+		b.WriteString(n.Name)
+	case *Tuple:
+		b.WriteString("(")
+		write(b, n.First, names)
+		b.WriteString(", ")
+		write(b, n.Second, names)
+		b.WriteString(")")
+	case *Func:
+		b.WriteString("fn(")
+		for i, p := range n.Params {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			write(b, p, names)
+		}
+		b.WriteString(") -> ")
+		write(b, n.Result, names)
+	case *Var:
+		name, ok := names[n]
+		if !ok {
+			name = varName(len(names))
+			names[n] = name
+		}
+		b.WriteString(name)
+	}
+}
+
+func varName(i int) string {
+	name := string(rune('a' + i%26))
+	if i >= 26 {
+		name += fmt.Sprint(i / 26)
+	}
+	return "'" + name
+}
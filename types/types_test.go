@@ -0,0 +1,116 @@
+package types_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go"
+	"github.com/ghhernandes/rinha-compiler-go/parser"
+	"github.com/ghhernandes/rinha-compiler-go/types"
+)
+
+func TestInfer(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`1`, "Int"},
+		{`"a" + 1`, "Str"},
+		{`1 + 1`, "Int"},
+		{`(1, true)`, "(Int, Bool)"},
+		{`fn (x) => { x }`, "fn('a) -> 'a"},
+		{`fn (a, b) => { a + b }`, "fn(Int, Int) -> Int"},
+		{`fn (a) => { a + "!" }`, "fn(Int) -> Str"},
+		{`fn (t) => { first(t) }`, "fn(('a, 'b)) -> 'a"},
+		{`let id = fn (x) => { x }; (id(1), id("a"))`, "(Int, Str)"},
+		{`let add = fn (a, b) => { a + b }; add("a", "b")`, "Str"},
+		{`let fib = fn (n) => { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib`, "fn(Int) -> Int"},
+		{`let compose = fn (f, g) => { fn (x) => { f(g(x)) } }; compose`, "fn(fn('a) -> 'b, fn('c) -> 'a) -> fn('c) -> 'b"},
+		{`print("a" < "b")`, "Bool"},
+	}
+
+	for _, tt := range tests {
+		file, err := parser.ParseString("test.rinha", tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := types.NewChecker().Infer(file.Expression)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.src, err)
+			continue
+		}
+		if types.String(got) != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.src, types.String(got), tt.want)
+		}
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{`"a" - 1`, []string{"test.rinha:0:3: type mismatch: expected Int, got Str"}},
+		{`if (1) { 1 } else { 2 }`, []string{"test.rinha:4:5: type mismatch: expected Bool, got Int"}},
+		{`if (true) { 1 } else { "a" }`, []string{"test.rinha:23:26: type mismatch: expected Int, got Str"}},
+		{`first(1)`, []string{"test.rinha:0:8: expected a tuple, got Int"}},
+		{`let f = fn (a) => { a }; f(1, 2)`, []string{"test.rinha:25:32: wrong number of arguments: expected 1, got 2"}},
+		{`print(x)`, []string{"test.rinha:6:7: undefined variable x"}},
+		{`true + 1`, []string{"test.rinha:0:8: invalid operands for Add: Bool and Int"}},
+		{`(1, 2) == (1, 2)`, []string{"test.rinha:0:16: invalid operands for Eq: (Int, Int) and (Int, Int)"}},
+		{`let x = 1; x(1)`, []string{"test.rinha:11:12: cannot call a value of type Int"}},
+		{
+			`let a = 1 - "x"; let b = true && 1; a`,
+			[]string{
+				"test.rinha:12:15: type mismatch: expected Int, got Str",
+				"test.rinha:33:34: type mismatch: expected Bool, got Int",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		file, err := parser.ParseString("test.rinha", tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = types.Check(file)
+		errs, ok := err.(types.Errors)
+		if !ok {
+			t.Errorf("%q: expected type errors, got %v", tt.src, err)
+			continue
+		}
+		if len(errs) != len(tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.src, errs, tt.want)
+			continue
+		}
+		for i := range errs {
+			if errs[i].Error() != tt.want[i] {
+				t.Errorf("%q: got %q, want %q", tt.src, errs[i].Error(), tt.want[i])
+			}
+		}
+	}
+}
+
+func TestCheckFiles(t *testing.T) {
+	files, err := filepath.Glob("../files/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := compiler.Parse(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := types.Check(file); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
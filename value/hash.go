@@ -0,0 +1,163 @@
+package value
+
+import "github.com/ghhernandes/rinha-compiler-go/ast"
+
+const (
+	offset64 = 14695981039346656037
+	prime64  = 1099511628211
+)
+
+// Hash returns a structural hash of v: equal values always hash the same.
+// Closures hash their function and the values of its free variables.
+func Hash(v Value) uint64 {
+	switch n := v.(type) {
+	case Int:
+		return mix(uint64(INT), uint64(uint32(n)))
+	case Str:
+		return mix(uint64(STR), hashString(string(n)))
+	case Bool:
+		if n {
+			return mix(uint64(BOOL), 1)
+		}
+		return mix(uint64(BOOL), 0)
+	case *Tuple:
+		return n.hashCode()
+	case *Closure:
+		return n.hashCode()
+	}
+	return 0
+}
+
+// HashAll combines the hashes of vs in order.
+func HashAll(vs []Value) uint64 {
+	h := uint64(offset64)
+	for _, v := range vs {
+		h = mix(h, Hash(v))
+	}
+	return h
+}
+
+// Equal reports whether a and b are structurally equal. Closures are equal
+// when they share the same function and its free variables are equal.
+func Equal(a, b Value) bool {
+	switch x := a.(type) {
+	case Int, Str, Bool:
+		return a == b
+	case *Tuple:
+		y, ok := b.(*Tuple)
+		if !ok {
+			return false
+		}
+		return x == y || x.hashCode() == y.hashCode() && Equal(x.First, y.First) && Equal(x.Second, y.Second)
+	case *Closure:
+		y, ok := b.(*Closure)
+		if !ok {
+			return false
+		}
+		if x == y {
+			return true
+		}
+		if x.Function.Location != y.Function.Location || x.hashCode() != y.hashCode() {
+			return false
+		}
+		for index := range x.Function.Free {
+			a, b := x.free(index), y.free(index)
+			if a == ast.Term(x) && b == ast.Term(y) {
+				continue
+			}
+			if !equalTerms(a, b) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// EqualAll reports whether as and bs hold pairwise equal values.
+func EqualAll(as, bs []Value) bool {
+	if len(as) != len(bs) {
+		return false
+	}
+	for i := range as {
+		if !Equal(as[i], bs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// hashCode computes the hash of a tuple once; tuples never change after
+// they are created, and lists built from them are hashed again on every
+// call that takes them.
+func (t *Tuple) hashCode() uint64 {
+	if !t.hashed {
+		t.hash, t.hashed = mix(mix(uint64(TUPLE), Hash(t.First)), Hash(t.Second)), true
+	}
+	return t.hash
+}
+
+// hashCode computes the hash of a closure once; closures never change after
+// they are created, and their environments may hold many other closures.
+func (c *Closure) hashCode() uint64 {
+	if c.hashed {
+		return c.hash
+	}
+	loc := c.Function.Location
+	h := mix(mix(mix(uint64(CLOSURE), hashString(loc.Filename)), uint64(loc.Start)), uint64(loc.End))
+	for index, v := range c.Function.Free {
+		h = mix(h, hashString(v.Text))
+		// A function bound by a let captures itself.
+		if free := c.free(index); free == ast.Term(c) {
+			h = mix(h, uint64(CLOSURE))
+		} else {
+			h = mix(h, hashTerm(free))
+		}
+	}
+	c.hash, c.hashed = h, true
+	return c.hash
+}
+
+// free returns the value of the free variable at index of the function, or
+// nil when the closure has no frame.
+func (c *Closure) free(index int) ast.Term {
+	if c.Env == nil {
+		return nil
+	}
+	return c.Env.Slots[index]
+}
+
+// hashTerm hashes a frame slot, which holds a Value for every binding made
+// by the interpreter.
+func hashTerm(t ast.Term) uint64 {
+	if v, ok := t.(Value); ok {
+		return Hash(v)
+	}
+	return 0
+}
+
+func equalTerms(a, b ast.Term) bool {
+	v, vok := a.(Value)
+	w, wok := b.(Value)
+	if !vok || !wok {
+		return !vok && !wok
+	}
+	return Equal(v, w)
+}
+
+func hashString(s string) uint64 {
+	h := uint64(offset64)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime64
+	}
+	return h
+}
+
+// mix combines h with x, FNV-1a style, one 64-bit word at a time.
+func mix(h, x uint64) uint64 {
+	h ^= x
+	h *= prime64
+	h ^= h >> 32
+	return h
+}
@@ -0,0 +1,19 @@
+package value
+
+// Size estimates the memory held by v. Closures are counted without their
+// environment, which is shared with the running program.
+func Size(v Value) int {
+	switch n := v.(type) {
+	case Str:
+		return 16 + len(n)
+	case *Tuple:
+		// Like its hash, the size of a tuple is computed once.
+		if n.size == 0 {
+			n.size = 32 + Size(n.First) + Size(n.Second)
+		}
+		return n.size
+	case *Closure:
+		return 64
+	}
+	return 16
+}
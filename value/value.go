@@ -0,0 +1,98 @@
+package value
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+)
+
+type Kind int
+
+const (
+	INT Kind = iota
+	STR
+	BOOL
+	TUPLE
+	CLOSURE
+)
+
+var kindNames = [...]string{"Int", "Str", "Bool", "Tuple", "Closure"}
+
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// Value is the result of evaluating a term. Unlike AST nodes, values carry
+// no location and tuples hold already evaluated elements.
+type Value interface {
+	Kind() Kind
+	String() string
+}
+
+type (
+	Int  int32
+	Str  string
+	Bool bool
+
+	Tuple struct {
+		First  Value
+		Second Value
+
+		hash   uint64
+		hashed bool
+		size   int
+	}
+
+	// Closure is a function together with a frame holding the values of
+	// its free variables, in the order of Function.Free. Pure is set when
+	// its calls can be memoized.
+	Closure struct {
+		Function ast.Function
+		Env      *ast.Frame
+		Pure     bool
+
+		hash   uint64
+		hashed bool
+	}
+)
+
+func (Int) Kind() Kind      { return INT }
+func (Str) Kind() Kind      { return STR }
+func (Bool) Kind() Kind     { return BOOL }
+func (*Tuple) Kind() Kind   { return TUPLE }
+func (*Closure) Kind() Kind { return CLOSURE }
+
+func (v Int) String() string {
+	return strconv.FormatInt(int64(v), 10)
+}
+
+func (v Str) String() string {
+	return string(v)
+}
+
+func (v Bool) String() string {
+	return strconv.FormatBool(bool(v))
+}
+
+func (v *Tuple) String() string {
+	var b strings.Builder
+	b.WriteString("(")
+	b.WriteString(v.First.String())
+	b.WriteString(", ")
+	b.WriteString(v.Second.String())
+	b.WriteString(")")
+	return b.String()
+}
+
+func (v *Closure) String() string {
+	return "<#closure>"
+}
+
+// KindOf returns the name of the kind of v, or "nil" when v is not a Value.
+func KindOf(v any) string {
+	if v, ok := v.(Value); ok {
+		return v.Kind().String()
+	}
+	return "nil"
+}
@@ -0,0 +1,89 @@
+package value_test
+
+import (
+	"testing"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/value"
+)
+
+func TestHashAndEqual(t *testing.T) {
+	fn := ast.Function{Kind: ast.FUNCTION, Location: ast.Location{Start: 1, End: 10, Filename: "a.rinha"}}
+	other := ast.Function{Kind: ast.FUNCTION, Location: ast.Location{Start: 11, End: 20, Filename: "a.rinha"}}
+	// closure creates a closure of f whose free variables are the entries
+	// of env.
+	closure := func(f ast.Function, env ast.Scope) value.Value {
+		frame := ast.NewFrame(nil, 0)
+		for name, v := range env {
+			f.Free = append(f.Free, ast.Var{Kind: ast.VAR, Text: name, Index: len(frame.Slots)})
+			frame.Slots = append(frame.Slots, v)
+		}
+		return &value.Closure{Function: f, Env: frame}
+	}
+
+	tests := []struct {
+		a, b  value.Value
+		equal bool
+	}{
+		{value.Int(1), value.Int(1), true},
+		{value.Int(1), value.Int(2), false},
+		{value.Int(1), value.Str("1"), false},
+		{value.Bool(true), value.Bool(true), true},
+		{&value.Tuple{First: value.Int(1), Second: value.Int(2)}, &value.Tuple{First: value.Int(1), Second: value.Int(2)}, true},
+		{&value.Tuple{First: value.Int(1), Second: value.Int(2)}, &value.Tuple{First: value.Int(2), Second: value.Int(1)}, false},
+		{closure(fn, ast.Scope{"n": value.Int(1)}), closure(fn, ast.Scope{"n": value.Int(1)}), true},
+		{closure(fn, ast.Scope{"n": value.Int(1)}), closure(fn, ast.Scope{"n": value.Int(2)}), false},
+		{closure(fn, ast.Scope{"n": value.Int(1)}), closure(other, ast.Scope{"n": value.Int(1)}), false},
+		{
+			closure(fn, ast.Scope{"g": closure(other, ast.Scope{"t": &value.Tuple{First: value.Int(1), Second: value.Str("a")}})}),
+			closure(fn, ast.Scope{"g": closure(other, ast.Scope{"t": &value.Tuple{First: value.Int(1), Second: value.Str("a")}})}),
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := value.Equal(tt.a, tt.b); got != tt.equal {
+			t.Errorf("Equal(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.equal)
+		}
+		if tt.equal && value.Hash(tt.a) != value.Hash(tt.b) {
+			t.Errorf("equal values %v and %v hash differently", tt.a, tt.b)
+		}
+	}
+}
+
+func TestRecursiveClosure(t *testing.T) {
+	// fn (n) => { f(n) }, bound to f by a let, holds itself.
+	recursive := func() *value.Closure {
+		fn := ast.Function{Kind: ast.FUNCTION, Location: ast.Location{Start: 1, End: 10, Filename: "a.rinha"}}
+		fn.Free = []ast.Var{{Kind: ast.VAR, Text: "f"}}
+		c := &value.Closure{Function: fn, Env: ast.NewFrame(nil, 1)}
+		c.Env.Slots[0] = c
+		return c
+	}
+	a, b := recursive(), recursive()
+	if !value.Equal(a, b) || value.Hash(a) != value.Hash(b) {
+		t.Error("closures of the same recursive function are not equal")
+	}
+}
+
+func TestHashAll(t *testing.T) {
+	a := []value.Value{value.Int(1), value.Int(2)}
+	b := []value.Value{value.Int(2), value.Int(1)}
+	if value.HashAll(a) == value.HashAll(b) {
+		t.Error("argument order does not change the hash")
+	}
+	if !value.EqualAll(a, a) || value.EqualAll(a, b) {
+		t.Error("EqualAll compares arguments pairwise")
+	}
+}
+
+func TestSize(t *testing.T) {
+	list := &value.Tuple{First: value.Int(1), Second: &value.Tuple{First: value.Str("ab"), Second: value.Int(2)}}
+	if got, want := value.Size(list), 32+16+(32+18+16); got != want {
+		t.Errorf("Size = %d, want %d", got, want)
+	}
+	// The cached hash and size must not change what is computed.
+	if got := value.Size(list); got != 114 {
+		t.Errorf("Size changed to %d on the second call", got)
+	}
+}
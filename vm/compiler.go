@@ -0,0 +1,338 @@
+package vm
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+)
+
+type CaptureSource uint8
+
+const (
+	CaptureLocal CaptureSource = iota
+	CaptureUpvalue
+	CaptureSelf
+)
+
+// Capture describes where OpClosure finds a captured value in the frame
+// that creates the closure.
+type Capture struct {
+	Source CaptureSource
+	Index  int
+}
+
+type Proto struct {
+	Name      string
+	Arity     int
+	NumLocals int
+	Code      []byte
+	Captures  []Capture
+	Location  ast.Location
+	positions []position
+}
+
+// position maps the instruction starting at pc to the term it came from, so
+// runtime errors can point at the source.
+type position struct {
+	pc  int
+	loc ast.Location
+}
+
+func (p *Proto) location(pc int) ast.Location {
+	loc := p.Location
+	for _, pos := range p.positions {
+		if pos.pc > pc {
+			break
+		}
+		loc = pos.loc
+	}
+	return loc
+}
+
+type Program struct {
+	Constants []Value
+	Protos    []*Proto
+}
+
+func (p *Program) Main() *Proto {
+	return p.Protos[0]
+}
+
+type scope struct {
+	parent *scope
+	name   string
+	slot   int
+}
+
+type funcState struct {
+	parent   *funcState
+	proto    *Proto
+	scope    *scope
+	self     string
+	captures map[string]int
+}
+
+type compiler struct {
+	prog   *Program
+	consts map[any]int
+	fn     *funcState
+}
+
+// Compile translates an ast.File into bytecode. The top-level expression
+// becomes the first proto of the program, with no parameters.
+func Compile(f *ast.File) (prog *Program, err error) {
+	c := &compiler{
+		prog:   &Program{},
+		consts: make(map[any]int),
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			cerr, ok := r.(*ast.Error)
+			if !ok {
+				panic(r)
+			}
+			prog, err = nil, cerr
+		}
+	}()
+
+	c.function("main", nil, f.Expression, f.Location, "")
+	return c.prog, nil
+}
+
+func (c *compiler) errorf(loc ast.Location, format string, args ...any) {
+	panic(ast.Errorf(loc, format, args...))
+}
+
+func (c *compiler) function(name string, params []ast.Parameter, body ast.Term, loc ast.Location, self string) int {
+	proto := &Proto{Name: name, Arity: len(params), Location: loc}
+	index := len(c.prog.Protos)
+	c.prog.Protos = append(c.prog.Protos, proto)
+
+	c.fn = &funcState{
+		parent:   c.fn,
+		proto:    proto,
+		self:     self,
+		captures: make(map[string]int),
+	}
+	for _, param := range params {
+		c.declare(param.Text)
+	}
+
+	// The body of main is not in tail position, so calls made there nest
+	// like they do in the interpreter.
+	c.expr(body, c.fn.parent != nil)
+	c.emit(OpReturn)
+
+	c.fn = c.fn.parent
+	return index
+}
+
+func (c *compiler) declare(name string) int {
+	slot := c.fn.proto.NumLocals
+	c.fn.proto.NumLocals++
+	c.fn.scope = &scope{parent: c.fn.scope, name: name, slot: slot}
+	return slot
+}
+
+func (c *compiler) resolve(fn *funcState, name string) (CaptureSource, int, bool) {
+	for s := fn.scope; s != nil; s = s.parent {
+		if s.name == name {
+			return CaptureLocal, s.slot, true
+		}
+	}
+	if fn.self == name {
+		return CaptureSelf, 0, true
+	}
+	if index, ok := fn.captures[name]; ok {
+		return CaptureUpvalue, index, true
+	}
+	if fn.parent == nil {
+		return 0, 0, false
+	}
+
+	source, index, ok := c.resolve(fn.parent, name)
+	if !ok {
+		return 0, 0, false
+	}
+	capture := len(fn.proto.Captures)
+	fn.proto.Captures = append(fn.proto.Captures, Capture{Source: source, Index: index})
+	fn.captures[name] = capture
+	return CaptureUpvalue, capture, true
+}
+
+func (c *compiler) constant(loc ast.Location, key any, v Value) {
+	c.emitU16(loc, OpConst, c.intern(key, v))
+}
+
+// intern returns the index of v in the constants pool, adding it under key
+// the first time.
+func (c *compiler) intern(key any, v Value) int {
+	index, ok := c.consts[key]
+	if !ok {
+		index = len(c.prog.Constants)
+		c.prog.Constants = append(c.prog.Constants, v)
+		c.consts[key] = index
+	}
+	return index
+}
+
+func (c *compiler) mark(loc ast.Location) {
+	proto := c.fn.proto
+	proto.positions = append(proto.positions, position{pc: len(proto.Code), loc: loc})
+}
+
+func (c *compiler) emit(op Opcode) {
+	c.fn.proto.Code = append(c.fn.proto.Code, byte(op))
+}
+
+func (c *compiler) emitU16(loc ast.Location, op Opcode, operand int) int {
+	if operand > math.MaxUint16 {
+		c.errorf(loc, "bytecode operand %d out of range", operand)
+	}
+	c.emit(op)
+	c.fn.proto.Code = binary.BigEndian.AppendUint16(c.fn.proto.Code, uint16(operand))
+	return len(c.fn.proto.Code) - 2
+}
+
+func (c *compiler) patch(loc ast.Location, at int) {
+	target := len(c.fn.proto.Code)
+	if target > math.MaxUint16 {
+		c.errorf(loc, "function too large")
+	}
+	binary.BigEndian.PutUint16(c.fn.proto.Code[at:], uint16(target))
+}
+
+var binaryOpcodes = map[ast.BinaryOp]Opcode{
+	ast.Add: OpAdd,
+	ast.Sub: OpSub,
+	ast.Mul: OpMul,
+	ast.Div: OpDiv,
+	ast.Rem: OpRem,
+	ast.Eq:  OpEq,
+	ast.Neq: OpNeq,
+	ast.Lt:  OpLt,
+	ast.Gt:  OpGt,
+	ast.Lte: OpLte,
+	ast.Gte: OpGte,
+	ast.And: OpAnd,
+	ast.Or:  OpOr,
+}
+
+var binaryOps = make(map[Opcode]ast.BinaryOp, len(binaryOpcodes))
+
+func init() {
+	for op, opcode := range binaryOpcodes {
+		binaryOps[opcode] = op
+	}
+}
+
+func (c *compiler) term(node ast.Term) {
+	c.expr(node, false)
+}
+
+// expr compiles node, emitting calls found in tail position, whose result
+// is the result of the function, as OpTailCall.
+func (c *compiler) expr(node ast.Term, tail bool) {
+	switch n := node.(type) {
+	case ast.Int:
+		c.constant(n.Location, n.Value, Int(n.Value))
+	case ast.Str:
+		c.constant(n.Location, n.Value, Str(n.Value))
+	case ast.Bool:
+		if n.Value {
+			c.emit(OpTrue)
+		} else {
+			c.emit(OpFalse)
+		}
+	case ast.Var:
+		source, index, ok := c.resolve(c.fn, n.Text)
+		if !ok {
+			// Like in the interpreter, a variable bound nowhere is an
+			// error only when it is evaluated.
+			c.mark(n.Location)
+			c.emitU16(n.Location, OpUndefined, c.intern(n.Text, Str(n.Text)))
+			break
+		}
+		switch source {
+		case CaptureLocal:
+			c.emitU16(n.Location, OpLoad, index)
+		case CaptureUpvalue:
+			c.emitU16(n.Location, OpCapture, index)
+		case CaptureSelf:
+			c.emit(OpSelf)
+		}
+	case ast.Let:
+		if fn, ok := n.Value.(ast.Function); ok {
+			c.closure(n.Name.Text, fn, n.Name.Text)
+		} else {
+			c.term(n.Value)
+		}
+		outer := c.fn.scope
+		slot := c.declare(n.Name.Text)
+		c.emitU16(n.Location, OpStore, slot)
+		c.expr(n.Next, tail)
+		c.fn.scope = outer
+	case ast.Function:
+		c.closure("<anonymous>", n, "")
+	case ast.If:
+		c.term(n.Condition)
+		c.mark(n.Location)
+		otherwise := c.emitU16(n.Location, OpJumpIfFalse, 0)
+		c.expr(n.Then, tail)
+		end := c.emitU16(n.Location, OpJump, 0)
+		c.patch(n.Location, otherwise)
+		c.expr(n.Otherwise, tail)
+		c.patch(n.Location, end)
+	case ast.Binary:
+		op, ok := binaryOpcodes[n.Op]
+		if !ok {
+			c.errorf(n.Location, "unknown binary operator %s", n.Op)
+		}
+		c.term(n.Lhs)
+		c.term(n.Rhs)
+		c.mark(n.Location)
+		c.emit(op)
+	case ast.Call:
+		if len(n.Arguments) > math.MaxUint8 {
+			c.errorf(n.Location, "too many arguments")
+		}
+		c.term(n.Callee)
+		for _, arg := range n.Arguments {
+			c.term(arg)
+		}
+		c.mark(n.Location)
+		if tail {
+			c.emit(OpTailCall)
+		} else {
+			c.emit(OpCall)
+		}
+		c.fn.proto.Code = append(c.fn.proto.Code, byte(len(n.Arguments)))
+	case ast.Tuple:
+		c.term(n.First)
+		c.term(n.Second)
+		c.emit(OpTuple)
+	case ast.Print:
+		c.term(n.Value)
+		c.emit(OpPrint)
+	case ast.First:
+		c.term(n.Value)
+		c.mark(n.Location)
+		c.emit(OpFirst)
+	case ast.Second:
+		c.term(n.Value)
+		c.mark(n.Location)
+		c.emit(OpSecond)
+	default:
+		c.errorf(ast.LocationOf(node), "unsupported term %T", node)
+	}
+}
+
+// closure compiles fn into a new proto and emits the instruction creating it.
+// self is the name of the let binding being defined, if any, so the function
+// body can refer to itself before the binding exists.
+func (c *compiler) closure(name string, fn ast.Function, self string) {
+	index := c.function(name, fn.Parameters, fn.Value, fn.Location, self)
+	c.emitU16(fn.Location, OpClosure, index)
+}
@@ -0,0 +1,29 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+)
+
+// Disassemble writes a human readable listing of every proto in the program.
+func (p *Program) Disassemble(w io.Writer) {
+	for i, proto := range p.Protos {
+		fmt.Fprintf(w, "proto %d %s arity=%d locals=%d captures=%v\n", i, proto.Name, proto.Arity, proto.NumLocals, proto.Captures)
+		for pc := 0; pc < len(proto.Code); {
+			op := Opcode(proto.Code[pc])
+			fmt.Fprintf(w, "  %04d %s", pc, op)
+			switch opcodes[op].operands {
+			case 1:
+				fmt.Fprintf(w, " %d", proto.Code[pc+1])
+			case 2:
+				operand := int(proto.Code[pc+1])<<8 | int(proto.Code[pc+2])
+				fmt.Fprintf(w, " %d", operand)
+				if op == OpConst || op == OpUndefined {
+					fmt.Fprintf(w, " (%s)", p.Constants[operand])
+				}
+			}
+			fmt.Fprintln(w)
+			pc += 1 + opcodes[op].operands
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package vm
+
+type Opcode byte
+
+const (
+	// OpConst <u16 constant> pushes a value from the constants pool.
+	OpConst Opcode = iota
+	OpTrue
+	OpFalse
+	// OpLoad <u16 slot> pushes a local of the current frame.
+	OpLoad
+	// OpStore <u16 slot> pops the top of the stack into a local.
+	OpStore
+	// OpCapture <u16 index> pushes a value captured by the running closure.
+	OpCapture
+	// OpSelf pushes the running closure, used by recursive let bindings.
+	OpSelf
+	// OpUndefined <u16 constant> fails with an undefined variable error for
+	// the name in the constants pool.
+	OpUndefined
+	// OpClosure <u16 proto> creates a closure, capturing the values
+	// described by Proto.Captures from the current frame.
+	OpClosure
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpRem
+	OpEq
+	OpNeq
+	OpLt
+	OpGt
+	OpLte
+	OpGte
+	OpAnd
+	OpOr
+	// OpJump <u16 address> moves the instruction pointer.
+	OpJump
+	// OpJumpIfFalse <u16 address> pops a Bool and jumps when it is false.
+	OpJumpIfFalse
+	// OpCall <u8 argc> calls the closure below the arguments on the stack.
+	OpCall
+	// OpTailCall <u8 argc> is OpCall in tail position: the call replaces
+	// the frame of the running function instead of nesting in it.
+	OpTailCall
+	OpReturn
+	OpTuple
+	OpFirst
+	OpSecond
+	OpPrint
+)
+
+type opcodeInfo struct {
+	name     string
+	operands int
+}
+
+var opcodes = map[Opcode]opcodeInfo{
+	OpConst:       {"CONST", 2},
+	OpTrue:        {"TRUE", 0},
+	OpFalse:       {"FALSE", 0},
+	OpLoad:        {"LOAD", 2},
+	OpStore:       {"STORE", 2},
+	OpCapture:     {"CAPTURE", 2},
+	OpSelf:        {"SELF", 0},
+	OpUndefined:   {"UNDEFINED", 2},
+	OpClosure:     {"CLOSURE", 2},
+	OpAdd:         {"ADD", 0},
+	OpSub:         {"SUB", 0},
+	OpMul:         {"MUL", 0},
+	OpDiv:         {"DIV", 0},
+	OpRem:         {"REM", 0},
+	OpEq:          {"EQ", 0},
+	OpNeq:         {"NEQ", 0},
+	OpLt:          {"LT", 0},
+	OpGt:          {"GT", 0},
+	OpLte:         {"LTE", 0},
+	OpGte:         {"GTE", 0},
+	OpAnd:         {"AND", 0},
+	OpOr:          {"OR", 0},
+	OpJump:        {"JUMP", 2},
+	OpJumpIfFalse: {"JUMP_IF_FALSE", 2},
+	OpCall:        {"CALL", 1},
+	OpTailCall:    {"TAIL_CALL", 1},
+	OpReturn:      {"RETURN", 0},
+	OpTuple:       {"TUPLE", 0},
+	OpFirst:       {"FIRST", 0},
+	OpSecond:      {"SECOND", 0},
+	OpPrint:       {"PRINT", 0},
+}
+
+func (op Opcode) String() string {
+	if info, ok := opcodes[op]; ok {
+		return info.name
+	}
+	return "UNKNOWN"
+}
@@ -0,0 +1,90 @@
+package vm
+
+import (
+	"strconv"
+	"strings"
+)
+
+type Kind uint8
+
+const (
+	KindNil Kind = iota
+	KindInt
+	KindStr
+	KindBool
+	KindTuple
+	KindClosure
+)
+
+var kindNames = [...]string{"Nil", "Int", "Str", "Bool", "Tuple", "Closure"}
+
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// Value is the runtime representation used by the VM. Ints and Bools are
+// stored inline in n, everything else lives in ref, so arithmetic never
+// allocates.
+type Value struct {
+	kind Kind
+	n    int32
+	ref  any
+}
+
+type Tuple struct {
+	First  Value
+	Second Value
+}
+
+type Closure struct {
+	proto    *Proto
+	captures []Value
+}
+
+func Int(n int32) Value {
+	return Value{kind: KindInt, n: n}
+}
+
+func Str(s string) Value {
+	return Value{kind: KindStr, ref: s}
+}
+
+func Bool(b bool) Value {
+	if b {
+		return Value{kind: KindBool, n: 1}
+	}
+	return Value{kind: KindBool}
+}
+
+func (v Value) Kind() Kind {
+	return v.kind
+}
+
+func (v Value) String() string {
+	var b strings.Builder
+	v.format(&b)
+	return b.String()
+}
+
+// format writes the value the same way interpreter.Print does.
+func (v Value) format(b *strings.Builder) {
+	switch v.kind {
+	case KindInt:
+		b.WriteString(strconv.FormatInt(int64(v.n), 10))
+	case KindStr:
+		b.WriteString(v.ref.(string))
+	case KindBool:
+		b.WriteString(strconv.FormatBool(v.n != 0))
+	case KindTuple:
+		t := v.ref.(*Tuple)
+		b.WriteString("(")
+		t.First.format(b)
+		b.WriteString(", ")
+		t.Second.format(b)
+		b.WriteString(")")
+	case KindClosure:
+		b.WriteString("<#closure>")
+	default:
+		b.WriteString("nil")
+	}
+}
@@ -0,0 +1,345 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ghhernandes/rinha-compiler-go/ast"
+	"github.com/ghhernandes/rinha-compiler-go/runtime"
+)
+
+const STACK_DEFAULT_SIZE = 256
+
+// CANCEL_CHECK_INTERVAL is how many instructions run between checks of the
+// context, which are too costly to make on every instruction.
+const CANCEL_CHECK_INTERVAL = 1024
+
+type frame struct {
+	closure *Closure
+	ip      int
+	base    int
+}
+
+type VM struct {
+	w        io.Writer
+	prog     *Program
+	stack    []Value
+	frames   []frame
+	maxDepth int
+	fuel     int
+	steps    int
+	ctx      context.Context
+}
+
+type Option func(*VM)
+
+// WithMaxDepth limits how deeply calls may nest before execution fails with
+// a stack overflow error. A limit of 0 or less removes the check.
+func WithMaxDepth(n int) Option {
+	return func(m *VM) {
+		m.maxDepth = n
+	}
+}
+
+// WithFuel limits every execution to n instructions. Running out fails with
+// a runtime.OutOfFuel error.
+func WithFuel(n int) Option {
+	return func(m *VM) {
+		m.fuel = n
+	}
+}
+
+func New(w io.Writer, prog *Program, opts ...Option) *VM {
+	if w == nil {
+		w = io.Discard
+	}
+	m := &VM{
+		w:     w,
+		prog:  prog,
+		stack: make([]Value, 0, STACK_DEFAULT_SIZE),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Execute runs the program until it ends or ctx is done.
+func (m *VM) Execute(ctx context.Context) error {
+	main := &Closure{proto: m.prog.Main()}
+	m.stack = append(m.stack[:0], Value{kind: KindClosure, ref: main})
+	m.stack = append(m.stack, make([]Value, main.proto.NumLocals)...)
+	m.frames = append(m.frames[:0], frame{closure: main, base: 1})
+	m.steps, m.ctx = 0, ctx
+
+	_, err := m.run()
+	return err
+}
+
+func (m *VM) errorf(pc int, kind runtime.ErrorKind, format string, args ...any) *runtime.RuntimeError {
+	stack := make([]string, 0, len(m.frames)-1)
+	for i := len(m.frames) - 1; i > 0; i-- {
+		stack = append(stack, m.frames[i].closure.proto.Name)
+	}
+	return &runtime.RuntimeError{
+		Kind:     kind,
+		Message:  fmt.Sprintf(format, args...),
+		Location: m.frames[len(m.frames)-1].closure.proto.location(pc),
+		Stack:    stack,
+	}
+}
+
+// fail is like errorf for errors with a cause.
+func (m *VM) fail(pc int, kind runtime.ErrorKind, err error) error {
+	rerr := m.errorf(pc, kind, "%s", err)
+	rerr.Err = err
+	return rerr
+}
+
+// step accounts for running the instruction at pc, stopping the execution
+// when it is out of fuel or its context is done.
+func (m *VM) step(pc int) error {
+	m.steps++
+	if m.fuel > 0 && m.steps > m.fuel {
+		return m.fail(pc, runtime.OutOfFuel, fmt.Errorf("%w after %d steps", runtime.ErrOutOfFuel, m.fuel))
+	}
+	if m.steps%CANCEL_CHECK_INTERVAL == 0 {
+		select {
+		case <-m.ctx.Done():
+			return m.fail(pc, runtime.Canceled, fmt.Errorf("execution stopped: %w", m.ctx.Err()))
+		default:
+		}
+	}
+	return nil
+}
+
+func (m *VM) push(v Value) {
+	m.stack = append(m.stack, v)
+}
+
+func (m *VM) pop() Value {
+	v := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return v
+}
+
+func (m *VM) run() (Value, error) {
+	fr := &m.frames[len(m.frames)-1]
+	code := fr.closure.proto.Code
+	consts := m.prog.Constants
+
+	for {
+		pc := fr.ip
+		if err := m.step(pc); err != nil {
+			return Value{}, err
+		}
+		op := Opcode(code[pc])
+		fr.ip++
+
+		switch op {
+		case OpConst:
+			m.push(consts[m.u16(fr, code)])
+		case OpTrue:
+			m.push(Bool(true))
+		case OpFalse:
+			m.push(Bool(false))
+		case OpLoad:
+			m.push(m.stack[fr.base+m.u16(fr, code)])
+		case OpStore:
+			m.stack[fr.base+m.u16(fr, code)] = m.pop()
+		case OpCapture:
+			m.push(fr.closure.captures[m.u16(fr, code)])
+		case OpSelf:
+			m.push(Value{kind: KindClosure, ref: fr.closure})
+		case OpUndefined:
+			name := consts[m.u16(fr, code)]
+			return Value{}, m.errorf(pc, runtime.UndefinedVariable, "undefined variable %s", name)
+		case OpClosure:
+			proto := m.prog.Protos[m.u16(fr, code)]
+			closure := &Closure{proto: proto, captures: make([]Value, len(proto.Captures))}
+			for i, capture := range proto.Captures {
+				switch capture.Source {
+				case CaptureLocal:
+					closure.captures[i] = m.stack[fr.base+capture.Index]
+				case CaptureUpvalue:
+					closure.captures[i] = fr.closure.captures[capture.Index]
+				case CaptureSelf:
+					closure.captures[i] = Value{kind: KindClosure, ref: fr.closure}
+				}
+			}
+			m.push(Value{kind: KindClosure, ref: closure})
+		case OpAdd, OpSub, OpMul, OpDiv, OpRem, OpEq, OpNeq, OpLt, OpGt, OpLte, OpGte, OpAnd, OpOr:
+			r := m.pop()
+			l := m.pop()
+			v, err := m.binary(pc, op, l, r)
+			if err != nil {
+				return Value{}, err
+			}
+			m.push(v)
+		case OpJump:
+			fr.ip = m.u16(fr, code)
+		case OpJumpIfFalse:
+			target := m.u16(fr, code)
+			cond := m.pop()
+			if cond.kind != KindBool {
+				return Value{}, m.errorf(pc, runtime.TypeMismatch, "condition must be a Bool, got %s", cond.kind)
+			}
+			if cond.n == 0 {
+				fr.ip = target
+			}
+		case OpCall, OpTailCall:
+			argc := int(code[fr.ip])
+			fr.ip++
+			base := len(m.stack) - argc
+			callee := m.stack[base-1]
+			if callee.kind != KindClosure {
+				return Value{}, m.errorf(pc, runtime.NotCallable, "cannot call a %s", callee.kind)
+			}
+			closure := callee.ref.(*Closure)
+			if closure.proto.Arity != argc {
+				return Value{}, m.errorf(pc, runtime.WrongArity, "wrong number of arguments: %s expects %d, got %d", closure.proto.Name, closure.proto.Arity, argc)
+			}
+			if op == OpTailCall {
+				// The callee and its arguments take the place of the
+				// running function, so tail calls do not nest, as in the
+				// interpreter.
+				copy(m.stack[fr.base-1:], m.stack[base-1:])
+				base = fr.base
+				m.stack = m.stack[:base+argc]
+				m.frames = m.frames[:len(m.frames)-1]
+			} else if m.maxDepth > 0 && len(m.frames) > m.maxDepth {
+				return Value{}, m.errorf(pc, runtime.StackOverflow, "stack overflow: calls to %s nested more than %d deep", closure.proto.Name, m.maxDepth)
+			}
+			for i := argc; i < closure.proto.NumLocals; i++ {
+				m.push(Value{})
+			}
+			m.frames = append(m.frames, frame{closure: closure, base: base})
+			fr = &m.frames[len(m.frames)-1]
+			code = closure.proto.Code
+		case OpReturn:
+			result := m.pop()
+			m.stack = m.stack[:fr.base-1]
+			m.frames = m.frames[:len(m.frames)-1]
+			if len(m.frames) == 0 {
+				return result, nil
+			}
+			m.push(result)
+			fr = &m.frames[len(m.frames)-1]
+			code = fr.closure.proto.Code
+		case OpTuple:
+			second := m.pop()
+			first := m.pop()
+			m.push(Value{kind: KindTuple, ref: &Tuple{First: first, Second: second}})
+		case OpFirst, OpSecond:
+			v := m.pop()
+			if v.kind != KindTuple {
+				return Value{}, m.errorf(pc, runtime.NotATuple, "not a tuple")
+			}
+			if op == OpFirst {
+				m.push(v.ref.(*Tuple).First)
+			} else {
+				m.push(v.ref.(*Tuple).Second)
+			}
+		case OpPrint:
+			v := m.stack[len(m.stack)-1]
+			var b strings.Builder
+			v.format(&b)
+			b.WriteString("\n")
+			io.WriteString(m.w, b.String())
+		default:
+			return Value{}, m.errorf(pc, runtime.TypeMismatch, "invalid opcode %d", op)
+		}
+	}
+}
+
+func (m *VM) u16(fr *frame, code []byte) int {
+	v := int(code[fr.ip])<<8 | int(code[fr.ip+1])
+	fr.ip += 2
+	return v
+}
+
+func (m *VM) binary(pc int, op Opcode, l, r Value) (Value, error) {
+	switch op {
+	case OpAdd:
+		switch {
+		case l.kind == KindInt && r.kind == KindInt:
+			return Int(l.n + r.n), nil
+		case (l.kind == KindInt || l.kind == KindStr) && (r.kind == KindInt || r.kind == KindStr):
+			return Str(l.String() + r.String()), nil
+		}
+	case OpSub, OpMul, OpDiv, OpRem:
+		if l.kind != KindInt || r.kind != KindInt {
+			break
+		}
+		switch op {
+		case OpSub:
+			return Int(l.n - r.n), nil
+		case OpMul:
+			return Int(l.n * r.n), nil
+		}
+		if r.n == 0 {
+			return Value{}, m.errorf(pc, runtime.DivisionByZero, "division by zero")
+		}
+		if op == OpDiv {
+			return Int(l.n / r.n), nil
+		}
+		return Int(l.n % r.n), nil
+	case OpEq, OpNeq:
+		if l.kind != r.kind || l.kind == KindTuple || l.kind == KindClosure {
+			break
+		}
+		eq := l.n == r.n
+		if l.kind == KindStr {
+			eq = l.ref.(string) == r.ref.(string)
+		}
+		return Bool(eq == (op == OpEq)), nil
+	case OpLt, OpGt, OpLte, OpGte:
+		if l.kind != r.kind || (l.kind != KindInt && l.kind != KindStr) {
+			break
+		}
+		cmp := compare(l, r)
+		switch op {
+		case OpLt:
+			return Bool(cmp < 0), nil
+		case OpGt:
+			return Bool(cmp > 0), nil
+		case OpLte:
+			return Bool(cmp <= 0), nil
+		default:
+			return Bool(cmp >= 0), nil
+		}
+	case OpAnd, OpOr:
+		if l.kind != KindBool || r.kind != KindBool {
+			break
+		}
+		if op == OpAnd {
+			return Bool(l.n != 0 && r.n != 0), nil
+		}
+		return Bool(l.n != 0 || r.n != 0), nil
+	}
+	return Value{}, m.errorf(pc, runtime.TypeMismatch, "invalid operands for %s: %s and %s", binaryOps[op], l.kind, r.kind)
+}
+
+func compare(l, r Value) int {
+	if l.kind == KindStr {
+		return strings.Compare(l.ref.(string), r.ref.(string))
+	}
+	switch {
+	case l.n < r.n:
+		return -1
+	case l.n > r.n:
+		return 1
+	}
+	return 0
+}
+
+// Run compiles and executes a file in one step.
+func Run(ctx context.Context, w io.Writer, f *ast.File, opts ...Option) error {
+	prog, err := Compile(f)
+	if err != nil {
+		return err
+	}
+	return New(w, prog, opts...).Execute(ctx)
+}
@@ -0,0 +1,191 @@
+package vm_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghhernandes/rinha-compiler-go"
+	"github.com/ghhernandes/rinha-compiler-go/interpreter"
+	"github.com/ghhernandes/rinha-compiler-go/parser"
+	"github.com/ghhernandes/rinha-compiler-go/runtime"
+	"github.com/ghhernandes/rinha-compiler-go/vm"
+)
+
+func TestVMMatchesInterpreter(t *testing.T) {
+	files, err := filepath.Glob("../files/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range files {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			f, err := os.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			file, err := compiler.Parse(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var want, got bytes.Buffer
+			if err := interpreter.New(&want, file).Execute(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if err := vm.Run(context.Background(), &got, file); err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != want.String() {
+				t.Errorf("got %q, want %q", got.String(), want.String())
+			}
+		})
+	}
+}
+
+func TestVMPrograms(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		out  string
+	}{
+		{"closure", `let add = fn (a) => { fn (b) => { a + b } }; let inc = add(1); print(inc(41))`, "42\n"},
+		{"nested capture", `let x = 10; let f = fn () => { fn () => { x } }; print(f()())`, "10\n"},
+		{"shadowing", `let x = 1; let f = fn (x) => { x * 2 }; let x = 5; print(f(x) + x)`, "15\n"},
+		{"tuple", `let t = (1, ("a", true)); let _ = print(t); print(first(second(t)))`, "(1, (a, true))\na\n"},
+		{"concat", `print(1 + "a" + 2)`, "1a2\n"},
+		{"closure print", `print(fn () => { 1 })`, "<#closure>\n"},
+		{"wrap around", `print(2147483647 + 1)`, "-2147483648\n"},
+		{"print returns value", `let x = print(1); print(x + 1)`, "1\n2\n"},
+		{"recursive inner lambda", `let f = fn (n) => { let g = fn () => { f(n - 1) }; if (n == 0) { 0 } else { g() } }; print(f(3))`, "0\n"},
+		{"unbound variable not reached", `let _ = print("start"); if (true) { print(1) } else { nope }`, "start\n1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := parser.ParseString("test.rinha", tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err := vm.Run(context.Background(), &out, file); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.out {
+				t.Errorf("got %q, want %q", out.String(), tt.out)
+			}
+		})
+	}
+}
+
+func TestVMErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{`print(1 / 0)`, "test.rinha:6:11: division by zero"},
+		{`let f = fn (a) => { a }; f(1, 2)`, "test.rinha:25:32: wrong number of arguments: f expects 1, got 2"},
+		{`if (1) { 1 } else { 2 }`, "test.rinha:0:23: condition must be a Bool, got Int"},
+		{`first(1)`, "test.rinha:0:8: not a tuple"},
+		{`"a" - 1`, "test.rinha:0:7: invalid operands for Sub: Str and Int"},
+		{`print(y)`, "test.rinha:6:7: undefined variable y"},
+	}
+
+	for _, tt := range tests {
+		file, err := parser.ParseString("test.rinha", tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = vm.Run(context.Background(), nil, file)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: got error %v, want %q", tt.src, err, tt.err)
+		}
+	}
+}
+
+func TestVMErrorStack(t *testing.T) {
+	file, err := parser.ParseString("test.rinha", `let f = fn (n) => { if (n == 0) { 1 / n } else { 1 + f(n - 1) } }; f(2)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rerr *runtime.RuntimeError
+	if err := vm.Run(context.Background(), nil, file); !errors.As(err, &rerr) {
+		t.Fatalf("expected a runtime error, got %v", err)
+	}
+	if rerr.Kind != runtime.DivisionByZero {
+		t.Errorf("got kind %s, want %s", rerr.Kind, runtime.DivisionByZero)
+	}
+	if want := []string{"f", "f", "f"}; !reflect.DeepEqual(rerr.Stack, want) {
+		t.Errorf("got stack %v, want %v", rerr.Stack, want)
+	}
+}
+
+func TestVMTailCalls(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		out  string
+	}{
+		{"self", `let sum = fn (n, acc) => { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; print(sum(1000000, 0))`, "1784293664\n"},
+		{"let", `let f = fn (n) => { let m = n - 1; if (m == 0) { "done" } else { f(m) } }; print(f(1000000))`, "done\n"},
+		{"mutual", `let odd = fn (n, even) => { if (n == 0) { false } else { even(n - 1) } }; let even = fn (n) => { if (n == 0) { true } else { odd(n - 1, even) } }; print(even(1000001))`, "false\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := parser.ParseString("test.rinha", tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err := vm.Run(context.Background(), &out, file, vm.WithMaxDepth(interpreter.DEFAULT_MAX_DEPTH)); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.out {
+				t.Errorf("got %q, want %q", out.String(), tt.out)
+			}
+		})
+	}
+}
+
+func TestVMLimits(t *testing.T) {
+	const sum = `let sum = fn (n) => { if (n == 0) { 0 } else { n + sum(n - 1) } }; print(sum(1000000))`
+	const fib = `let fib = fn (n) => { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(40)`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	tests := []struct {
+		src  string
+		ctx  context.Context
+		opts []vm.Option
+		kind runtime.ErrorKind
+		err  string
+	}{
+		{sum, context.Background(), []vm.Option{vm.WithMaxDepth(50)}, runtime.StackOverflow, "test.rinha:51:61: stack overflow: calls to sum nested more than 50 deep"},
+		{fib, context.Background(), []vm.Option{vm.WithFuel(1000)}, runtime.OutOfFuel, "out of fuel after 1000 steps"},
+		{fib, ctx, nil, runtime.Canceled, "execution stopped: context deadline exceeded"},
+	}
+
+	for _, tt := range tests {
+		file, err := parser.ParseString("test.rinha", tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rerr *runtime.RuntimeError
+		if err := vm.Run(tt.ctx, nil, file, tt.opts...); !errors.As(err, &rerr) {
+			t.Fatalf("expected a runtime error, got %v", err)
+		}
+		if rerr.Kind != tt.kind || !strings.Contains(rerr.Error(), tt.err) {
+			t.Errorf("got %s %q, want %s %q", rerr.Kind, rerr.Error(), tt.kind, tt.err)
+		}
+	}
+}